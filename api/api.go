@@ -19,6 +19,32 @@ type PVInfo struct {
 	PVAttr string `json:"pvAttr,omitempty"`
 	PVSize uint64 `json:"pvSize,omitempty"`
 	PVFree uint64 `json:"pvFree,omitempty"`
+	// Health is the SMART health of the disk of the pv, the parent disk if the pv is a partition
+	Health *DiskHealth `json:"health,omitempty"`
+}
+
+// Allocatable returns false if the pv is cordoned by pvchange -x n
+func (pv PVInfo) Allocatable() bool {
+	return pv.PVAttr == "" || pv.PVAttr[0] == 'a'
+}
+
+// StripesFit checks that the vg has enough allocatable pvs with free space for each stripe of each copy,
+// a raid volume places every stripe of every image on a different pv
+func StripesFit(pvs []*PVInfo, vgName string, size uint64, stripes, copies uint) bool {
+	if stripes < 1 {
+		stripes = 1
+	}
+	if stripes*copies <= 1 {
+		return true
+	}
+	pvBytes := (size + uint64(stripes) - 1) / uint64(stripes)
+	var fit uint
+	for _, pv := range pvs {
+		if pv != nil && pv.VGName == vgName && pv.PVFree >= pvBytes && pv.Allocatable() {
+			fit++
+		}
+	}
+	return fit >= stripes*copies
 }
 
 // Disk defines disk details
@@ -59,7 +85,42 @@ type Disk struct {
 
 	// UdevInfo is the disk's udev information.
 	UdevInfo UdevInfo `json:"udevInfo,omitempty"`
+
+	// Health is the SMART health of the disk, it is empty if smartctl is unavailable
+	// or the disk does not support SMART.
+	Health *DiskHealth `json:"health,omitempty"`
+}
+
+// DiskHealth defines the SMART health of a disk collected by smartctl
+type DiskHealth struct {
+	// Disk is the kernel name of the disk the health is collected from.
+	Disk string `json:"disk,omitempty"`
+
+	// Passed is the overall SMART health self-assessment of the disk.
+	Passed bool `json:"passed"`
+
+	// ReallocatedSectors is the count of reallocated sectors of ATA disks,
+	// or the grown defect list of SCSI disks.
+	ReallocatedSectors uint64 `json:"reallocatedSectors,omitempty"`
+
+	// MediaErrors is the count of unrecovered data integrity errors of NVMe disks.
+	MediaErrors uint64 `json:"mediaErrors,omitempty"`
+
+	// PercentageUsed is the estimate of the NVMe disk life used, it may exceed 100.
+	PercentageUsed uint64 `json:"percentageUsed,omitempty"`
+
+	// Temperature is the current temperature of the disk in Celsius.
+	Temperature int64 `json:"temperature,omitempty"`
+
+	// Message is the reason why the disk is failing.
+	Message string `json:"message,omitempty"`
+}
+
+// Failing returns true if the disk fails the SMART health self-assessment
+func (h *DiskHealth) Failing() bool {
+	return h != nil && !h.Passed
 }
+
 type DiskType int
 type AttachmentType int
 type TableType int
@@ -0,0 +1,85 @@
+/*
+ Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"google.golang.org/grpc/codes"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LogicSnapshotSpec defines the desired state of LogicSnapshot
+type LogicSnapshotSpec struct {
+	NodeName    string `json:"nodeName"`
+	DeviceGroup string `json:"deviceGroup"`
+	// SourceVolumeID is the volume id of the LogicVolume this snapshot is taken from
+	SourceVolumeID string `json:"sourceVolumeID"`
+	// Size is the size of the source volume at the time the snapshot is taken
+	Size resource.Quantity `json:"size"`
+}
+
+// LogicSnapshotStatus defines the observed state of LogicSnapshot
+type LogicSnapshotStatus struct {
+	SnapshotID   string       `json:"snapshotID,omitempty"`
+	Code         codes.Code   `json:"code,omitempty"`
+	Message      string       `json:"message,omitempty"`
+	Status       string       `json:"status,omitempty"`
+	ReadyToUse   bool         `json:"readyToUse,omitempty"`
+	CreationTime *metav1.Time `json:"creationTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="SIZE",type="string",JSONPath=".spec.size"
+// +kubebuilder:printcolumn:name="GROUP",type="string",JSONPath=".spec.deviceGroup"
+// +kubebuilder:printcolumn:name="NODE",type="string",JSONPath=".spec.nodeName"
+// +kubebuilder:printcolumn:name="SOURCE",type="string",JSONPath=".spec.sourceVolumeID"
+// +kubebuilder:printcolumn:name="STATUS",type="string",JSONPath=".status.status"
+// +kubebuilder:resource:scope=Cluster,shortName=lsnap
+
+// LogicSnapshot is the Schema for the logicsnapshots API
+type LogicSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LogicSnapshotSpec   `json:"spec,omitempty"`
+	Status LogicSnapshotStatus `json:"status,omitempty"`
+}
+
+// IsCompatibleWith returns true if the LogicSnapshot is compatible.
+func (ls *LogicSnapshot) IsCompatibleWith(ls2 *LogicSnapshot) bool {
+	if ls.Name != ls2.Name {
+		return false
+	}
+	if ls.Spec.SourceVolumeID != ls2.Spec.SourceVolumeID {
+		return false
+	}
+	return true
+}
+
+// +kubebuilder:object:root=true
+
+// LogicSnapshotList contains a list of LogicSnapshot
+type LogicSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LogicSnapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LogicSnapshot{}, &LogicSnapshotList{})
+}
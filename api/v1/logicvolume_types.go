@@ -34,6 +34,27 @@ type LogicVolumeSpec struct {
 	DeviceGroup string            `json:"deviceGroup"`
 	Pvc         string            `json:"pvc"`
 	NameSpace   string            `json:"nameSpace"`
+	// Stripes the number of physical volumes the lvm volume is striped across
+	// +optional
+	Stripes uint32 `json:"stripes,omitempty"`
+	// StripeSize the size of each stripe, e.g. 64k
+	// +optional
+	StripeSize string `json:"stripeSize,omitempty"`
+	// RaidType the lvm raid type of the volume, raid1 or raid10
+	// +optional
+	RaidType string `json:"raidType,omitempty"`
+	// Mirrors the number of additional copies of the raid volume
+	// +optional
+	Mirrors uint32 `json:"mirrors,omitempty"`
+	// CacheType the lvm native cache attached to the volume, dm-cache or writecache
+	// +optional
+	CacheType string `json:"cacheType,omitempty"`
+	// CacheRatio the percent of the cache size to the volume size
+	// +optional
+	CacheRatio uint32 `json:"cacheRatio,omitempty"`
+	// CachePolicy the cache mode of dm-cache, writethrough or writeback
+	// +optional
+	CachePolicy string `json:"cachePolicy,omitempty"`
 }
 
 // LogicVolumeStatus defines the observed state of LogicVolume
@@ -47,6 +68,36 @@ type LogicVolumeStatus struct {
 	Status      string             `json:"status,omitempty"`
 	DeviceMajor uint32             `json:"deviceMajor,omitempty"`
 	DeviceMinor uint32             `json:"deviceMinor,omitempty"`
+	Condition   *VolumeCondition   `json:"condition,omitempty"`
+	Raid        *RaidStatus        `json:"raid,omitempty"`
+	Bcache      *BcacheStatus      `json:"bcache,omitempty"`
+}
+
+// BcacheStatus the cache mode of the bcache volume applied by carina-node
+type BcacheStatus struct {
+	// CacheMode the active cache mode, writethrough/writeback/writearound
+	CacheMode string `json:"cacheMode,omitempty"`
+	// State the state of the bcache device, no cache/clean/dirty/inconsistent
+	State string `json:"state,omitempty"`
+	// Message the reason if the requested cache mode is not active yet
+	Message string `json:"message,omitempty"`
+}
+
+// RaidStatus the sync progress and health of the raid volume
+type RaidStatus struct {
+	// SyncPercent the percent of the raid images in sync, e.g. 45.20
+	SyncPercent string `json:"syncPercent,omitempty"`
+	// Degraded true if any raid image is missing or failed
+	Degraded bool `json:"degraded"`
+	// HealthStatus the lv_health_status reported by lvm
+	HealthStatus string `json:"healthStatus,omitempty"`
+}
+
+// VolumeCondition the health of the volume checked by carina-node
+type VolumeCondition struct {
+	Abnormal      bool         `json:"abnormal"`
+	Message       string       `json:"message,omitempty"`
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -57,6 +108,9 @@ type LogicVolumeStatus struct {
 // +kubebuilder:printcolumn:name="STATUS",type="string",JSONPath=".status.status"
 // +kubebuilder:printcolumn:name="NAMESPACE",type="string",priority=1,JSONPath=".spec.nameSpace"
 // +kubebuilder:printcolumn:name="PVC",type="string",priority=1,JSONPath=".spec.pvc"
+// +kubebuilder:printcolumn:name="ABNORMAL",type="boolean",priority=1,JSONPath=".status.condition.abnormal"
+// +kubebuilder:printcolumn:name="SYNC",type="string",priority=1,JSONPath=".status.raid.syncPercent"
+// +kubebuilder:printcolumn:name="CACHEMODE",type="string",priority=1,JSONPath=".status.bcache.cacheMode"
 // +kubebuilder:resource:scope=Cluster,shortName=lv
 
 // LogicVolume is the Schema for the logicvolumes API
@@ -25,6 +25,115 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BcacheStatus) DeepCopyInto(out *BcacheStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BcacheStatus.
+func (in *BcacheStatus) DeepCopy() *BcacheStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BcacheStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogicSnapshot) DeepCopyInto(out *LogicSnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogicSnapshot.
+func (in *LogicSnapshot) DeepCopy() *LogicSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(LogicSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LogicSnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogicSnapshotList) DeepCopyInto(out *LogicSnapshotList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LogicSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogicSnapshotList.
+func (in *LogicSnapshotList) DeepCopy() *LogicSnapshotList {
+	if in == nil {
+		return nil
+	}
+	out := new(LogicSnapshotList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LogicSnapshotList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogicSnapshotSpec) DeepCopyInto(out *LogicSnapshotSpec) {
+	*out = *in
+	out.Size = in.Size.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogicSnapshotSpec.
+func (in *LogicSnapshotSpec) DeepCopy() *LogicSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LogicSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogicSnapshotStatus) DeepCopyInto(out *LogicSnapshotStatus) {
+	*out = *in
+	if in.CreationTime != nil {
+		in, out := &in.CreationTime, &out.CreationTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogicSnapshotStatus.
+func (in *LogicSnapshotStatus) DeepCopy() *LogicSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LogicSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LogicVolume) DeepCopyInto(out *LogicVolume) {
 	*out = *in
@@ -108,6 +217,21 @@ func (in *LogicVolumeStatus) DeepCopyInto(out *LogicVolumeStatus) {
 		x := (*in).DeepCopy()
 		*out = &x
 	}
+	if in.Condition != nil {
+		in, out := &in.Condition, &out.Condition
+		*out = new(VolumeCondition)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Raid != nil {
+		in, out := &in.Raid, &out.Raid
+		*out = new(RaidStatus)
+		**out = **in
+	}
+	if in.Bcache != nil {
+		in, out := &in.Bcache, &out.Bcache
+		*out = new(BcacheStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogicVolumeStatus.
@@ -119,3 +243,37 @@ func (in *LogicVolumeStatus) DeepCopy() *LogicVolumeStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RaidStatus) DeepCopyInto(out *RaidStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RaidStatus.
+func (in *RaidStatus) DeepCopy() *RaidStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RaidStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeCondition) DeepCopyInto(out *VolumeCondition) {
+	*out = *in
+	if in.LastCheckTime != nil {
+		in, out := &in.LastCheckTime, &out.LastCheckTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeCondition.
+func (in *VolumeCondition) DeepCopy() *VolumeCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeCondition)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -30,6 +30,39 @@ type NodeStorageResourceSpec struct {
 
 	// Foo is an example field of NodeStorageResource. Edit nodestorageresource_types.go to remove/update
 	NodeName string `json:"nodeName,omitempty"`
+	// DiskCordons the pvs of the node that take no new allocations, a drained pv is also removed from its volume group
+	// +optional
+	DiskCordons []DiskCordon `json:"diskCordons,omitempty"`
+}
+
+// DiskCordon cordons a pv of the node
+type DiskCordon struct {
+	// Disk is the pv name, such as /dev/sdb
+	Disk string `json:"disk"`
+	// Drain moves the extents of the pv to the other pvs of its volume group, then removes the pv from the volume group
+	// +optional
+	Drain bool `json:"drain,omitempty"`
+}
+
+// the phases of the cordoned disk
+const (
+	DiskCordoned = "Cordoned"
+	DiskDraining = "Draining"
+	DiskDrained  = "Drained"
+	DiskFailed   = "Failed"
+)
+
+// DiskCordonStatus the progress of the cordoned disk
+type DiskCordonStatus struct {
+	Disk   string `json:"disk"`
+	VGName string `json:"vgName,omitempty"`
+	// Phase is Cordoned, Draining, Drained or Failed
+	Phase string `json:"phase"`
+	// Progress the percent of the extents moved by pvmove
+	// +optional
+	Progress string `json:"progress,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // NodeStorageResourceStatus defines the observed state of NodeStorageResource
@@ -53,6 +86,41 @@ type NodeStorageResourceStatus struct {
 	Disks []api.Disk `json:"disks,,omitempty"`
 	// +optional
 	RAIDs []api.Raid `json:"raids,omitempty"`
+	// DeviceUtilization the percent of time the disks of a device group were busy since the last sync,
+	// the key is the same as Allocatable without the prefix
+	// +optional
+	DeviceUtilization map[string]uint32 `json:"deviceUtilization,omitempty"`
+	// DiskPlan the disks the disk selector adds to and removes from the volume groups
+	// +optional
+	DiskPlan *DiskPlan `json:"diskPlan,omitempty"`
+	// DiskCordons the progress of the disks cordoned in spec
+	// +optional
+	DiskCordons []DiskCordonStatus `json:"diskCordons,omitempty"`
+}
+
+// DiskPlan the disk changes of the disk selector on the node, the removal waits for the approval in approve mode
+type DiskPlan struct {
+	// ID of the plan, approve it by annotating NodeStorageResource with carina.storage.io/disk-plan-approved=<id>
+	ID string `json:"id"`
+	// Mode is the diskPlanMode of config.json, auto, approve or dryRun
+	Mode string `json:"mode"`
+	// Add the disks to be added to the volume groups, only pending in dryRun mode or when adding failed
+	// +optional
+	Add []DiskChange `json:"add,omitempty"`
+	// Remove the pvs to be removed from the volume groups
+	// +optional
+	Remove []DiskChange `json:"remove,omitempty"`
+	// Approved the removal has been approved
+	// +optional
+	Approved bool `json:"approved,omitempty"`
+	// CreationTime the plan keeps its id and creation time until new pvs are to be removed
+	CreationTime metav1.Time `json:"creationTime"`
+}
+
+// DiskChange the disks of one volume group
+type DiskChange struct {
+	VGName string   `json:"vgName"`
+	Disks  []string `json:"disks"`
 }
 
 // +kubebuilder:object:root=true
@@ -27,12 +27,92 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskChange) DeepCopyInto(out *DiskChange) {
+	*out = *in
+	if in.Disks != nil {
+		in, out := &in.Disks, &out.Disks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskChange.
+func (in *DiskChange) DeepCopy() *DiskChange {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskCordon) DeepCopyInto(out *DiskCordon) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskCordon.
+func (in *DiskCordon) DeepCopy() *DiskCordon {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskCordon)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskCordonStatus) DeepCopyInto(out *DiskCordonStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskCordonStatus.
+func (in *DiskCordonStatus) DeepCopy() *DiskCordonStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskCordonStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskPlan) DeepCopyInto(out *DiskPlan) {
+	*out = *in
+	if in.Add != nil {
+		in, out := &in.Add, &out.Add
+		*out = make([]DiskChange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Remove != nil {
+		in, out := &in.Remove, &out.Remove
+		*out = make([]DiskChange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.CreationTime.DeepCopyInto(&out.CreationTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskPlan.
+func (in *DiskPlan) DeepCopy() *DiskPlan {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskPlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeStorageResource) DeepCopyInto(out *NodeStorageResource) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -89,6 +169,11 @@ func (in *NodeStorageResourceList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeStorageResourceSpec) DeepCopyInto(out *NodeStorageResourceSpec) {
 	*out = *in
+	if in.DiskCordons != nil {
+		in, out := &in.DiskCordons, &out.DiskCordons
+		*out = make([]DiskCordon, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeStorageResourceSpec.
@@ -134,6 +219,23 @@ func (in *NodeStorageResourceStatus) DeepCopyInto(out *NodeStorageResourceStatus
 		*out = make([]api.Raid, len(*in))
 		copy(*out, *in)
 	}
+	if in.DeviceUtilization != nil {
+		in, out := &in.DeviceUtilization, &out.DeviceUtilization
+		*out = make(map[string]uint32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.DiskPlan != nil {
+		in, out := &in.DiskPlan, &out.DiskPlan
+		*out = new(DiskPlan)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DiskCordons != nil {
+		in, out := &in.DiskCordons, &out.DiskCordons
+		*out = make([]DiskCordonStatus, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeStorageResourceStatus.
@@ -31,7 +31,9 @@ var config struct {
 	metricsAddr string
 	webhookAddr string
 	certDir     string
-	zapOpts     zap.Options
+	// storageCapacity publishes CSIStorageCapacity, requires kubernetes 1.24+
+	storageCapacity bool
+	zapOpts         zap.Options
 }
 
 var rootCmd = &cobra.Command{
@@ -62,6 +64,7 @@ func init() {
 	fs.StringVar(&config.metricsAddr, "metrics-addr", ":8080", "Listen address for metrics")
 	fs.StringVar(&config.webhookAddr, "webhook-addr", ":8443", "Listen address for the webhook endpoint")
 	fs.StringVar(&config.certDir, "cert-dir", "", "certificate directory")
+	fs.BoolVar(&config.storageCapacity, "storage-capacity", false, "Publish CSIStorageCapacity of carina storage classes for the storage capacity tracking of kube-scheduler")
 
 	goflags := flag.NewFlagSet("klog", flag.ExitOnError)
 	klog.InitFlags(goflags)
@@ -112,6 +112,16 @@ func subMain() error {
 		setupLog.Error(err, "unable to create controller", "controller", "Node")
 		return err
 	}
+	if config.storageCapacity {
+		capacitycontroller := &controllers.StorageCapacityReconciler{
+			Client:    mgr.GetClient(),
+			Namespace: configuration.RuntimeNamespace(),
+		}
+		if err := capacitycontroller.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "StorageCapacity")
+			return err
+		}
+	}
 
 	//+kubebuilder:scaffold:builder
 
@@ -127,10 +137,14 @@ func subMain() error {
 		return err
 	}
 	n := k8s.NewNodeService(mgr, lvService)
+	snapshotService, err := k8s.NewLogicSnapshotService(mgr)
+	if err != nil {
+		return err
+	}
 
 	grpcServer := grpc.NewServer()
 	csi.RegisterIdentityServer(grpcServer, driver.NewIdentityService(checker.Ready))
-	csi.RegisterControllerServer(grpcServer, driver.NewControllerService(lvService, n))
+	csi.RegisterControllerServer(grpcServer, driver.NewControllerService(lvService, n, snapshotService))
 
 	// gRPC service itself should run even when the manager is *not* a leader
 	// because CSI sidecar containers choose a leader.
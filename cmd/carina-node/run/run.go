@@ -116,6 +116,23 @@ func subMain() error {
 		setupLog.Error(err, "unable to create controller", "controller", "LogicalVolume")
 		return err
 	}
+	// logic snapshot controller
+	snapshotController := controllers.NewLogicSnapshotReconciler(
+		mgr.GetClient(),
+		mgr.GetEventRecorderFor("logicsnapshot-node"),
+		dm,
+	)
+	if err = snapshotController.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "LogicSnapshot")
+		return err
+	}
+
+	// disk cordon controller
+	diskCordonController := controllers.NewDiskCordonReconciler(mgr.GetClient(), dm)
+	if err = diskCordonController.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DiskCordon")
+		return err
+	}
 
 	//+kubebuilder:scaffold:builder
 
@@ -29,14 +29,24 @@ const (
 
 	// LogicVolumeFinalizer LogicalVolumeFinalizer is the name of LogicalVolume finalizer
 	LogicVolumeFinalizer = "carina.storage.io/logicvolume"
+	// LogicSnapshotFinalizer is the name of LogicSnapshot finalizer
+	LogicSnapshotFinalizer = "carina.storage.io/logicsnapshot"
 	// ResizeRequestedAtKey is the key of LogicalVolume that represents the timestamp of the resize request.
 	ResizeRequestedAtKey = "carina.storage.io/resize-requested-at"
 
 	// ExclusivityDisk  true or false  is the key indicates that only the disk is used by one pod
 	ExclusivityDisk = "carina.storage.io/exclusively-raw-disk"
 
+	// DiskPlanApproved the annotation of NodeStorageResource, its value is the id of the approved disk plan
+	DiskPlanApproved = "carina.storage.io/disk-plan-approved"
+
 	VolumeManagerType = "carina.io/volume-manage-type"
 
+	// VolumeSourceSnapshot the snapshot id which the LogicVolume is restored from
+	VolumeSourceSnapshot = "carina.storage.io/source-snapshot"
+	// VolumeSourceVolume the volume id which the LogicVolume is cloned from
+	VolumeSourceVolume = "carina.storage.io/source-volume"
+
 	// DeviceDiskKey storage class
 	// DeviceDiskKey is the key used in CSI volume create requests to specify a DeviceDiskKey support carina-vg-ssd carina-vg-hdd
 	DeviceDiskKey = "carina.storage.io/disk-group-name"
@@ -47,6 +57,41 @@ const (
 	VolumeCacheDiskRatio = "carina.storage.io/cache-disk-ratio"
 	// VolumeCachePolicy value: writethrough|writeback|writearound
 	VolumeCachePolicy = "carina.storage.io/cache-policy"
+	// VolumeCacheType value: bcache|dm-cache|writecache, default bcache,
+	// dm-cache and writecache are lvm native cache which need the backend and cache disk group to be the same vg
+	VolumeCacheType     = "carina.storage.io/cache-type"
+	CacheTypeBcache     = "bcache"
+	CacheTypeDmCache    = "dm-cache"
+	CacheTypeWritecache = "writecache"
+
+	// VolumeLvmType value: thin|raid1|raid10, thin creates the volume in the thin pool of the volume group,
+	// raid1 and raid10 create the mirrored volume across physical volumes of the volume group
+	VolumeLvmType = "carina.storage.io/lvm-type"
+	LvmTypeThin   = "thin"
+	LvmTypeRaid1  = "raid1"
+	LvmTypeRaid10 = "raid10"
+	// VolumeLvmMirrors value: number of additional copies of raid volume, default 1
+	VolumeLvmMirrors = "carina.storage.io/lvm-mirrors"
+	// VolumeLvmStripes value: number of physical volumes to stripe the volume across
+	VolumeLvmStripes = "carina.storage.io/lvm-stripes"
+	// VolumeLvmStripeSize value: size of each stripe, e.g. 64k
+	VolumeLvmStripeSize = "carina.storage.io/lvm-stripe-size"
+
+	// VolumeSchedulerStrategy value: binpack|spreadout, overrides the schedulerStrategy of config.json for the storage class
+	VolumeSchedulerStrategy = "carina.storage.io/scheduler-strategy"
+
+	// VolumeDiskAntiAffinity value: preferred|required, spread the volumes sharing the anti-affinity key
+	// across different raw disks, or different pvs of the lvm device group. The pvc annotation overrides the storage class
+	VolumeDiskAntiAffinity = "carina.storage.io/disk-anti-affinity"
+	// VolumeDiskAntiAffinityKey the group key of the volumes to spread, it is scoped in the namespace of the pvc
+	VolumeDiskAntiAffinityKey = "carina.storage.io/disk-anti-affinity-key"
+	DiskAntiAffinityPreferred = "preferred"
+	DiskAntiAffinityRequired  = "required"
+
+	// VolumeEncrypted value: true|false, wrap the volume in dm-crypt/LUKS on the node
+	VolumeEncrypted = "carina.storage.io/encrypted"
+	// EncryptionPassphraseKey the key of the LUKS passphrase in the node stage secret
+	EncryptionPassphraseKey = "passphrase"
 
 	// MinRequestSizeGb pvc
 	// default size in GiB for volumes (PVC or inline ephemeral volumes) w/o capacity requests.
@@ -71,12 +116,16 @@ const (
 	// TopologyNodeKey topology
 	// TopologyZoneKey is the key of topology that represents zone name.
 	TopologyNodeKey = "topology.carina.storage.io/node"
+	// TopologyDeviceGroupKeyPrefix the segment of each device group in config.json, the value is true if the node has the device group
+	TopologyDeviceGroupKeyPrefix = "device.topology.carina.storage.io/"
 
 	// DeviceCapacityKeyPrefix device plugin
 	DeviceCapacityKeyPrefix = "carina.storage.io/"
 	// DeviceVGSSD support disk type
 	DeviceVGSSD = "carina-vg-ssd"
 	DeviceVGHDD = "carina-vg-hdd"
+	// ThinCapacityKeyPrefix thin pool allocatable with overcommit ratio applied
+	ThinCapacityKeyPrefix = "thin.carina.storage.io/"
 
 	// CarinaSchedule custom schedule
 	CarinaSchedule = "carina-scheduler"
@@ -94,9 +143,12 @@ const (
 	// Updates from Kubernetes API Server
 	ApiserverSource = "api"
 
-	ThinPrefix   = "thin-"
-	VolumePrefix = "volume-"
-	HostPrefix   = "host-"
+	ThinPrefix     = "thin-"
+	VolumePrefix   = "volume-"
+	HostPrefix     = "host-"
+	SnapshotPrefix = "snapshot-"
+	// ThinPoolName the thin pool shared by all thin volumes of a volume group
+	ThinPoolName = "thin-pool"
 
 	DefaultHostPath = "/opt/carina-hostpath"
 
@@ -0,0 +1,181 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/carina-io/carina/api"
+	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
+	deviceManager "github.com/carina-io/carina/pkg/devicemanager"
+	"github.com/carina-io/carina/utils/log"
+	"k8s.io/apimachinery/pkg/api/equality"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// diskDrainPollInterval pvmove迁移期间刷新进度的间隔
+	diskDrainPollInterval = 10 * time.Second
+	// diskCordonRetryInterval 隔离或迁移失败后重试的间隔，如等待卷组释放出足够的空间
+	diskCordonRetryInterval = 30 * time.Second
+)
+
+// DiskCordonReconciler cordons and drains the pvs listed in the spec of NodeStorageResource of the node
+type DiskCordonReconciler struct {
+	client.Client
+	dm *deviceManager.DeviceManager
+}
+
+// +kubebuilder:rbac:groups=carina.storage.io,resources=nodestorageresources,verbs=get;list;watch
+
+func NewDiskCordonReconciler(client client.Client, dm *deviceManager.DeviceManager) *DiskCordonReconciler {
+	return &DiskCordonReconciler{
+		Client: client,
+		dm:     dm,
+	}
+}
+
+// Reconcile the NodeStorageResource of the node, the progress is reported in its status by nodeStorageResourceReconciler
+func (r *DiskCordonReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	nsr := new(carinav1beta1.NodeStorageResource)
+	if err := r.Get(ctx, req.NamespacedName, nsr); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	pvs, err := r.dm.VolumeManager.GetCurrentPvStruct()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 本节点上报的状态，重启后取nodeStorageResource中保留的状态
+	previous := append(r.dm.GetDiskCordons(), nsr.Status.DiskCordons...)
+
+	var requeue time.Duration
+	changed := false
+	cordoned := map[string]bool{}
+	var statuses []carinav1beta1.DiskCordonStatus
+	for _, cordon := range nsr.Spec.DiskCordons {
+		cordoned[cordon.Disk] = true
+		status, pvChanged, retry := r.cordonDisk(cordon, pvs, previous)
+		statuses = append(statuses, status)
+		changed = changed || pvChanged
+		if retry > 0 && (requeue == 0 || retry < requeue) {
+			requeue = retry
+		}
+	}
+
+	// 从spec中删除的pv恢复分配，SMART检查失败而隔离的pv除外
+	disks, err := r.dm.VolumeManager.CordonedDisks()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, disk := range disks {
+		if cordoned[disk] || r.dm.PVUnschedulable(disk) {
+			continue
+		}
+		if err := r.dm.VolumeManager.UncordonDisk(disk); err != nil {
+			log.Errorf("uncordon pv %s failed %s", disk, err.Error())
+			requeue = diskCordonRetryInterval
+			continue
+		}
+		changed = true
+	}
+
+	if changed || !equality.Semantic.DeepEqual(statuses, r.dm.GetDiskCordons()) {
+		r.dm.SetDiskCordons(statuses)
+		// 隔离的pv立即从allocatable中扣除
+		r.dm.NoticeUpdateCapacity(deviceManager.DiskCordonController, nil)
+	}
+	return ctrl.Result{RequeueAfter: requeue}, nil
+}
+
+// cordonDisk returns the status of the cordoned pv, whether the pv is changed and when to check it again
+func (r *DiskCordonReconciler) cordonDisk(cordon carinav1beta1.DiskCordon, pvs []api.PVInfo, previous []carinav1beta1.DiskCordonStatus) (carinav1beta1.DiskCordonStatus, bool, time.Duration) {
+	status := carinav1beta1.DiskCordonStatus{Disk: cordon.Disk, Phase: carinav1beta1.DiskCordoned}
+	var pv *api.PVInfo
+	for i := range pvs {
+		if pvs[i].PVName == cordon.Disk {
+			pv = &pvs[i]
+		}
+	}
+	if pv == nil || pv.VGName == "" {
+		// 迁移完成后pv已被移出卷组，只有确认迁移完成过的pv才报告为Drained，避免磁盘名称写错时被误报
+		if cordon.Drain && diskDrained(previous, cordon.Disk) {
+			status.Phase = carinav1beta1.DiskDrained
+			status.Progress = "100.00"
+			return status, false, 0
+		}
+		status.Phase = carinav1beta1.DiskFailed
+		status.Message = "pv not found in any volume group"
+		return status, false, 0
+	}
+	status.VGName = pv.VGName
+
+	if err := r.dm.VolumeManager.CordonDisk(cordon.Disk); err != nil {
+		log.Errorf("cordon pv %s failed %s", cordon.Disk, err.Error())
+		status.Phase = carinav1beta1.DiskFailed
+		status.Message = err.Error()
+		return status, false, diskCordonRetryInterval
+	}
+	changed := pv.Allocatable()
+	if !cordon.Drain {
+		return status, changed, 0
+	}
+
+	progress, drained, err := r.dm.VolumeManager.DrainDisk(cordon.Disk, pv.VGName)
+	status.Progress = progress
+	switch {
+	case err != nil:
+		log.Errorf("drain pv %s of vg %s failed %s", cordon.Disk, pv.VGName, err.Error())
+		status.Phase = carinav1beta1.DiskFailed
+		status.Message = err.Error()
+		return status, changed, diskCordonRetryInterval
+	case drained:
+		log.Infof("pv %s is drained and removed from vg %s", cordon.Disk, pv.VGName)
+		status.Phase = carinav1beta1.DiskDrained
+		return status, true, 0
+	default:
+		status.Phase = carinav1beta1.DiskDraining
+		return status, changed, diskDrainPollInterval
+	}
+}
+
+// diskDrained returns true if the disk has been reported as drained
+func diskDrained(statuses []carinav1beta1.DiskCordonStatus, disk string) bool {
+	for _, status := range statuses {
+		if status.Disk == disk && status.Phase == carinav1beta1.DiskDrained {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up Reconciler with Manager.
+func (r *DiskCordonReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&carinav1beta1.NodeStorageResource{}, builder.WithPredicates(
+			predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.GetName() == r.dm.NodeName
+			}),
+			// 状态由节点上报，只关注spec的变化
+			predicate.GenerationChangedPredicate{},
+		)).
+		Complete(r)
+}
@@ -18,23 +18,34 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"google.golang.org/grpc/codes"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/carina-io/carina"
 	carinav1 "github.com/carina-io/carina/api/v1"
+	"github.com/carina-io/carina/pkg/configuration"
 	deviceManager "github.com/carina-io/carina/pkg/devicemanager"
+	"github.com/carina-io/carina/pkg/devicemanager/hostpath"
+	"github.com/carina-io/carina/pkg/devicemanager/volume"
 	"github.com/carina-io/carina/utils"
 	"github.com/carina-io/carina/utils/log"
 )
@@ -48,6 +59,7 @@ type LogicVolumeReconciler struct {
 
 // +kubebuilder:rbac:groups=carina.storage.io,resources=logicvolumes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=carina.storage.io,resources=logicvolumes/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch
 
 func NewLogicVolumeReconciler(client client.Client, recorder record.EventRecorder, dm *deviceManager.DeviceManager) *LogicVolumeReconciler {
 	return &LogicVolumeReconciler{
@@ -70,6 +82,10 @@ func (r *LogicVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	if lv.ObjectMeta.DeletionTimestamp == nil {
+		// the logicVolumes of other nodes are enqueued by the events of pvc
+		if lv.Spec.NodeName != r.dm.NodeName {
+			return ctrl.Result{}, nil
+		}
 		if lv.Status.VolumeID == "" {
 			err := r.createLV(ctx, lv)
 			if err != nil {
@@ -80,8 +96,13 @@ func (r *LogicVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		err := r.expandLV(ctx, lv)
 		if err != nil {
 			log.Error(err, " failed to expand LV name ", lv.Name)
+			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		result, err := r.reconcileCacheMode(ctx, lv)
+		if err != nil {
+			log.Error(err, " failed to change cache mode of LV name ", lv.Name)
+		}
+		return result, err
 	}
 
 	// finalization
@@ -96,8 +117,8 @@ func (r *LogicVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 func (r *LogicVolumeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&carinav1.LogicVolume{}).
-		WithEventFilter(&logicVolumeFilter{r.dm.NodeName}).
+		For(&carinav1.LogicVolume{}, builder.WithPredicates(&logicVolumeFilter{r.dm.NodeName})).
+		Watches(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, handler.EnqueueRequestsFromMapFunc(pvcCachePolicyToLogicVolume)).
 		WithOptions(controller.Options{
 			MaxConcurrentReconciles: 5,
 		}).
@@ -163,7 +184,25 @@ func (r *LogicVolumeReconciler) createLV(ctx context.Context, lv *carinav1.Logic
 	switch lv.Annotations[carina.VolumeManagerType] {
 	case carina.LvmVolumeType:
 		err := utils.UntilMaxRetry(func() error {
-			return r.dm.VolumeManager.CreateVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), 1)
+			if snapshotID, ok := lv.Annotations[carina.VolumeSourceSnapshot]; ok {
+				return r.dm.VolumeManager.CreateVolumeFromSnapshot(lv.Name, lv.Spec.DeviceGroup, snapshotID, uint64(reqBytes), lv.Spec.RaidType, uint(lv.Spec.Mirrors), uint(lv.Spec.Stripes), lv.Spec.StripeSize)
+			}
+			if sourceVolumeID, ok := lv.Annotations[carina.VolumeSourceVolume]; ok {
+				return r.dm.VolumeManager.CreateVolumeFromVolume(lv.Name, lv.Spec.DeviceGroup, sourceVolumeID, uint64(reqBytes), lv.Spec.RaidType, uint(lv.Spec.Mirrors), uint(lv.Spec.Stripes), lv.Spec.StripeSize)
+			}
+			if lv.Spec.CacheType != "" {
+				return r.dm.VolumeManager.CreateCacheVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), cacheBytes(lv, reqBytes), lv.Spec.CacheType, lv.Spec.CachePolicy)
+			}
+			if lv.Spec.RaidType != "" {
+				return r.dm.VolumeManager.CreateRaidVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), lv.Spec.RaidType, uint(lv.Spec.Mirrors), uint(lv.Spec.Stripes), lv.Spec.StripeSize)
+			}
+			if lv.Annotations[carina.VolumeLvmType] == carina.LvmTypeThin {
+				return r.dm.VolumeManager.CreateThinVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), configuration.ThinOvercommitRatio(lv.Spec.DeviceGroup))
+			}
+			if policy := lv.Annotations[carina.VolumeDiskAntiAffinity]; policy != "" && lv.Spec.Stripes <= 1 {
+				return r.dm.VolumeManager.CreateAntiAffinityVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), lv.Annotations[carina.VolumeDiskAntiAffinityKey], policy == carina.DiskAntiAffinityRequired)
+			}
+			return r.dm.VolumeManager.CreateVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), 1, uint(lv.Spec.Stripes), lv.Spec.StripeSize)
 		}, 3, 1*time.Second)
 
 		if err != nil {
@@ -197,6 +236,12 @@ func (r *LogicVolumeReconciler) createLV(ctx context.Context, lv *carinav1.Logic
 			log.Info("name: ", utils.PartitionName(lv.Name), " group: ", lv.Spec.DeviceGroup, " size: ", uint64(reqBytes))
 			return r.dm.Partition.CreatePartition(utils.PartitionName(lv.Name), lv.Spec.DeviceGroup, uint64(reqBytes))
 		}, 3, 1*time.Second)
+		// 复制失败时只重试复制，不重复创建分区
+		if sourceVolumeID, ok := lv.Annotations[carina.VolumeSourceVolume]; ok && err == nil {
+			err = utils.UntilMaxRetry(func() error {
+				return r.clonePartition(ctx, lv, sourceVolumeID)
+			}, 3, 1*time.Second)
+		}
 
 		if err != nil {
 			if err.Error() == carina.ResourceExhausted {
@@ -228,8 +273,12 @@ func (r *LogicVolumeReconciler) createLV(ctx context.Context, lv *carinav1.Logic
 
 	case carina.HostVolumeType:
 		err := utils.UntilMaxRetry(func() error {
-			return r.dm.Host.CreateVolume(lv.Name, lv.Spec.DeviceGroup)
+			return r.dm.Host.CreateVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes))
 		}, 3, 1*time.Second)
+		if errors.Is(err, hostpath.ErrQuotaNotSupported) {
+			r.recorder.Event(lv, corev1.EventTypeWarning, "HostVolumeQuotaNotEnforced", fmt.Sprintf("the size of host volume is not enforced node: %s, error: %s", r.dm.NodeName, err.Error()))
+			err = nil
+		}
 
 		if err != nil {
 			lv.Status.Code = codes.Internal
@@ -287,6 +336,12 @@ func (r *LogicVolumeReconciler) expandLV(ctx context.Context, lv *carinav1.Logic
 	switch lv.Annotations[carina.VolumeManagerType] {
 	case carina.LvmVolumeType:
 		err := utils.UntilMaxRetry(func() error {
+			if lv.Spec.CacheType != "" {
+				return r.dm.VolumeManager.ResizeCacheVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), cacheBytes(lv, reqBytes), lv.Spec.CacheType, lv.Spec.CachePolicy)
+			}
+			if lv.Annotations[carina.VolumeLvmType] == carina.LvmTypeThin {
+				return r.dm.VolumeManager.ResizeThinVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), configuration.ThinOvercommitRatio(lv.Spec.DeviceGroup))
+			}
 			return r.dm.VolumeManager.ResizeVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes), 1)
 		}, 3, 1*time.Second)
 		if err != nil {
@@ -330,8 +385,24 @@ func (r *LogicVolumeReconciler) expandLV(ctx context.Context, lv *carinav1.Logic
 		}
 
 	case carina.HostVolumeType:
-		// _ = r.dm.Host.ResizeVolume(lv.Name, lv.Spec.DeviceGroup)
-		return nil
+		err := utils.UntilMaxRetry(func() error {
+			return r.dm.Host.ResizeVolume(lv.Name, lv.Spec.DeviceGroup, uint64(reqBytes))
+		}, 3, 1*time.Second)
+		if errors.Is(err, hostpath.ErrQuotaNotSupported) {
+			r.recorder.Event(lv, corev1.EventTypeWarning, "HostVolumeQuotaNotEnforced", fmt.Sprintf("the size of host volume is not enforced node: %s, error: %s", r.dm.NodeName, err.Error()))
+			err = nil
+		}
+		if err != nil {
+			lv.Status.Message = err.Error()
+			lv.Status.Status = "Failed"
+			r.recorder.Event(lv, corev1.EventTypeWarning, "ExpandVolumeFailed", fmt.Sprintf("expand volume failed node: %s, time: %s, error: %s", r.dm.NodeName, time.Now().Format("2006-01-02T15:04:05.000Z"), err.Error()))
+		} else {
+			lv.Status.CurrentSize = resource.NewQuantity(reqBytes, resource.BinarySI)
+			lv.Status.Code = codes.OK
+			lv.Status.Message = ""
+			lv.Status.Status = "Success"
+			r.recorder.Event(lv, corev1.EventTypeNormal, "ExpandVolumeSuccess", fmt.Sprintf("expand volume success node: %s, time: %s", r.dm.NodeName, time.Now().Format("2006-01-02T15:04:05.000Z")))
+		}
 
 	default:
 		log.Errorf("Create LogicVolume: %s with no support volume type undefined %s", lv.Name, lv.Annotations[carina.VolumeManagerType])
@@ -352,6 +423,115 @@ func (r *LogicVolumeReconciler) expandLV(ctx context.Context, lv *carinav1.Logic
 	return nil
 }
 
+// cacheBytes the lvm native cache takes the percent of the volume size in GiB
+func cacheBytes(lv *carinav1.LogicVolume, size int64) uint64 {
+	sizeGb := (size + 1<<30 - 1) >> 30
+	return uint64(utils.CacheGb(sizeGb, lv.Spec.CacheRatio)) << 30
+}
+
+// reconcileCacheMode applies the cache mode annotated on the pvc or the logicVolume to the bcache device,
+// switching to writethrough completes after the dirty data in the cache is written back
+func (r *LogicVolumeReconciler) reconcileCacheMode(ctx context.Context, lv *carinav1.LogicVolume) (ctrl.Result, error) {
+	// the cache volume of bcache is named cache-xxx and shares the annotations of the backend volume
+	if lv.Annotations[carina.VolumeCacheDiskRatio] == "" || strings.HasPrefix(lv.Name, "cache-") || lv.Status.VolumeID == "" {
+		return ctrl.Result{}, nil
+	}
+
+	// the annotation of pvc is copied to logicVolume, NodeStageVolume applies it when the bcache device is created again
+	if pvc := r.getPvcCachePolicy(ctx, lv); pvc != "" && pvc != lv.Annotations[carina.VolumeCachePolicy] {
+		lv.Annotations[carina.VolumeCachePolicy] = pvc
+		return ctrl.Result{}, r.Update(ctx, lv)
+	}
+
+	cacheMode := lv.Annotations[carina.VolumeCachePolicy]
+	if cacheMode == "" {
+		return ctrl.Result{}, nil
+	}
+	if !utils.ContainsString([]string{"writethrough", "writeback", "writearound"}, cacheMode) {
+		r.recorder.Event(lv, corev1.EventTypeWarning, "InvalidCacheMode", fmt.Sprintf("%s %s should be writethrough, writeback or writearound", carina.VolumeCachePolicy, cacheMode))
+		return ctrl.Result{}, nil
+	}
+
+	var result ctrl.Result
+	bcacheStatus := &carinav1.BcacheStatus{}
+	devicePath := fmt.Sprintf("/dev/%s/%s", lv.Spec.DeviceGroup, lv.Status.VolumeID)
+	activeMode, state, err := r.dm.VolumeManager.BcacheCacheMode(devicePath)
+	switch {
+	case errors.Is(err, volume.ErrBcacheNotActive):
+		bcacheStatus.Message = "bcache device is not active, the cache mode is applied when the volume is staged"
+	case err != nil:
+		return ctrl.Result{}, err
+	default:
+		// the mode reported before, the status is empty before the first change
+		reportedMode := activeMode
+		if lv.Status.Bcache != nil && lv.Status.Bcache.CacheMode != "" {
+			reportedMode = lv.Status.Bcache.CacheMode
+		}
+		if activeMode != cacheMode {
+			if err = r.dm.VolumeManager.SetBcacheCacheMode(devicePath, cacheMode); err != nil {
+				r.recorder.Event(lv, corev1.EventTypeWarning, "ChangeCacheModeFailed", fmt.Sprintf("change cache mode from %s to %s failed node: %s, error: %s", activeMode, cacheMode, r.dm.NodeName, err.Error()))
+				return ctrl.Result{}, err
+			}
+			if activeMode, state, err = r.dm.VolumeManager.BcacheCacheMode(devicePath); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		bcacheStatus.CacheMode = activeMode
+		bcacheStatus.State = state
+		if cacheMode == "writethrough" && state == "dirty" {
+			// the previous mode is still reported until the dirty data is drained
+			bcacheStatus.CacheMode = reportedMode
+			bcacheStatus.Message = "waiting for the dirty data to be written back"
+			result.RequeueAfter = 10 * time.Second
+		} else if reportedMode != activeMode {
+			r.recorder.Event(lv, corev1.EventTypeNormal, "CacheModeChanged", fmt.Sprintf("change cache mode from %s to %s success node: %s", reportedMode, activeMode, r.dm.NodeName))
+		}
+	}
+
+	if equality.Semantic.DeepEqual(lv.Status.Bcache, bcacheStatus) {
+		return result, nil
+	}
+	lv.Status.Bcache = bcacheStatus
+	if err := r.Status().Update(ctx, lv); err != nil {
+		log.Error(err, " failed to update status name ", lv.Name, " uid ", lv.UID)
+		return result, err
+	}
+	return result, nil
+}
+
+// getPvcCachePolicy returns the cache mode annotated on the pvc of logicVolume
+func (r *LogicVolumeReconciler) getPvcCachePolicy(ctx context.Context, lv *carinav1.LogicVolume) string {
+	if lv.Spec.Pvc == "" {
+		return ""
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: lv.Spec.NameSpace, Name: lv.Spec.Pvc}, pvc); err != nil {
+		if !apierrs.IsNotFound(err) {
+			log.Warnf("get pvc %s/%s failed %s", lv.Spec.NameSpace, lv.Spec.Pvc, err.Error())
+		}
+		return ""
+	}
+	return pvc.Annotations[carina.VolumeCachePolicy]
+}
+
+// pvcCachePolicyToLogicVolume enqueues the logicVolume of the pvc annotated with cache mode, the logicVolume is named after pv
+func pvcCachePolicyToLogicVolume(obj client.Object) []reconcile.Request {
+	pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok || pvc.Spec.VolumeName == "" || pvc.Annotations[carina.VolumeCachePolicy] == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: pvc.Spec.VolumeName}}}
+}
+
+// clonePartition copy the data of source raw volume block by block
+func (r *LogicVolumeReconciler) clonePartition(ctx context.Context, lv *carinav1.LogicVolume, sourceVolumeID string) error {
+	source := new(carinav1.LogicVolume)
+	if err := r.Get(ctx, client.ObjectKey{Name: strings.TrimPrefix(sourceVolumeID, carina.VolumePrefix)}, source); err != nil {
+		return err
+	}
+	return r.dm.Partition.CopyPartition(utils.PartitionName(source.Name), source.Spec.DeviceGroup, utils.PartitionName(lv.Name), lv.Spec.DeviceGroup)
+}
+
 // filter logicVolume
 type logicVolumeFilter struct {
 	nodeName string
@@ -0,0 +1,214 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/carina-io/carina"
+	carinav1 "github.com/carina-io/carina/api/v1"
+	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
+	"github.com/carina-io/carina/pkg/csidriver/driver"
+	"github.com/carina-io/carina/utils/log"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	capacityDriverLabel    = "csi.storage.k8s.io/drivername"
+	capacityManagedByLabel = "csi.storage.k8s.io/managed-by"
+	capacityManagedBy      = "carina-controller"
+)
+
+// StorageCapacityReconciler publishes CSIStorageCapacity of each carina storage class on each node,
+// so that the storage capacity tracking of kube-scheduler works without carina-scheduler
+type StorageCapacityReconciler struct {
+	client.Client
+	// Namespace the CSIStorageCapacity objects are created in
+	Namespace string
+}
+
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=csistoragecapacities,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=carina.storage.io,resources=nodestorageresources,verbs=get;list;watch
+
+// Reconcile the request name is the name of NodeStorageResource, which is the node name
+func (r *StorageCapacityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	nodeName := req.Name
+	existing, err := r.nodeCapacities(ctx, nodeName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	nsr := new(carinav1beta1.NodeStorageResource)
+	if err := r.Get(ctx, client.ObjectKey{Name: nodeName}, nsr); err != nil {
+		if !apierrs.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		nsr = nil
+	}
+
+	desired := map[string]bool{}
+	if nsr != nil && nsr.DeletionTimestamp == nil {
+		scList := new(storagev1.StorageClassList)
+		if err := r.List(ctx, scList); err != nil {
+			return ctrl.Result{}, err
+		}
+		lvExclusivityDisks, err := r.lvExclusivityDisks(ctx, nodeName)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		for _, sc := range scList.Items {
+			if sc.Provisioner != carina.CSIPluginName {
+				continue
+			}
+			capacity, maximumVolumeSize, err := driver.StorageClassCapacity(nsr, sc.Parameters, lvExclusivityDisks)
+			if errors.Is(err, driver.ErrCapacityUntracked) {
+				continue
+			}
+			if err != nil {
+				log.Warnf("Skip the capacity of storage class %s: %s", sc.Name, err.Error())
+				continue
+			}
+			if err := r.applyCapacity(ctx, nsr, sc.Name, capacity, maximumVolumeSize); err != nil {
+				return ctrl.Result{}, err
+			}
+			desired[sc.Name] = true
+		}
+	}
+
+	for _, csc := range existing {
+		if desired[csc.StorageClassName] {
+			continue
+		}
+		log.Infof("Delete CSIStorageCapacity %s of node %s storage class %s", csc.Name, nodeName, csc.StorageClassName)
+		if err := r.Delete(ctx, &csc); err != nil && !apierrs.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up Reconciler with Manager.
+func (r *StorageCapacityReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&carinav1beta1.NodeStorageResource{}).
+		Owns(&storagev1.CSIStorageCapacity{}).
+		Watches(&source.Kind{Type: &storagev1.StorageClass{}}, handler.EnqueueRequestsFromMapFunc(r.storageClassToNodes)).
+		Complete(r)
+}
+
+// storageClassToNodes the capacities of all nodes change with the carina storage class
+func (r *StorageCapacityReconciler) storageClassToNodes(obj client.Object) []reconcile.Request {
+	sc, ok := obj.(*storagev1.StorageClass)
+	if !ok || sc.Provisioner != carina.CSIPluginName {
+		return nil
+	}
+	nsrList := new(carinav1beta1.NodeStorageResourceList)
+	if err := r.List(context.Background(), nsrList); err != nil {
+		log.Errorf("Failed to list NodeStorageResource: %s", err.Error())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, nsr := range nsrList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: nsr.Name}})
+	}
+	// the CSIStorageCapacity of the deleted storage class is removed by the reconcile of each node
+	return requests
+}
+
+func (r *StorageCapacityReconciler) applyCapacity(ctx context.Context, nsr *carinav1beta1.NodeStorageResource, scName string, capacity, maximumVolumeSize int64) error {
+	csc := &storagev1.CSIStorageCapacity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      capacityName(nsr.Name, scName),
+			Namespace: r.Namespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, csc, func() error {
+		if csc.Labels == nil {
+			csc.Labels = map[string]string{}
+		}
+		csc.Labels[capacityDriverLabel] = carina.CSIPluginName
+		csc.Labels[capacityManagedByLabel] = capacityManagedBy
+		csc.StorageClassName = scName
+		csc.NodeTopology = &metav1.LabelSelector{
+			MatchLabels: map[string]string{carina.TopologyNodeKey: nsr.Name},
+		}
+		csc.Capacity = resource.NewQuantity(capacity, resource.BinarySI)
+		csc.MaximumVolumeSize = resource.NewQuantity(maximumVolumeSize, resource.BinarySI)
+		// the capacities are removed with NodeStorageResource when the node leaves
+		return controllerutil.SetOwnerReference(nsr, csc, r.Scheme())
+	})
+	if err != nil {
+		return err
+	}
+	if op != controllerutil.OperationResultNone {
+		log.Infof("CSIStorageCapacity %s of node %s storage class %s %s, capacity %d maximumVolumeSize %d", csc.Name, nsr.Name, scName, op, capacity, maximumVolumeSize)
+	}
+	return nil
+}
+
+// nodeCapacities returns the CSIStorageCapacity published by carina for the node
+func (r *StorageCapacityReconciler) nodeCapacities(ctx context.Context, nodeName string) ([]storagev1.CSIStorageCapacity, error) {
+	cscList := new(storagev1.CSIStorageCapacityList)
+	err := r.List(ctx, cscList, client.InNamespace(r.Namespace), client.MatchingLabels{
+		capacityDriverLabel:    carina.CSIPluginName,
+		capacityManagedByLabel: capacityManagedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var capacities []storagev1.CSIStorageCapacity
+	for _, csc := range cscList.Items {
+		if csc.NodeTopology != nil && csc.NodeTopology.MatchLabels[carina.TopologyNodeKey] == nodeName {
+			capacities = append(capacities, csc)
+		}
+	}
+	return capacities, nil
+}
+
+// lvExclusivityDisks the raw disks used by exclusive volumes are not available to other volumes
+func (r *StorageCapacityReconciler) lvExclusivityDisks(ctx context.Context, nodeName string) ([]string, error) {
+	lvList := new(carinav1.LogicVolumeList)
+	if err := r.List(ctx, lvList); err != nil {
+		return nil, err
+	}
+	var disks []string
+	for _, lv := range lvList.Items {
+		if lv.Spec.NodeName == nodeName && lv.Annotations[carina.ExclusivityDisk] == "true" {
+			disks = append(disks, lv.Spec.DeviceGroup)
+		}
+	}
+	return disks, nil
+}
+
+// capacityName the name of CSIStorageCapacity is derived from the node and the storage class, both may be too long for one name
+func capacityName(nodeName, scName string) string {
+	return fmt.Sprintf("carina-%x", sha256.Sum256([]byte(nodeName+"/"+scName)))[:23]
+}
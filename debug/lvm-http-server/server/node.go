@@ -48,7 +48,7 @@ func CreateVolume(c echo.Context) error {
 	vgName := c.FormValue("vg_name")
 	size := c.FormValue("size")
 	req, _ := strconv.ParseUint(size, 10, 64)
-	err := dm.VolumeManager.CreateVolume(lvName, vgName, req, 1)
+	err := dm.VolumeManager.CreateVolume(lvName, vgName, req, 1, 0, "")
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
@@ -9,6 +9,7 @@ function install() {
   fi
 
   kubectl apply -f crd-logicvolume.yaml
+  kubectl apply -f crd-logicsnapshot.yaml
   kubectl apply -f crd-nodestoreresource.yaml
 
   kubectl apply -f csi-controller-rbac.yaml
@@ -48,6 +49,9 @@ function uninstall() {
   if [ `kubectl get lv | wc -l` == 0 ]; then
     kubectl delete -f crd-logicvolume.yaml
   fi
+  if [ `kubectl get lsnap | wc -l` == 0 ]; then
+    kubectl delete -f crd-logicsnapshot.yaml
+  fi
   kubectl delete -f crd-nodestoreresource.yaml
   kubectl delete -f storageclass-lvm.yaml
   kubectl delete -f storageclass-raw.yaml
@@ -37,6 +37,13 @@ const (
 	configPath         = "/etc/carina/"
 	SchedulerBinpack   = "binpack"
 	Schedulerspreadout = "spreadout"
+	// 磁盘选择器变更的执行方式
+	DiskPlanAuto    = "auto"
+	DiskPlanApprove = "approve"
+	DiskPlanDryRun  = "dryrun"
+	// 磁盘SMART检查失败时的处理方式
+	DiskHealthReport        = "report"
+	DiskHealthUnschedulable = "unschedulable"
 )
 
 var TestAssistDiskSelector []string
@@ -63,12 +70,37 @@ type DiskSelectorItem struct {
 	Re        []string `json:"re"`
 	Policy    string   `json:"policy"`
 	NodeLabel string   `json:"nodeLabel"`
+	// OvercommitRatio the ratio of thin volume size to thin pool size, only for lvm policy
+	OvercommitRatio float64 `json:"overcommitRatio"`
+	// 以下为磁盘硬件属性，配置后需与re同时满足
+	// Rotational true匹配机械盘，false匹配ssd及nvme盘
+	Rotational *bool `json:"rotational,omitempty"`
+	// Transport 磁盘传输类型，如nvme、sata、sas
+	Transport []string `json:"transport,omitempty"`
+	// Model、Serial、WWN、Symlinks 均为正则表达式，Symlinks匹配/dev/disk/by-id及/dev/disk/by-path下的链接
+	Model    []string `json:"model,omitempty"`
+	Serial   []string `json:"serial,omitempty"`
+	WWN      []string `json:"wwn,omitempty"`
+	Symlinks []string `json:"symlinks,omitempty"`
+	// MinSize、MaxSize 磁盘容量范围，如100Gi、2Ti
+	MinSize string `json:"minSize,omitempty"`
+	MaxSize string `json:"maxSize,omitempty"`
+}
+
+// ThinOvercommitRatio thin pool overcommit ratio, default 1
+func (d DiskSelectorItem) ThinOvercommitRatio() float64 {
+	if d.OvercommitRatio < 1 {
+		return 1
+	}
+	return d.OvercommitRatio
 }
 
 type Disk struct {
 	DiskSelectors     []DiskSelectorItem `json:"diskSelectors"`
 	DiskScanInterval  int64              `json:"diskScanInterval"`
 	SchedulerStrategy string             `json:"schedulerStrategy"`
+	DiskPlanMode      string             `json:"diskPlanMode"`
+	DiskHealthPolicy  string             `json:"diskHealthPolicy"`
 }
 
 func init() {
@@ -163,6 +195,34 @@ func SchedulerStrategy() string {
 	return schedulerStrategy
 }
 
+// DiskPlanMode 磁盘选择器变更的执行方式，auto直接增删磁盘，approve移出磁盘需批准，dryRun只生成计划，默认为auto
+func DiskPlanMode() string {
+	mode := strings.ToLower(GlobalConfig.GetString("diskPlanMode"))
+	if !utils.ContainsString([]string{DiskPlanAuto, DiskPlanApprove, DiskPlanDryRun}, mode) {
+		mode = DiskPlanAuto
+	}
+	return mode
+}
+
+// DiskHealthPolicy 磁盘SMART检查失败时的处理方式，report只上报健康状态，unschedulable不再分配该磁盘的剩余空间，默认为report
+func DiskHealthPolicy() string {
+	policy := strings.ToLower(GlobalConfig.GetString("diskHealthPolicy"))
+	if policy != DiskHealthUnschedulable {
+		policy = DiskHealthReport
+	}
+	return policy
+}
+
+// IsSchedulerStrategy returns true if the strategy is binpack or spreadout
+func IsSchedulerStrategy(strategy string) bool {
+	return utils.ContainsString([]string{SchedulerBinpack, Schedulerspreadout}, strings.ToLower(strategy))
+}
+
+// TopologyKeys 节点标签如zone、rack，作为拓扑上报，存储类可通过allowedTopologies限定卷所在的机架
+func TopologyKeys() []string {
+	return GlobalConfig.GetStringSlice("topologyKeys")
+}
+
 func RuntimeNamespace() string {
 	namespace := os.Getenv("NAMESPACE")
 	if namespace == "" {
@@ -176,6 +236,8 @@ func validate(disk Disk) error {
 	var diskNameRegexp = regexp.MustCompile("^([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]$")
 	var diskScanRegexp = regexp.MustCompile("(?i)^([0-9]*)?$")
 	var schedulerStrategyRegexp = regexp.MustCompile("(?i)^(spreadout|binpack)?$")
+	var diskPlanModeRegexp = regexp.MustCompile("(?i)^(auto|approve|dryrun)?$")
+	var diskHealthPolicyRegexp = regexp.MustCompile("(?i)^(report|unschedulable)?$")
 
 	if !diskScanRegexp.MatchString(strconv.FormatInt(disk.DiskScanInterval, 10)) {
 		return fmt.Errorf("diskScanInterval must be a number: %s", strconv.FormatInt(disk.DiskScanInterval, 10))
@@ -183,6 +245,12 @@ func validate(disk Disk) error {
 	if !schedulerStrategyRegexp.MatchString(disk.SchedulerStrategy) {
 		return fmt.Errorf("SchedulerStrategy must either binpack or spradout : %s", disk.SchedulerStrategy)
 	}
+	if !diskPlanModeRegexp.MatchString(disk.DiskPlanMode) {
+		return fmt.Errorf("diskPlanMode must be one of auto, approve or dryRun: %s", disk.DiskPlanMode)
+	}
+	if !diskHealthPolicyRegexp.MatchString(disk.DiskHealthPolicy) {
+		return fmt.Errorf("diskHealthPolicy must either report or unschedulable: %s", disk.DiskHealthPolicy)
+	}
 	for _, dc := range disk.DiskSelectors {
 		if len(dc.Name) == 0 {
 			return errors.New("disk name should not be empty")
@@ -190,9 +258,20 @@ func validate(disk Disk) error {
 		if !diskNameRegexp.MatchString(dc.Name) {
 			return fmt.Errorf("disk name should consist of alphanumeric characters, '-', '_' or '.', and should start and end with an alphanumeric character: %s", dc.Name)
 		}
-		if len(dc.Re) == 0 {
+		if len(dc.Re) == 0 && !dc.hasAttributes() {
 			log.Warnf("disk regexp should not be empty: %s", dc.Re)
 		}
+		if dc.hasAttributes() {
+			if strings.ToLower(dc.Policy) == "host" {
+				return fmt.Errorf("disk attributes are not supported by host policy: %s", dc.Name)
+			}
+			if _, err := dc.Matcher(); err != nil {
+				return fmt.Errorf("invalid disk selector %s: %s", dc.Name, err.Error())
+			}
+		}
+		if dc.OvercommitRatio != 0 && dc.OvercommitRatio < 1 {
+			return fmt.Errorf("overcommitRatio should not be less than 1: %s", dc.Name)
+		}
 		if vgGroup[dc.Name] {
 			return fmt.Errorf("duplicate vg group: %s", dc.Name)
 		}
@@ -216,3 +295,13 @@ func GetRawDeviceGroupRe(diskType string) []string {
 	}
 	return nil
 }
+
+// ThinOvercommitRatio thin pool overcommit ratio of the device group, default 1
+func ThinOvercommitRatio(deviceGroup string) float64 {
+	for _, v := range diskConfig.DiskSelectors {
+		if v.Name == deviceGroup {
+			return v.ThinOvercommitRatio()
+		}
+	}
+	return 1
+}
@@ -0,0 +1,154 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/carina-io/carina/pkg/devicemanager/types"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// DiskMatcher 磁盘选择器编译后的匹配条件，设备名称正则与各硬件属性均需满足
+type DiskMatcher struct {
+	re         *regexp.Regexp
+	rotational *bool
+	transport  []string
+	model      *regexp.Regexp
+	serial     *regexp.Regexp
+	wwn        *regexp.Regexp
+	symlinks   *regexp.Regexp
+	minSize    uint64
+	maxSize    uint64
+}
+
+// hasAttributes 是否配置了设备名称以外的硬件属性
+func (d DiskSelectorItem) hasAttributes() bool {
+	return d.Rotational != nil || len(d.Transport) > 0 || len(d.Model) > 0 || len(d.Serial) > 0 ||
+		len(d.WWN) > 0 || len(d.Symlinks) > 0 || d.MinSize != "" || d.MaxSize != ""
+}
+
+// Matcher 编译磁盘选择器，re为空时匹配所有设备名称
+func (d DiskSelectorItem) Matcher() (*DiskMatcher, error) {
+	var err error
+	m := &DiskMatcher{rotational: d.Rotational}
+	if m.re, err = regexp.Compile(strings.Join(d.Re, "|")); err != nil {
+		return nil, fmt.Errorf("disk regex %s error %v", strings.Join(d.Re, "|"), err)
+	}
+	for _, t := range d.Transport {
+		m.transport = append(m.transport, strings.ToLower(t))
+	}
+	for _, attr := range []struct {
+		name string
+		re   []string
+		dst  **regexp.Regexp
+	}{
+		{"model", d.Model, &m.model},
+		{"serial", d.Serial, &m.serial},
+		{"wwn", d.WWN, &m.wwn},
+		{"symlinks", d.Symlinks, &m.symlinks},
+	} {
+		if len(attr.re) == 0 {
+			continue
+		}
+		if *attr.dst, err = regexp.Compile(strings.Join(attr.re, "|")); err != nil {
+			return nil, fmt.Errorf("%s regex %s error %v", attr.name, strings.Join(attr.re, "|"), err)
+		}
+	}
+	if m.minSize, err = parseDiskSize(d.MinSize); err != nil {
+		return nil, fmt.Errorf("minSize %s error %v", d.MinSize, err)
+	}
+	if m.maxSize, err = parseDiskSize(d.MaxSize); err != nil {
+		return nil, fmt.Errorf("maxSize %s error %v", d.MaxSize, err)
+	}
+	if m.maxSize > 0 && m.minSize > m.maxSize {
+		return nil, fmt.Errorf("minSize %s is greater than maxSize %s", d.MinSize, d.MaxSize)
+	}
+	return m, nil
+}
+
+func parseDiskSize(size string) (uint64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, err
+	}
+	if q.Sign() < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return uint64(q.Value()), nil
+}
+
+// NameOnly 只匹配设备名称，无需查询磁盘的硬件属性
+func (m *DiskMatcher) NameOnly() bool {
+	return m.rotational == nil && len(m.transport) == 0 && m.model == nil && m.serial == nil &&
+		m.wwn == nil && m.symlinks == nil && m.minSize == 0 && m.maxSize == 0
+}
+
+// Match 返回磁盘是否满足选择器，不满足时返回原因用于日志
+func (m *DiskMatcher) Match(disk *types.LocalDisk) (bool, string) {
+	if !m.re.MatchString(disk.Name) {
+		return false, fmt.Sprintf("regex:%s", m.re.String())
+	}
+	if m.rotational != nil && (disk.Rotational == "1") != *m.rotational {
+		return false, fmt.Sprintf("rotational:%s", disk.Rotational)
+	}
+	if len(m.transport) > 0 {
+		matched := false
+		for _, t := range m.transport {
+			if strings.ToLower(disk.Transport) == t {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, fmt.Sprintf("transport:%s", disk.Transport)
+		}
+	}
+	if m.model != nil && !m.model.MatchString(disk.Model) {
+		return false, fmt.Sprintf("model:%s", disk.Model)
+	}
+	if m.serial != nil && !m.serial.MatchString(disk.Serial) {
+		return false, fmt.Sprintf("serial:%s", disk.Serial)
+	}
+	if m.wwn != nil && !m.wwn.MatchString(disk.WWN) {
+		return false, fmt.Sprintf("wwn:%s", disk.WWN)
+	}
+	if m.symlinks != nil {
+		matched := false
+		for _, link := range disk.Symlinks {
+			if m.symlinks.MatchString(link) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, fmt.Sprintf("symlinks:%s", strings.Join(disk.Symlinks, ","))
+		}
+	}
+	if m.minSize > 0 && disk.Size < m.minSize {
+		return false, fmt.Sprintf("size:%d", disk.Size)
+	}
+	if m.maxSize > 0 && disk.Size > m.maxSize {
+		return false, fmt.Sprintf("size:%d", disk.Size)
+	}
+	return true, ""
+}
@@ -0,0 +1,57 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/carina-io/carina/pkg/devicemanager/types"
+)
+
+func TestDiskMatcher(t *testing.T) {
+	ssd := false
+	nvme := &types.LocalDisk{Name: "/dev/nvme0n1", Rotational: "0", Transport: "nvme", Model: "Samsung SSD 970 EVO", Serial: "S4EWNX0N", WWN: "eui.0025385", Size: 500 << 30,
+		Symlinks: []string{"/dev/disk/by-id/nvme-Samsung_SSD_970_EVO_S4EWNX0N", "/dev/disk/by-path/pci-0000:01:00.0-nvme-1"}}
+	hdd := &types.LocalDisk{Name: "/dev/sdb", Rotational: "1", Transport: "sata", Model: "ST4000DM004", Serial: "ZFN0", WWN: "0x5000c500", Size: 4 << 40}
+
+	tests := []struct {
+		name     string
+		selector DiskSelectorItem
+		disk     *types.LocalDisk
+		matched  bool
+	}{
+		{"re only", DiskSelectorItem{Re: []string{"sdb"}}, hdd, true},
+		{"empty re", DiskSelectorItem{}, nvme, true},
+		{"re mismatch", DiskSelectorItem{Re: []string{"sdc"}}, hdd, false},
+		{"rotational", DiskSelectorItem{Rotational: &ssd}, hdd, false},
+		{"transport", DiskSelectorItem{Transport: []string{"SAS", "NVMe"}}, nvme, true},
+		{"transport mismatch", DiskSelectorItem{Transport: []string{"sas"}}, hdd, false},
+		{"model and re", DiskSelectorItem{Re: []string{"nvme"}, Model: []string{"^Samsung"}}, nvme, true},
+		{"serial", DiskSelectorItem{Serial: []string{"^S4"}}, hdd, false},
+		{"wwn", DiskSelectorItem{WWN: []string{"^0x5000"}}, hdd, true},
+		{"symlinks", DiskSelectorItem{Symlinks: []string{"by-path/pci-0000:01:00.0"}}, nvme, true},
+		{"symlinks none", DiskSelectorItem{Symlinks: []string{"by-id"}}, hdd, false},
+		{"size range", DiskSelectorItem{MinSize: "100Gi", MaxSize: "1Ti"}, nvme, true},
+		{"size too large", DiskSelectorItem{MinSize: "100Gi", MaxSize: "1Ti"}, hdd, false},
+	}
+	for _, tt := range tests {
+		m, err := tt.selector.Matcher()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if matched, reason := m.Match(tt.disk); matched != tt.matched {
+			t.Errorf("%s: expected %v, got %v %s", tt.name, tt.matched, matched, reason)
+		}
+	}
+
+	if m, _ := (DiskSelectorItem{Re: []string{"sd"}}).Matcher(); !m.NameOnly() {
+		t.Error("expected name only matcher")
+	}
+	for _, selector := range []DiskSelectorItem{
+		{Model: []string{"("}},
+		{MinSize: "abc"},
+		{MinSize: "2Ti", MaxSize: "1Ti"},
+	} {
+		if _, err := selector.Matcher(); err == nil {
+			t.Errorf("expected error for selector %+v", selector)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/carina-io/carina"
+	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
+	"github.com/carina-io/carina/pkg/csidriver/driver/util"
+	"github.com/carina-io/carina/utils"
+)
+
+// ErrCapacityUntracked is returned for the storage class of host volumes, which are not accounted in NodeStorageResource
+var ErrCapacityUntracked = errors.New("capacity of host volume is not tracked")
+
+// StorageClassCapacity computes the capacity of the storage class on the node from the allocatable of NodeStorageResource,
+// the maximum volume size is the largest volume fits in one device group. Both are in bytes.
+// The pvs of striped and raid volumes are not considered, the volume may still fail to be created on the node.
+func StorageClassCapacity(nsr *carinav1beta1.NodeStorageResource, params map[string]string, lvExclusivityDisks []string) (int64, int64, error) {
+	deviceGroup := util.GetDeviceGroup(params[carina.DeviceDiskKey])
+	if util.CheckHostDeviceGroup(deviceGroup) {
+		return 0, 0, ErrCapacityUntracked
+	}
+	volumeType := carina.LvmVolumeType
+	if util.CheckRawDeviceGroup(deviceGroup) {
+		volumeType = carina.RawVolumeType
+	}
+	layout, err := getVolumeLayout(params, volumeType)
+	if err != nil {
+		return 0, 0, err
+	}
+	// bcache and lvm cache volume, the capacity of the cache device group is not accounted
+	if deviceGroup == "" {
+		deviceGroup = strings.ToLower(params[carina.VolumeBackendDiskType])
+	}
+	exclusivityDisk := volumeType == carina.RawVolumeType && params[carina.ExclusivityDisk] == "true"
+
+	prefix := carina.DeviceCapacityKeyPrefix
+	if layout.Thin {
+		prefix = carina.ThinCapacityKeyPrefix
+	}
+	var capacity, maximumVolumeSize int64
+	for groupDetail, allocatable := range nsr.Status.Allocatable {
+		if !strings.HasPrefix(groupDetail, prefix) {
+			continue
+		}
+		group := strings.TrimPrefix(groupDetail, prefix)
+		var sizeGb int64
+		if volumeType == carina.RawVolumeType {
+			if strings.Split(group, "/")[0] != deviceGroup || utils.ContainsString(lvExclusivityDisks, group) {
+				continue
+			}
+			if exclusivityDisk && diskPartitioned(nsr, group) {
+				continue
+			}
+			sizeGb = allocatable.Value()
+		} else {
+			// raw disks are accounted as group/disk
+			if strings.Contains(group, "/") || (deviceGroup != "" && group != deviceGroup) {
+				continue
+			}
+			// the largest request whose mirrors and cache fit in the vg
+			sizeGb = allocatable.Value() * 100 / (layout.Copies()*100 + int64(layout.CacheRatio))
+		}
+		capacity += sizeGb
+		if sizeGb > maximumVolumeSize {
+			maximumVolumeSize = sizeGb
+		}
+	}
+	return capacity << 30, maximumVolumeSize << 30, nil
+}
+
+// diskPartitioned an exclusive raw volume can only use the disk without partitions
+func diskPartitioned(nsr *carinav1beta1.NodeStorageResource, group string) bool {
+	for _, disk := range nsr.Status.Disks {
+		if strings.HasSuffix(group, "/"+disk.Name) && len(disk.Partitions) > 1 {
+			return true
+		}
+	}
+	return false
+}
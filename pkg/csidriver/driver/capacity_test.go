@@ -0,0 +1,64 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/carina-io/carina"
+	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestStorageClassCapacity(t *testing.T) {
+	nsr := &carinav1beta1.NodeStorageResource{
+		Status: carinav1beta1.NodeStorageResourceStatus{
+			Allocatable: map[string]resource.Quantity{
+				carina.DeviceCapacityKeyPrefix + "carina-vg-ssd": resource.MustParse("100"),
+				carina.DeviceCapacityKeyPrefix + "carina-vg-hdd": resource.MustParse("300"),
+				carina.ThinCapacityKeyPrefix + "carina-vg-ssd":   resource.MustParse("200"),
+			},
+		},
+	}
+	table := []struct {
+		params            map[string]string
+		capacity          int64
+		maximumVolumeSize int64
+		err               bool
+	}{
+		{params: map[string]string{carina.DeviceDiskKey: "carina-vg-ssd"}, capacity: 100, maximumVolumeSize: 100},
+		{params: map[string]string{}, capacity: 400, maximumVolumeSize: 300},
+		{params: map[string]string{carina.DeviceDiskKey: "carina-vg-ssd", carina.VolumeLvmType: carina.LvmTypeThin}, capacity: 200, maximumVolumeSize: 200},
+		{params: map[string]string{carina.DeviceDiskKey: "carina-vg-hdd", carina.VolumeLvmType: carina.LvmTypeRaid1, carina.VolumeLvmMirrors: "2"}, capacity: 100, maximumVolumeSize: 100},
+		{params: map[string]string{carina.VolumeBackendDiskType: "carina-vg-hdd", carina.VolumeCacheDiskType: "carina-vg-hdd", carina.VolumeCacheType: carina.CacheTypeDmCache, carina.VolumeCacheDiskRatio: "50"}, capacity: 200, maximumVolumeSize: 200},
+		{params: map[string]string{carina.DeviceDiskKey: "carina-vg-nvme"}, capacity: 0, maximumVolumeSize: 0},
+		{params: map[string]string{carina.DeviceDiskKey: "carina-vg-ssd", carina.VolumeLvmType: "raid5"}, err: true},
+	}
+
+	a := assert.New(t)
+	for _, e := range table {
+		capacity, maximumVolumeSize, err := StorageClassCapacity(nsr, e.params, nil)
+		if e.err {
+			a.Error(err)
+			continue
+		}
+		a.NoError(err)
+		a.Equal(e.capacity<<30, capacity)
+		a.Equal(e.maximumVolumeSize<<30, maximumVolumeSize)
+	}
+}
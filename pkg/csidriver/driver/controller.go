@@ -22,11 +22,15 @@ import (
 	"fmt"
 	"github.com/carina-io/carina"
 	"github.com/carina-io/carina/pkg/csidriver/driver/util"
-	"k8s.io/apimachinery/pkg/api/resource"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	carinav1 "github.com/carina-io/carina/api/v1"
+
+	"github.com/carina-io/carina/pkg/configuration"
 	"github.com/carina-io/carina/pkg/csidriver/driver/k8s"
 	"github.com/carina-io/carina/utils"
 	"github.com/carina-io/carina/utils/log"
@@ -35,20 +39,25 @@ import (
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// stripeSizeRegexp the stripe size of lvcreate -I, in KiB by default
+var stripeSizeRegexp = regexp.MustCompile("(?i)^[1-9][0-9]*[km]?$")
+
 // NewControllerService returns a new ControllerServer.
-func NewControllerService(lvService *k8s.LogicVolumeService, nodeService *k8s.NodeService) csi.ControllerServer {
-	return &controllerService{lvService: lvService, nodeService: nodeService, mutex: mutx.NewGlobalLocks()}
+func NewControllerService(lvService *k8s.LogicVolumeService, nodeService *k8s.NodeService, snapshotService *k8s.LogicSnapshotService) csi.ControllerServer {
+	return &controllerService{lvService: lvService, nodeService: nodeService, snapshotService: snapshotService, mutex: mutx.NewGlobalLocks()}
 }
 
 type controllerService struct {
 	csi.UnimplementedControllerServer
 	mutex *mutx.GlobalLocks
 
-	lvService   *k8s.LogicVolumeService
-	nodeService *k8s.NodeService
+	lvService       *k8s.LogicVolumeService
+	nodeService     *k8s.NodeService
+	snapshotService *k8s.LogicSnapshotService
 }
 
 func (s controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
@@ -76,9 +85,6 @@ func (s controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolu
 		" content_source ", source,
 		" accessibility_requirements ", req.GetAccessibilityRequirements().String())
 
-	if source != nil {
-		return nil, status.Error(codes.InvalidArgument, "volume_content_source not supported")
-	}
 	if capabilities == nil {
 		return nil, status.Error(codes.InvalidArgument, "no volume capabilities are provided")
 	}
@@ -105,8 +111,8 @@ func (s controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolu
 		if mode := capability.GetAccessMode(); mode != nil {
 			modeName := csi.VolumeCapability_AccessMode_Mode_name[int32(mode.GetMode())]
 			log.Info("CreateVolume specifies volume capability ", "access_mode ", modeName)
-			// we only support SINGLE_NODE_WRITER
-			if mode.GetMode() != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER {
+			// local volumes can only be written by the pods on one node
+			if !isSupportedAccessMode(mode.GetMode()) {
 				return nil, status.Errorf(codes.InvalidArgument, "unsupported access mode: %s", modeName)
 			}
 		}
@@ -124,6 +130,16 @@ func (s controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolu
 		return nil, status.Errorf(codes.Internal, "can not find pvc %s %s", namespace, pvcName)
 	}
 
+	if source != nil {
+		if snapshotSource := source.GetSnapshot(); snapshotSource != nil {
+			return s.createVolumeFromSnapshot(ctx, req, snapshotSource.GetSnapshotId(), nodeName, requestGb)
+		}
+		if volumeSource := source.GetVolume(); volumeSource != nil {
+			return s.createVolumeFromVolume(ctx, req, volumeSource.GetVolumeId(), nodeName, requestGb)
+		}
+		return nil, status.Error(codes.InvalidArgument, "unsupported volume_content_source")
+	}
+
 	// default LvmVolumeType
 	volumeType := carina.LvmVolumeType
 	devicePath := fmt.Sprintf("/dev/%s/volume-%s", deviceGroup, pvName)
@@ -143,15 +159,38 @@ func (s controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolu
 		exclusivityDisk = true
 	}
 
+	layout, err := getVolumeLayout(req.GetParameters(), volumeType)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err = checkEncryption(req.GetParameters(), volumeType); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	strategy, err := getSchedulerStrategy(req.GetParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	pvcAnnotations, err := s.nodeService.ClaimAnnotations(ctx, namespace, pvcName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "can not find pvc %s %s", namespace, pvcName)
+	}
+	if layout.AntiAffinity, err = getDiskAntiAffinity(req.GetParameters(), pvcAnnotations, namespace, volumeType, layout); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	// if bcache type, need create two lvm volume
 	cacheDiskRatio := req.GetParameters()[carina.VolumeCacheDiskRatio]
-	if cacheDiskRatio != "" && cacheDiskRatio != "0" {
-		return s.CreateBcacheVolume(ctx, req, nodeName, requestGb)
+	if cacheDiskRatio != "" && cacheDiskRatio != "0" && layout.CacheType == "" {
+		return s.CreateBcacheVolume(ctx, req, nodeName, requestGb, strategy)
+	}
+	// lvm cache volume, the cache lv is created in the vg of the backend device group
+	if layout.CacheType != "" {
+		deviceGroup = strings.ToLower(req.GetParameters()[carina.VolumeBackendDiskType])
 	}
 
 	// sc parameter未设置device group, raw disk's deviceGroup need handle
 	if nodeName != "" && volumeType != carina.HostVolumeType {
-		deviceGroup, err = s.nodeService.SelectDeviceGroup(ctx, requestGb, exclusivityDisk, nodeName, volumeType, deviceGroup)
+		deviceGroup, err = s.nodeService.SelectDeviceGroup(ctx, requestGb, exclusivityDisk, nodeName, volumeType, deviceGroup, layout, strategy)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to get device group %v", err)
 		}
@@ -167,7 +206,7 @@ func (s controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolu
 		// - https://github.com/container-storage-interface/spec/blob/release-1.1/spec.md#createvolume
 		// - https://github.com/kubernetes-csi/csi-test/blob/6738ab2206eac88874f0a3ede59b40f680f59f43/pkg/sanity/controller.go#L404-L428
 		log.Info("start to decide node")
-		nodeName, deviceGroup, err = s.nodeService.SelectNode(ctx, requestGb, volumeType, deviceGroup, req.GetAccessibilityRequirements(), exclusivityDisk)
+		nodeName, deviceGroup, err = s.nodeService.SelectNode(ctx, requestGb, volumeType, deviceGroup, req.GetAccessibilityRequirements(), exclusivityDisk, layout, strategy)
 		log.Info("nodeName:", nodeName, " deviceGroup:", deviceGroup)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to select node,  err: %v", err)
@@ -189,7 +228,17 @@ func (s controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolu
 	if volumeType == carina.RawVolumeType {
 		annotation[carina.ExclusivityDisk] = fmt.Sprint(exclusivityDisk)
 	}
-	volumeID, deviceMajor, deviceMinor, err := s.lvService.CreateVolume(ctx, namespace, pvcName, nodeName, deviceGroup, pvName, requestGb, metav1.OwnerReference{}, annotation)
+	if layout.Thin {
+		annotation[carina.VolumeLvmType] = carina.LvmTypeThin
+	}
+	if req.GetParameters()[carina.VolumeEncrypted] == "true" {
+		annotation[carina.VolumeEncrypted] = "true"
+	}
+	if layout.AntiAffinity.Policy != "" {
+		annotation[carina.VolumeDiskAntiAffinity] = layout.AntiAffinity.Policy
+		annotation[carina.VolumeDiskAntiAffinityKey] = layout.AntiAffinity.Key
+	}
+	volumeID, deviceMajor, deviceMinor, err := s.lvService.CreateVolume(ctx, namespace, pvcName, nodeName, deviceGroup, pvName, requestGb, layout, metav1.OwnerReference{}, annotation)
 	if err != nil {
 		_, ok := status.FromError(err)
 		if !ok {
@@ -221,13 +270,193 @@ func (s controllerService) CreateVolume(ctx context.Context, req *csi.CreateVolu
 	}, nil
 }
 
+// createVolumeFromSnapshot the volume is created on the node and device group of the snapshot
+func (s controllerService) createVolumeFromSnapshot(ctx context.Context, req *csi.CreateVolumeRequest, snapshotID, nodeName string, requestGb int64) (*csi.CreateVolumeResponse, error) {
+	pvName := strings.ToLower(req.GetName())
+	pvcName := req.Parameters["csi.storage.k8s.io/pvc/name"]
+	namespace := req.Parameters["csi.storage.k8s.io/pvc/namespace"]
+
+	ls, err := s.snapshotService.GetLogicSnapshotBySnapshotId(ctx, snapshotID)
+	if err != nil {
+		if err == k8s.ErrSnapshotNotFound {
+			return nil, status.Errorf(codes.NotFound, "LogicSnapshot for snapshot id %s is not found", snapshotID)
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ls.Status.ReadyToUse {
+		return nil, status.Errorf(codes.Unavailable, "snapshot %s is not ready to use", snapshotID)
+	}
+	if requestGb<<30 < ls.Spec.Size.Value() {
+		return nil, status.Errorf(codes.OutOfRange, "requested size %dGi is smaller than snapshot %s size %s", requestGb, snapshotID, ls.Spec.Size.String())
+	}
+	// the selected node must be the node of snapshot, otherwise reschedule
+	if nodeName != "" && nodeName != ls.Spec.NodeName {
+		return nil, status.Errorf(codes.ResourceExhausted, "snapshot %s is located on node %s, not on selected node %s", snapshotID, ls.Spec.NodeName, nodeName)
+	}
+	nodeName = ls.Spec.NodeName
+	deviceGroup := ls.Spec.DeviceGroup
+
+	source, err := s.lvService.GetLogicVolumeByVolumeId(ctx, ls.Spec.SourceVolumeID)
+	if err != nil {
+		if err == k8s.ErrVolumeNotFound {
+			return nil, status.Errorf(codes.NotFound, "LogicalVolume for volume id %s of snapshot %s is not found", ls.Spec.SourceVolumeID, snapshotID)
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	log.Infof("CreateVolume: Starting to restore volume %s from snapshot %s with: pvcName(%s), pvcNameSpace(%s), nodeSelected(%s), storageSelected(%s)", pvName, snapshotID, pvcName, namespace, nodeName, deviceGroup)
+
+	annotation := map[string]string{
+		carina.VolumeManagerType:    carina.LvmVolumeType,
+		carina.VolumeSourceSnapshot: snapshotID,
+	}
+	layout := sourceLayout(source, annotation)
+	volumeID, deviceMajor, deviceMinor, err := s.lvService.CreateVolume(ctx, namespace, pvcName, nodeName, deviceGroup, pvName, requestGb, layout, metav1.OwnerReference{}, annotation)
+	if err != nil {
+		_, ok := status.FromError(err)
+		if !ok {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return nil, err
+	}
+	log.Infof("CreateVolume: Successful restore pvcName %s node %s deviceGroup %s pvName %s size %d from snapshot %s", pvcName, nodeName, deviceGroup, pvName, requestGb, snapshotID)
+
+	resp := newCreateVolumeResponse(req, volumeID, nodeName, deviceGroup, deviceMajor, deviceMinor, requestGb, annotation)
+	resp.Volume.VolumeContext[carina.VolumeSourceSnapshot] = snapshotID
+	return resp, nil
+}
+
+// createVolumeFromVolume the volume is cloned on the node of the source volume
+func (s controllerService) createVolumeFromVolume(ctx context.Context, req *csi.CreateVolumeRequest, sourceVolumeID, nodeName string, requestGb int64) (*csi.CreateVolumeResponse, error) {
+	pvName := strings.ToLower(req.GetName())
+	pvcName := req.Parameters["csi.storage.k8s.io/pvc/name"]
+	namespace := req.Parameters["csi.storage.k8s.io/pvc/namespace"]
+
+	source, err := s.lvService.GetLogicVolumeByVolumeId(ctx, sourceVolumeID)
+	if err != nil {
+		if err == k8s.ErrVolumeNotFound {
+			return nil, status.Errorf(codes.NotFound, "LogicalVolume for volume id %s is not found", sourceVolumeID)
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	volumeType := source.Annotations[carina.VolumeManagerType]
+	if volumeType != carina.LvmVolumeType && volumeType != carina.RawVolumeType {
+		return nil, status.Errorf(codes.InvalidArgument, "volume %s type %s does not support clone", sourceVolumeID, volumeType)
+	}
+	if cacheDiskRatio := source.Annotations[carina.VolumeCacheDiskRatio]; cacheDiskRatio != "" && cacheDiskRatio != "0" {
+		return nil, status.Errorf(codes.InvalidArgument, "bcache volume %s does not support clone", sourceVolumeID)
+	}
+	if requestGb<<30 < source.Spec.Size.Value() {
+		return nil, status.Errorf(codes.OutOfRange, "requested size %dGi is smaller than volume %s size %s", requestGb, sourceVolumeID, source.Spec.Size.String())
+	}
+	// the selected node must be the node of source volume, otherwise reschedule
+	if nodeName != "" && nodeName != source.Spec.NodeName {
+		return nil, status.Errorf(codes.ResourceExhausted, "volume %s is located on node %s, not on selected node %s", sourceVolumeID, source.Spec.NodeName, nodeName)
+	}
+	nodeName = source.Spec.NodeName
+
+	annotation := map[string]string{
+		carina.VolumeManagerType:  volumeType,
+		carina.VolumeSourceVolume: sourceVolumeID,
+	}
+	// lvm clone is based on snapshot, so it must be in the same device group
+	deviceGroup := source.Spec.DeviceGroup
+	if volumeType == carina.RawVolumeType {
+		exclusivityDisk := source.Annotations[carina.ExclusivityDisk] == "true"
+		annotation[carina.ExclusivityDisk] = fmt.Sprint(exclusivityDisk)
+		strategy, err := getSchedulerStrategy(req.GetParameters())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		deviceGroup, err = s.nodeService.SelectDeviceGroup(ctx, requestGb, exclusivityDisk, nodeName, volumeType, strings.Split(source.Spec.DeviceGroup, "/")[0], k8s.VolumeLayout{}, strategy)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to get device group %v", err)
+		}
+		if deviceGroup == "" {
+			return nil, status.Errorf(codes.ResourceExhausted, "can not find any device group on node %s", nodeName)
+		}
+	}
+
+	log.Infof("CreateVolume: Starting to clone volume %s from volume %s with: pvcName(%s), pvcNameSpace(%s), nodeSelected(%s), storageSelected(%s)", pvName, sourceVolumeID, pvcName, namespace, nodeName, deviceGroup)
+
+	layout := sourceLayout(source, annotation)
+	volumeID, deviceMajor, deviceMinor, err := s.lvService.CreateVolume(ctx, namespace, pvcName, nodeName, deviceGroup, pvName, requestGb, layout, metav1.OwnerReference{}, annotation)
+	if err != nil {
+		_, ok := status.FromError(err)
+		if !ok {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return nil, err
+	}
+	log.Infof("CreateVolume: Successful clone pvcName %s node %s deviceGroup %s pvName %s size %d from volume %s", pvcName, nodeName, deviceGroup, pvName, requestGb, sourceVolumeID)
+
+	resp := newCreateVolumeResponse(req, volumeID, nodeName, deviceGroup, deviceMajor, deviceMinor, requestGb, annotation)
+	resp.Volume.VolumeContext[carina.VolumeSourceVolume] = sourceVolumeID
+	return resp, nil
+}
+
+// sourceLayout the restored and cloned volumes keep the thin, raid, stripe and encryption layout of the source volume,
+// so that expansion and the node take the same path as for the source
+func sourceLayout(source *carinav1.LogicVolume, annotation map[string]string) k8s.VolumeLayout {
+	for _, key := range []string{carina.VolumeLvmType, carina.VolumeEncrypted} {
+		if value, ok := source.Annotations[key]; ok {
+			annotation[key] = value
+		}
+	}
+	return k8s.VolumeLayout{
+		Thin:       source.Annotations[carina.VolumeLvmType] == carina.LvmTypeThin,
+		Stripes:    source.Spec.Stripes,
+		StripeSize: source.Spec.StripeSize,
+		RaidType:   source.Spec.RaidType,
+		Mirrors:    source.Spec.Mirrors,
+	}
+}
+
+// newCreateVolumeResponse the encryption of the volume follows the source volume instead of the storage class
+func newCreateVolumeResponse(req *csi.CreateVolumeRequest, volumeID, nodeName, deviceGroup string, deviceMajor, deviceMinor uint32, requestGb int64, annotation map[string]string) *csi.CreateVolumeResponse {
+	volumeContext := req.GetParameters()
+	if annotation[carina.VolumeEncrypted] == "true" {
+		volumeContext[carina.VolumeEncrypted] = "true"
+	} else {
+		delete(volumeContext, carina.VolumeEncrypted)
+	}
+	volumeContext[carina.DeviceDiskKey] = deviceGroup
+	volumeContext[carina.VolumeDevicePath] = fmt.Sprintf("/dev/%s/volume-%s", deviceGroup, strings.ToLower(req.GetName()))
+	volumeContext[carina.VolumeDeviceNode] = nodeName
+	volumeContext[carina.VolumeDeviceMajor] = fmt.Sprintf("%d", deviceMajor)
+	volumeContext[carina.VolumeDeviceMinor] = fmt.Sprintf("%d", deviceMinor)
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			CapacityBytes: requestGb << 30,
+			VolumeId:      volumeID,
+			VolumeContext: volumeContext,
+			ContentSource: req.GetVolumeContentSource(),
+			AccessibleTopology: []*csi.Topology{
+				{
+					Segments: map[string]string{carina.TopologyNodeKey: nodeName},
+				},
+			},
+		},
+	}
+}
+
 func (s controllerService) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
 	log.Info("DeleteVolume called volume_id ", req.GetVolumeId(), " num_secrets ", len(req.GetSecrets()))
 	if len(req.GetVolumeId()) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "volume_id is not provided")
 	}
 
-	err := s.lvService.DeleteVolume(ctx, req.GetVolumeId())
+	snapshots, err := s.snapshotService.GetLogicSnapshotsBySourceVolumeId(ctx, req.GetVolumeId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if len(snapshots) > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "volume %s still has %d snapshots", req.GetVolumeId(), len(snapshots))
+	}
+
+	err = s.lvService.DeleteVolume(ctx, req.GetVolumeId())
 	if err != nil {
 		log.Error(err, " DeleteVolume failed volume_id ", req.GetVolumeId())
 		_, ok := status.FromError(err)
@@ -263,8 +492,16 @@ func (s controllerService) ValidateVolumeCapabilities(ctx context.Context, req *
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	for _, capability := range req.GetVolumeCapabilities() {
+		if mode := capability.GetAccessMode(); mode != nil && !isSupportedAccessMode(mode.GetMode()) {
+			return &csi.ValidateVolumeCapabilitiesResponse{
+				Message: fmt.Sprintf("unsupported access mode: %s", csi.VolumeCapability_AccessMode_Mode_name[int32(mode.GetMode())]),
+			}, nil
+		}
+	}
+
 	// Since Carina does not provide means to pre-provision volumes,
-	// any existing volume is valid.
+	// any existing volume with supported access mode is valid.
 	return &csi.ValidateVolumeCapabilitiesResponse{
 		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
 			VolumeContext:      req.GetVolumeContext(),
@@ -312,6 +549,13 @@ func (s controllerService) ControllerGetCapabilities(context.Context, *csi.Contr
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
 		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+		csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
 	}
 
 	csiCaps := make([]*csi.ControllerServiceCapability, len(capabilities))
@@ -383,27 +627,33 @@ func (s controllerService) ControllerExpandVolume(ctx context.Context, req *csi.
 	}
 
 	if util.CheckHostDeviceGroup(lv.Spec.DeviceGroup) {
-		// 本地目录的扩容直接controller返回
-		err = s.lvService.UpdateLogicVolumeSpecSize(ctx, volumeID, resource.NewQuantity(requestGb<<30, resource.BinarySI))
-		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
-		}
-		err = s.lvService.UpdateLogicVolumeCurrentSize(ctx, volumeID, resource.NewQuantity(requestGb<<30, resource.BinarySI))
+		// 本地目录的容量由carina-node更新project quota限制
+		err = s.lvService.ExpandVolume(ctx, volumeID, requestGb)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			_, ok := status.FromError(err)
+			if !ok {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			return nil, err
 		}
 		return &csi.ControllerExpandVolumeResponse{
-			CapacityBytes:         currentGb << 30,
+			CapacityBytes:         requestGb << 30,
 			NodeExpansionRequired: true,
 		}, nil
 	}
 
-	capacity, err := s.nodeService.GetCapacityByNodeName(ctx, lv.Spec.NodeName, lv.Spec.DeviceGroup)
+	capacity, err := s.nodeService.GetCapacityByNodeName(ctx, lv.Spec.NodeName, lv.Spec.DeviceGroup, lv.Annotations[carina.VolumeLvmType] == carina.LvmTypeThin)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	if capacity < (requestGb - currentGb) {
+	// raid volume consumes the space of each mirror, lvm cache volume consumes the space of the cache
+	copies := int64(lv.Spec.Mirrors) + 1
+	if lv.Spec.RaidType == "" {
+		copies = 1
+	}
+	cacheGb := utils.CacheGb(requestGb, lv.Spec.CacheRatio) - utils.CacheGb(currentGb, lv.Spec.CacheRatio)
+	if capacity < (requestGb-currentGb)*copies+cacheGb {
 		return nil, status.Error(codes.Internal, "not enough space")
 	}
 
@@ -449,6 +699,416 @@ func (s controllerService) ControllerExpandVolume(ctx context.Context, req *csi.
 	}, nil
 }
 
+func (s controllerService) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	log.Info("CreateSnapshot called name ", req.GetName(), " source_volume_id ", req.GetSourceVolumeId(), " parameters ", req.GetParameters())
+
+	snapName := strings.ToLower(req.GetName())
+	if snapName == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid name")
+	}
+	sourceVolumeID := req.GetSourceVolumeId()
+	if sourceVolumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "source_volume_id is not provided")
+	}
+
+	if acquired := s.mutex.TryAcquire(snapName); !acquired {
+		log.Warnf("an operation with the given snapshot %s already exists", snapName)
+		return nil, status.Errorf(codes.Aborted, "an operation with the given snapshot %s already exists", snapName)
+	}
+	defer s.mutex.Release(snapName)
+
+	lv, err := s.lvService.GetLogicVolumeByVolumeId(ctx, sourceVolumeID)
+	if err != nil {
+		if err == k8s.ErrVolumeNotFound {
+			return nil, status.Errorf(codes.NotFound, "LogicalVolume for volume id %s is not found", sourceVolumeID)
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// only lvm volume support snapshot, bcache volume consists of two lvm volumes
+	if lv.Annotations[carina.VolumeManagerType] != carina.LvmVolumeType {
+		return nil, status.Errorf(codes.InvalidArgument, "volume %s type %s does not support snapshot", sourceVolumeID, lv.Annotations[carina.VolumeManagerType])
+	}
+	if cacheDiskRatio := lv.Annotations[carina.VolumeCacheDiskRatio]; cacheDiskRatio != "" && cacheDiskRatio != "0" {
+		return nil, status.Errorf(codes.InvalidArgument, "bcache volume %s does not support snapshot", sourceVolumeID)
+	}
+
+	ls, err := s.snapshotService.CreateSnapshot(ctx, snapName, lv)
+	if err != nil {
+		_, ok := status.FromError(err)
+		if !ok {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return nil, err
+	}
+	log.Infof("CreateSnapshot: Successful create snapshot %s source %s node %s deviceGroup %s", ls.Status.SnapshotID, sourceVolumeID, ls.Spec.NodeName, ls.Spec.DeviceGroup)
+
+	return &csi.CreateSnapshotResponse{
+		Snapshot: convertSnapshot(ls),
+	}, nil
+}
+
+func (s controllerService) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	log.Info("DeleteSnapshot called snapshot_id ", req.GetSnapshotId(), " num_secrets ", len(req.GetSecrets()))
+	snapshotID := req.GetSnapshotId()
+	if len(snapshotID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "snapshot_id is not provided")
+	}
+
+	if acquired := s.mutex.TryAcquire(snapshotID); !acquired {
+		log.Warnf("an operation with the given snapshot ID %s already exists", snapshotID)
+		return nil, status.Errorf(codes.Aborted, "an operation with the given snapshot ID %s already exists", snapshotID)
+	}
+	defer s.mutex.Release(snapshotID)
+
+	err := s.snapshotService.DeleteSnapshot(ctx, snapshotID)
+	if err != nil {
+		log.Error(err, " DeleteSnapshot failed snapshot_id ", snapshotID)
+		_, ok := status.FromError(err)
+		if !ok {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return nil, err
+	}
+
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+func (s controllerService) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	log.Info("ListSnapshots called snapshot_id ", req.GetSnapshotId(), " source_volume_id ", req.GetSourceVolumeId(),
+		" max_entries ", req.GetMaxEntries(), " starting_token ", req.GetStartingToken())
+
+	snapshots, err := s.snapshotService.ListSnapshots(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var entries []*csi.ListSnapshotsResponse_Entry
+	for i := range snapshots {
+		ls := &snapshots[i]
+		if req.GetSnapshotId() != "" && ls.Status.SnapshotID != req.GetSnapshotId() {
+			continue
+		}
+		if req.GetSourceVolumeId() != "" && ls.Spec.SourceVolumeID != req.GetSourceVolumeId() {
+			continue
+		}
+		entries = append(entries, &csi.ListSnapshotsResponse_Entry{Snapshot: convertSnapshot(ls)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Snapshot.SnapshotId < entries[j].Snapshot.SnapshotId
+	})
+
+	start := 0
+	if req.GetStartingToken() != "" {
+		start, err = strconv.Atoi(req.GetStartingToken())
+		if err != nil || start < 0 || start > len(entries) {
+			return nil, status.Errorf(codes.Aborted, "invalid starting_token %s", req.GetStartingToken())
+		}
+	}
+	end := len(entries)
+	nextToken := ""
+	if req.GetMaxEntries() > 0 && start+int(req.GetMaxEntries()) < end {
+		end = start + int(req.GetMaxEntries())
+		nextToken = strconv.Itoa(end)
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries[start:end],
+		NextToken: nextToken,
+	}, nil
+}
+
+func (s controllerService) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	log.Info("ControllerGetVolume called volume_id ", req.GetVolumeId())
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "volume_id is not provided")
+	}
+
+	lv, err := s.lvService.GetLogicVolumeByVolumeId(ctx, req.GetVolumeId())
+	if err != nil {
+		if err == k8s.ErrVolumeNotFound {
+			return nil, status.Errorf(codes.NotFound, "LogicalVolume for volume id %s is not found", req.GetVolumeId())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: convertVolume(lv),
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: convertVolumeCondition(lv),
+		},
+	}, nil
+}
+
+func (s controllerService) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	log.Info("ListVolumes called max_entries ", req.GetMaxEntries(), " starting_token ", req.GetStartingToken())
+
+	lvs, err := s.lvService.ListVolumes(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var entries []*csi.ListVolumesResponse_Entry
+	for i := range lvs {
+		lv := &lvs[i]
+		entries = append(entries, &csi.ListVolumesResponse_Entry{
+			Volume: convertVolume(lv),
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				VolumeCondition: convertVolumeCondition(lv),
+			},
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Volume.VolumeId < entries[j].Volume.VolumeId
+	})
+
+	start := 0
+	if req.GetStartingToken() != "" {
+		start, err = strconv.Atoi(req.GetStartingToken())
+		if err != nil || start < 0 || start > len(entries) {
+			return nil, status.Errorf(codes.Aborted, "invalid starting_token %s", req.GetStartingToken())
+		}
+	}
+	end := len(entries)
+	nextToken := ""
+	if req.GetMaxEntries() > 0 && start+int(req.GetMaxEntries()) < end {
+		end = start + int(req.GetMaxEntries())
+		nextToken = strconv.Itoa(end)
+	}
+
+	return &csi.ListVolumesResponse{
+		Entries:   entries[start:end],
+		NextToken: nextToken,
+	}, nil
+}
+
+func convertVolume(lv *carinav1.LogicVolume) *csi.Volume {
+	capacity := lv.Spec.Size.Value()
+	if lv.Status.CurrentSize != nil {
+		capacity = lv.Status.CurrentSize.Value()
+	}
+	return &csi.Volume{
+		CapacityBytes: capacity,
+		VolumeId:      lv.Status.VolumeID,
+		AccessibleTopology: []*csi.Topology{
+			{
+				Segments: map[string]string{carina.TopologyNodeKey: lv.Spec.NodeName},
+			},
+		},
+	}
+}
+
+// convertVolumeCondition the condition is checked by carina-node periodically
+func convertVolumeCondition(lv *carinav1.LogicVolume) *csi.VolumeCondition {
+	if lv.Status.Condition == nil {
+		return &csi.VolumeCondition{Abnormal: false, Message: "volume condition is not checked yet"}
+	}
+	message := lv.Status.Condition.Message
+	if !lv.Status.Condition.Abnormal && message == "" {
+		message = "volume is healthy"
+	}
+	return &csi.VolumeCondition{Abnormal: lv.Status.Condition.Abnormal, Message: message}
+}
+
+func convertSnapshot(ls *carinav1.LogicSnapshot) *csi.Snapshot {
+	snapshot := &csi.Snapshot{
+		SizeBytes:      ls.Spec.Size.Value(),
+		SnapshotId:     ls.Status.SnapshotID,
+		SourceVolumeId: ls.Spec.SourceVolumeID,
+		ReadyToUse:     ls.Status.ReadyToUse,
+	}
+	if ls.Status.CreationTime != nil {
+		snapshot.CreationTime = timestamppb.New(ls.Status.CreationTime.Time)
+	}
+	return snapshot
+}
+
+// isSupportedAccessMode SINGLE_NODE_SINGLE_WRITER allows only one pod to publish the volume,
+// SINGLE_NODE_WRITER and SINGLE_NODE_MULTI_WRITER allow the pods on the same node to share the volume
+func isSupportedAccessMode(mode csi.VolumeCapability_AccessMode_Mode) bool {
+	switch mode {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER:
+		return true
+	}
+	return false
+}
+
+// getVolumeLayout parses the thin, stripe and raid layout of lvm volume from storage class parameters
+func getVolumeLayout(params map[string]string, volumeType string) (k8s.VolumeLayout, error) {
+	layout := k8s.VolumeLayout{}
+	var err error
+	if layout.Stripes, layout.StripeSize, err = getStripeParameters(params); err != nil {
+		return layout, err
+	}
+
+	lvmType := params[carina.VolumeLvmType]
+	switch lvmType {
+	case "":
+	case carina.LvmTypeThin:
+		layout.Thin = true
+	case carina.LvmTypeRaid1, carina.LvmTypeRaid10:
+		layout.RaidType = lvmType
+		layout.Mirrors = 1
+		if v := params[carina.VolumeLvmMirrors]; v != "" {
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || n < 1 {
+				return layout, fmt.Errorf("%s should be a positive integer: %s", carina.VolumeLvmMirrors, v)
+			}
+			layout.Mirrors = uint32(n)
+		}
+	default:
+		return layout, fmt.Errorf("unsupported %s: %s", carina.VolumeLvmType, lvmType)
+	}
+
+	if volumeType != carina.LvmVolumeType && (lvmType != "" || layout.Stripes > 1) {
+		return layout, fmt.Errorf("%s and %s are only supported by lvm volume", carina.VolumeLvmType, carina.VolumeLvmStripes)
+	}
+	if layout.RaidType == "" && params[carina.VolumeLvmMirrors] != "" {
+		return layout, fmt.Errorf("%s requires %s raid1 or raid10", carina.VolumeLvmMirrors, carina.VolumeLvmType)
+	}
+	if layout.Thin && layout.Stripes > 1 {
+		return layout, fmt.Errorf("%s is not supported by thin volume", carina.VolumeLvmStripes)
+	}
+	if layout.RaidType == carina.LvmTypeRaid1 && layout.Stripes > 1 {
+		return layout, fmt.Errorf("%s is not supported by raid1 volume", carina.VolumeLvmStripes)
+	}
+	if layout.RaidType == carina.LvmTypeRaid10 && layout.Stripes < 2 {
+		return layout, fmt.Errorf("raid10 volume requires %s larger than 1", carina.VolumeLvmStripes)
+	}
+
+	if layout.CacheType, layout.CacheRatio, layout.CachePolicy, err = getCacheParameters(params); err != nil {
+		return layout, err
+	}
+	if layout.CacheType != "" && (volumeType != carina.LvmVolumeType || lvmType != "" || layout.Stripes > 1) {
+		return layout, fmt.Errorf("%s %s is only supported by linear lvm volume", carina.VolumeCacheType, layout.CacheType)
+	}
+	return layout, nil
+}
+
+// getCacheParameters parses the lvm native cache of volume from storage class parameters,
+// the empty cache type means the volume is not cached by lvm, which includes the bcache volume
+func getCacheParameters(params map[string]string) (string, uint32, string, error) {
+	cacheType := params[carina.VolumeCacheType]
+	switch cacheType {
+	case "", carina.CacheTypeBcache:
+		return "", 0, "", nil
+	case carina.CacheTypeDmCache, carina.CacheTypeWritecache:
+	default:
+		return "", 0, "", fmt.Errorf("unsupported %s: %s", carina.VolumeCacheType, cacheType)
+	}
+
+	// lvconvert requires the cache lv and the origin lv in the same vg
+	backendDeviceGroup := strings.ToLower(params[carina.VolumeBackendDiskType])
+	cacheDeviceGroup := strings.ToLower(params[carina.VolumeCacheDiskType])
+	if backendDeviceGroup == "" || backendDeviceGroup != cacheDeviceGroup {
+		return "", 0, "", fmt.Errorf("%s %s requires %s and %s in the same device group", carina.VolumeCacheType, cacheType, carina.VolumeBackendDiskType, carina.VolumeCacheDiskType)
+	}
+	if deviceGroup := util.GetDeviceGroup(params[carina.DeviceDiskKey]); deviceGroup != "" && deviceGroup != backendDeviceGroup {
+		return "", 0, "", fmt.Errorf("%s %s conflicts with %s %s", carina.DeviceDiskKey, deviceGroup, carina.VolumeBackendDiskType, backendDeviceGroup)
+	}
+
+	ratio, err := strconv.ParseUint(params[carina.VolumeCacheDiskRatio], 10, 32)
+	if err != nil || ratio < 1 || ratio >= 100 {
+		return "", 0, "", fmt.Errorf("%s %s, Should be in 1-100", carina.VolumeCacheDiskRatio, params[carina.VolumeCacheDiskRatio])
+	}
+
+	// dm-cache supports writethrough and writeback, writecache only caches the writes
+	cachePolicy := params[carina.VolumeCachePolicy]
+	switch {
+	case cacheType == carina.CacheTypeDmCache && cachePolicy == "":
+		cachePolicy = "writethrough"
+	case cacheType == carina.CacheTypeDmCache && utils.ContainsString([]string{"writethrough", "writeback"}, cachePolicy):
+	case cacheType == carina.CacheTypeWritecache && (cachePolicy == "" || cachePolicy == "writeback"):
+		cachePolicy = "writeback"
+	default:
+		return "", 0, "", fmt.Errorf("%s %s is not supported by %s %s", carina.VolumeCachePolicy, cachePolicy, carina.VolumeCacheType, cacheType)
+	}
+	return cacheType, uint32(ratio), cachePolicy, nil
+}
+
+// checkEncryption the lvm, raw and bcache volumes can be wrapped in dm-crypt/LUKS, the host volumes are directories
+func checkEncryption(params map[string]string, volumeType string) error {
+	switch params[carina.VolumeEncrypted] {
+	case "", "false":
+		return nil
+	case "true":
+		if volumeType == carina.HostVolumeType {
+			return fmt.Errorf("%s is not supported by host volume", carina.VolumeEncrypted)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s should be true or false: %s", carina.VolumeEncrypted, params[carina.VolumeEncrypted])
+	}
+}
+
+// getSchedulerStrategy the storage class may override the scheduler strategy of config.json
+func getSchedulerStrategy(params map[string]string) (string, error) {
+	strategy := params[carina.VolumeSchedulerStrategy]
+	if strategy == "" {
+		return configuration.SchedulerStrategy(), nil
+	}
+	if !configuration.IsSchedulerStrategy(strategy) {
+		return "", fmt.Errorf("%s should be %s or %s: %s", carina.VolumeSchedulerStrategy, configuration.SchedulerBinpack, configuration.Schedulerspreadout, strategy)
+	}
+	return strings.ToLower(strategy), nil
+}
+
+// getDiskAntiAffinity parses the disk anti-affinity of the volume, the pvc annotations override the storage class parameters.
+// The key is required and scoped in the namespace of the pvc, otherwise all unrelated volumes of the namespace would be one group
+func getDiskAntiAffinity(params, pvcAnnotations map[string]string, namespace, volumeType string, layout k8s.VolumeLayout) (k8s.DiskAntiAffinity, error) {
+	lookup := func(key string) string {
+		if v, ok := pvcAnnotations[key]; ok {
+			return v
+		}
+		return params[key]
+	}
+	antiAffinity := k8s.DiskAntiAffinity{}
+	policy := strings.ToLower(lookup(carina.VolumeDiskAntiAffinity))
+	switch policy {
+	case "":
+		return antiAffinity, nil
+	case carina.DiskAntiAffinityPreferred, carina.DiskAntiAffinityRequired:
+	default:
+		return antiAffinity, fmt.Errorf("%s should be %s or %s: %s", carina.VolumeDiskAntiAffinity, carina.DiskAntiAffinityPreferred, carina.DiskAntiAffinityRequired, policy)
+	}
+	// the stripes and the mirrors are already on different pvs, thin volumes share the thin pool
+	cached := params[carina.VolumeBackendDiskType] != ""
+	if volumeType == carina.HostVolumeType || layout.Thin || layout.Stripes > 1 || layout.RaidType != "" || cached {
+		return antiAffinity, fmt.Errorf("%s is only supported by raw volume and linear lvm volume", carina.VolumeDiskAntiAffinity)
+	}
+	key := lookup(carina.VolumeDiskAntiAffinityKey)
+	if key == "" {
+		return antiAffinity, fmt.Errorf("%s requires %s", carina.VolumeDiskAntiAffinity, carina.VolumeDiskAntiAffinityKey)
+	}
+	antiAffinity.Policy = policy
+	antiAffinity.Key = namespace + "/" + key
+	return antiAffinity, nil
+}
+
+// getStripeParameters parses the stripe count and the stripe size of lvm volume from storage class parameters
+func getStripeParameters(params map[string]string) (uint32, string, error) {
+	var stripes uint32
+	if v := params[carina.VolumeLvmStripes]; v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n < 1 {
+			return 0, "", fmt.Errorf("%s should be a positive integer: %s", carina.VolumeLvmStripes, v)
+		}
+		stripes = uint32(n)
+	}
+	stripeSize := params[carina.VolumeLvmStripeSize]
+	if stripeSize != "" {
+		if stripes <= 1 {
+			return 0, "", fmt.Errorf("%s requires %s larger than 1", carina.VolumeLvmStripeSize, carina.VolumeLvmStripes)
+		}
+		if !stripeSizeRegexp.MatchString(stripeSize) {
+			return 0, "", fmt.Errorf("%s should be a size like 64k: %s", carina.VolumeLvmStripeSize, stripeSize)
+		}
+	}
+	return stripes, stripeSize, nil
+}
+
 func convertRequestCapacity(requestBytes, limitBytes int64) (int64, error) {
 	if requestBytes < 0 {
 		return 0, errors.New("required capacity must not be negative")
@@ -469,7 +1129,7 @@ func convertRequestCapacity(requestBytes, limitBytes int64) (int64, error) {
 	return (requestBytes-1)>>30 + 1, nil
 }
 
-func (s controllerService) CreateBcacheVolume(ctx context.Context, req *csi.CreateVolumeRequest, nodeName string, requestGb int64) (*csi.CreateVolumeResponse, error) {
+func (s controllerService) CreateBcacheVolume(ctx context.Context, req *csi.CreateVolumeRequest, nodeName string, requestGb int64, strategy string) (*csi.CreateVolumeResponse, error) {
 	pvName := req.GetName()
 	if pvName == "" {
 		return nil, status.Error(codes.InvalidArgument, "invalid pv name")
@@ -519,7 +1179,7 @@ func (s controllerService) CreateBcacheVolume(ctx context.Context, req *csi.Crea
 
 	if nodeName == "" {
 		log.Info("start to decide node")
-		nodeName, err := s.nodeService.SelectMultiVolumeNode(ctx, backendDeviceGroup, cacheDeviceGroup, backendRequestGb, cacheRequestGb, requirements)
+		nodeName, err = s.nodeService.SelectMultiVolumeNode(ctx, backendDeviceGroup, cacheDeviceGroup, backendRequestGb, cacheRequestGb, requirements, strategy)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to select node, err: %v", err)
 		}
@@ -533,7 +1193,7 @@ func (s controllerService) CreateBcacheVolume(ctx context.Context, req *csi.Crea
 		carina.VolumeManagerType:    carina.LvmVolumeType,
 	}
 
-	backendDiskVolumeID, backendDiskDeviceMajor, backendDiskDeviceMinor, err := s.lvService.CreateVolume(ctx, namespace, pvcName, nodeName, backendDeviceGroup, backendVolumeName, backendRequestGb, metav1.OwnerReference{}, annotation)
+	backendDiskVolumeID, backendDiskDeviceMajor, backendDiskDeviceMinor, err := s.lvService.CreateVolume(ctx, namespace, pvcName, nodeName, backendDeviceGroup, backendVolumeName, backendRequestGb, k8s.VolumeLayout{}, metav1.OwnerReference{}, annotation)
 	if err != nil {
 		s, ok := status.FromError(err)
 		if s.Code() != codes.AlreadyExists {
@@ -563,7 +1223,7 @@ func (s controllerService) CreateBcacheVolume(ctx context.Context, req *csi.Crea
 		BlockOwnerDeletion: &blockOwnerDeletion,
 	}
 
-	cacheDiskVolumeID, cacheDiskDeviceMajor, cacheDiskDeviceMinor, err := s.lvService.CreateVolume(ctx, namespace, pvcName, nodeName, cacheDeviceGroup, cacheVolumeName, cacheRequestGb, owner, annotation)
+	cacheDiskVolumeID, cacheDiskDeviceMajor, cacheDiskDeviceMinor, err := s.lvService.CreateVolume(ctx, namespace, pvcName, nodeName, cacheDeviceGroup, cacheVolumeName, cacheRequestGb, k8s.VolumeLayout{}, owner, annotation)
 	if err != nil {
 		_, ok := status.FromError(err)
 		if !ok {
@@ -17,8 +17,15 @@ package driver
 
 import (
 	"errors"
-	"github.com/stretchr/testify/assert"
 	"testing"
+
+	"github.com/carina-io/carina"
+	carinav1 "github.com/carina-io/carina/api/v1"
+	"github.com/carina-io/carina/pkg/configuration"
+	"github.com/carina-io/carina/pkg/csidriver/driver/k8s"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestConvertRequestCapacity(t *testing.T) {
@@ -46,3 +53,212 @@ func TestConvertRequestCapacity(t *testing.T) {
 	}
 
 }
+
+func TestIsSupportedAccessMode(t *testing.T) {
+	table := []struct {
+		mode   csi.VolumeCapability_AccessMode_Mode
+		result bool
+	}{
+		{mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, result: true},
+		{mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER, result: true},
+		{mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER, result: true},
+		{mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY, result: false},
+		{mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, result: false},
+		{mode: csi.VolumeCapability_AccessMode_UNKNOWN, result: false},
+	}
+
+	a := assert.New(t)
+
+	for _, e := range table {
+		a.Equal(e.result, isSupportedAccessMode(e.mode))
+	}
+}
+
+func TestGetStripeParameters(t *testing.T) {
+	table := []struct {
+		params     map[string]string
+		stripes    uint32
+		stripeSize string
+		err        bool
+	}{
+		{params: map[string]string{}, stripes: 0, stripeSize: ""},
+		{params: map[string]string{carina.VolumeLvmStripes: "3"}, stripes: 3, stripeSize: ""},
+		{params: map[string]string{carina.VolumeLvmStripes: "2", carina.VolumeLvmStripeSize: "64k"}, stripes: 2, stripeSize: "64k"},
+		{params: map[string]string{carina.VolumeLvmStripes: "0"}, err: true},
+		{params: map[string]string{carina.VolumeLvmStripes: "two"}, err: true},
+		{params: map[string]string{carina.VolumeLvmStripeSize: "64k"}, err: true},
+		{params: map[string]string{carina.VolumeLvmStripes: "2", carina.VolumeLvmStripeSize: "64g"}, err: true},
+	}
+
+	a := assert.New(t)
+
+	for _, e := range table {
+		stripes, stripeSize, err := getStripeParameters(e.params)
+		if e.err {
+			a.Error(err)
+			continue
+		}
+		a.NoError(err)
+		a.Equal(e.stripes, stripes)
+		a.Equal(e.stripeSize, stripeSize)
+	}
+}
+
+func TestGetVolumeLayout(t *testing.T) {
+	table := []struct {
+		params     map[string]string
+		volumeType string
+		layout     k8s.VolumeLayout
+		err        bool
+	}{
+		{params: map[string]string{}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{}},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeThin}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{Thin: true}},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeRaid1}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{RaidType: carina.LvmTypeRaid1, Mirrors: 1}},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeRaid1, carina.VolumeLvmMirrors: "2"}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{RaidType: carina.LvmTypeRaid1, Mirrors: 2}},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeRaid10, carina.VolumeLvmStripes: "2"}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{RaidType: carina.LvmTypeRaid10, Mirrors: 1, Stripes: 2}},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeRaid10}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeRaid1, carina.VolumeLvmStripes: "2"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeRaid1, carina.VolumeLvmMirrors: "0"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeLvmMirrors: "1"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeThin, carina.VolumeLvmStripes: "2"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeLvmType: "raid5"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeLvmType: carina.LvmTypeRaid1}, volumeType: carina.RawVolumeType, err: true},
+		{params: map[string]string{carina.VolumeCacheType: carina.CacheTypeBcache, carina.VolumeCacheDiskRatio: "50"}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{}},
+		{params: map[string]string{carina.VolumeCacheType: carina.CacheTypeDmCache, carina.VolumeBackendDiskType: "hdd", carina.VolumeCacheDiskType: "hdd", carina.VolumeCacheDiskRatio: "50"}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{CacheType: carina.CacheTypeDmCache, CacheRatio: 50, CachePolicy: "writethrough"}},
+		{params: map[string]string{carina.VolumeCacheType: carina.CacheTypeWritecache, carina.VolumeBackendDiskType: "hdd", carina.VolumeCacheDiskType: "hdd", carina.VolumeCacheDiskRatio: "20"}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{CacheType: carina.CacheTypeWritecache, CacheRatio: 20, CachePolicy: "writeback"}},
+		{params: map[string]string{carina.VolumeCacheType: carina.CacheTypeDmCache, carina.VolumeBackendDiskType: "hdd", carina.VolumeCacheDiskType: "ssd", carina.VolumeCacheDiskRatio: "50"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeCacheType: carina.CacheTypeDmCache, carina.VolumeBackendDiskType: "hdd", carina.VolumeCacheDiskType: "hdd", carina.VolumeCacheDiskRatio: "100"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeCacheType: carina.CacheTypeDmCache, carina.VolumeBackendDiskType: "hdd", carina.VolumeCacheDiskType: "hdd", carina.VolumeCacheDiskRatio: "50", carina.VolumeCachePolicy: "writearound"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeCacheType: carina.CacheTypeWritecache, carina.VolumeBackendDiskType: "hdd", carina.VolumeCacheDiskType: "hdd", carina.VolumeCacheDiskRatio: "50", carina.VolumeLvmType: carina.LvmTypeThin}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeCacheType: "flashcache"}, volumeType: carina.LvmVolumeType, err: true},
+	}
+
+	a := assert.New(t)
+
+	for _, e := range table {
+		layout, err := getVolumeLayout(e.params, e.volumeType)
+		if e.err {
+			a.Error(err)
+			continue
+		}
+		a.NoError(err)
+		a.Equal(e.layout, layout)
+	}
+}
+
+func TestCheckEncryption(t *testing.T) {
+	table := []struct {
+		params     map[string]string
+		volumeType string
+		err        bool
+	}{
+		{params: map[string]string{}, volumeType: carina.HostVolumeType},
+		{params: map[string]string{carina.VolumeEncrypted: "true"}, volumeType: carina.LvmVolumeType},
+		{params: map[string]string{carina.VolumeEncrypted: "true"}, volumeType: carina.RawVolumeType},
+		{params: map[string]string{carina.VolumeEncrypted: "false"}, volumeType: carina.HostVolumeType},
+		{params: map[string]string{carina.VolumeEncrypted: "true"}, volumeType: carina.HostVolumeType, err: true},
+		{params: map[string]string{carina.VolumeEncrypted: "yes"}, volumeType: carina.LvmVolumeType, err: true},
+	}
+
+	a := assert.New(t)
+
+	for _, e := range table {
+		err := checkEncryption(e.params, e.volumeType)
+		if e.err {
+			a.Error(err)
+			continue
+		}
+		a.NoError(err)
+	}
+}
+
+func TestGetSchedulerStrategy(t *testing.T) {
+	table := []struct {
+		params   map[string]string
+		strategy string
+		err      bool
+	}{
+		{params: map[string]string{}, strategy: configuration.SchedulerStrategy()},
+		{params: map[string]string{carina.VolumeSchedulerStrategy: "binpack"}, strategy: configuration.SchedulerBinpack},
+		{params: map[string]string{carina.VolumeSchedulerStrategy: "Spreadout"}, strategy: configuration.Schedulerspreadout},
+		{params: map[string]string{carina.VolumeSchedulerStrategy: "random"}, err: true},
+	}
+
+	a := assert.New(t)
+
+	for _, e := range table {
+		strategy, err := getSchedulerStrategy(e.params)
+		if e.err {
+			a.Error(err)
+			continue
+		}
+		a.NoError(err)
+		a.Equal(e.strategy, strategy)
+	}
+}
+
+func TestGetDiskAntiAffinity(t *testing.T) {
+	table := []struct {
+		params         map[string]string
+		pvcAnnotations map[string]string
+		volumeType     string
+		layout         k8s.VolumeLayout
+		antiAffinity   k8s.DiskAntiAffinity
+		err            bool
+	}{
+		{params: map[string]string{}, volumeType: carina.RawVolumeType},
+		{
+			params:       map[string]string{carina.VolumeDiskAntiAffinity: "Required", carina.VolumeDiskAntiAffinityKey: "mysql"},
+			volumeType:   carina.RawVolumeType,
+			antiAffinity: k8s.DiskAntiAffinity{Policy: carina.DiskAntiAffinityRequired, Key: "default/mysql"},
+		},
+		{
+			params:         map[string]string{carina.VolumeDiskAntiAffinity: "required", carina.VolumeDiskAntiAffinityKey: "mysql"},
+			pvcAnnotations: map[string]string{carina.VolumeDiskAntiAffinity: "preferred", carina.VolumeDiskAntiAffinityKey: "redis"},
+			volumeType:     carina.LvmVolumeType,
+			antiAffinity:   k8s.DiskAntiAffinity{Policy: carina.DiskAntiAffinityPreferred, Key: "default/redis"},
+		},
+		{pvcAnnotations: map[string]string{carina.VolumeDiskAntiAffinity: "preferred"}, volumeType: carina.LvmVolumeType, err: true},
+		{params: map[string]string{carina.VolumeDiskAntiAffinity: "required", carina.VolumeDiskAntiAffinityKey: ""}, volumeType: carina.RawVolumeType, err: true},
+		{params: map[string]string{carina.VolumeDiskAntiAffinity: "always"}, volumeType: carina.RawVolumeType, err: true},
+		{params: map[string]string{carina.VolumeDiskAntiAffinity: "preferred"}, volumeType: carina.HostVolumeType, err: true},
+		{params: map[string]string{carina.VolumeDiskAntiAffinity: "preferred"}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{Thin: true}, err: true},
+		{params: map[string]string{carina.VolumeDiskAntiAffinity: "preferred"}, volumeType: carina.LvmVolumeType, layout: k8s.VolumeLayout{Stripes: 2}, err: true},
+	}
+
+	a := assert.New(t)
+
+	for _, e := range table {
+		antiAffinity, err := getDiskAntiAffinity(e.params, e.pvcAnnotations, "default", e.volumeType, e.layout)
+		if e.err {
+			a.Error(err)
+			continue
+		}
+		a.NoError(err)
+		a.Equal(e.antiAffinity, antiAffinity)
+	}
+}
+
+func TestSourceLayout(t *testing.T) {
+	a := assert.New(t)
+
+	source := &carinav1.LogicVolume{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			carina.VolumeLvmType:     carina.LvmTypeThin,
+			carina.VolumeEncrypted:   "true",
+			carina.VolumeCachePolicy: "writeback",
+		}},
+	}
+	annotation := map[string]string{carina.VolumeManagerType: carina.LvmVolumeType}
+	a.Equal(k8s.VolumeLayout{Thin: true}, sourceLayout(source, annotation))
+	a.Equal(map[string]string{carina.VolumeManagerType: carina.LvmVolumeType, carina.VolumeLvmType: carina.LvmTypeThin, carina.VolumeEncrypted: "true"}, annotation)
+
+	source = &carinav1.LogicVolume{Spec: carinav1.LogicVolumeSpec{RaidType: "raid10", Mirrors: 1, Stripes: 2, StripeSize: "64k"}}
+	annotation = map[string]string{}
+	a.Equal(k8s.VolumeLayout{RaidType: "raid10", Mirrors: 1, Stripes: 2, StripeSize: "64k"}, sourceLayout(source, annotation))
+	a.Empty(annotation)
+
+	req := &csi.CreateVolumeRequest{Name: "pvc-a", Parameters: map[string]string{carina.VolumeEncrypted: "true"}}
+	resp := newCreateVolumeResponse(req, "volume-pvc-a", "node1", "carina-vg-ssd", 253, 1, 1, annotation)
+	a.NotContains(resp.Volume.VolumeContext, carina.VolumeEncrypted)
+}
@@ -158,7 +158,7 @@ func NewLogicVolumeService(mgr manager.Manager) (*LogicVolumeService, error) {
 }
 
 // CreateVolume creates volume
-func (s *LogicVolumeService) CreateVolume(ctx context.Context, namespace, pvc, node, deviceGroup, pvName string, requestGb int64, owner metav1.OwnerReference, annotation map[string]string) (string, uint32, uint32, error) {
+func (s *LogicVolumeService) CreateVolume(ctx context.Context, namespace, pvc, node, deviceGroup, pvName string, requestGb int64, layout VolumeLayout, owner metav1.OwnerReference, annotation map[string]string) (string, uint32, uint32, error) {
 	log.Info("k8s.CreateVolume called name ", pvName, " node ", node, " deviceGroup ", deviceGroup, " size_gb ", requestGb)
 
 	lv := &carinav1.LogicVolume{
@@ -176,6 +176,13 @@ func (s *LogicVolumeService) CreateVolume(ctx context.Context, namespace, pvc, n
 			Size:        *resource.NewQuantity(requestGb<<30, resource.BinarySI),
 			NameSpace:   namespace,
 			Pvc:         pvc,
+			Stripes:     layout.Stripes,
+			StripeSize:  layout.StripeSize,
+			RaidType:    layout.RaidType,
+			Mirrors:     layout.Mirrors,
+			CacheType:   layout.CacheType,
+			CacheRatio:  layout.CacheRatio,
+			CachePolicy: layout.CachePolicy,
 		},
 	}
 
@@ -347,6 +354,32 @@ func (s *LogicVolumeService) GetLogicVolumeByVolumeId(ctx context.Context, volum
 	return s.lvGetter.GetByVolumeId(ctx, volumeID)
 }
 
+// ListVolumes returns the created LogicVolumes, the cache volumes of bcache are excluded.
+func (s *LogicVolumeService) ListVolumes(ctx context.Context) ([]carinav1.LogicVolume, error) {
+	lvList := new(carinav1.LogicVolumeList)
+	if err := s.List(ctx, lvList); err != nil {
+		return nil, err
+	}
+	var lvs []carinav1.LogicVolume
+	for _, lv := range lvList.Items {
+		if lv.Status.VolumeID == "" || isCacheVolume(&lv) {
+			continue
+		}
+		lvs = append(lvs, lv)
+	}
+	return lvs, nil
+}
+
+// isCacheVolume the cache volume of bcache is owned by the LogicVolume it caches
+func isCacheVolume(lv *carinav1.LogicVolume) bool {
+	for _, owner := range lv.OwnerReferences {
+		if owner.Kind == "LogicVolume" {
+			return true
+		}
+	}
+	return false
+}
+
 // GetLogicVolumesByNodeName returns logicVolumes by node name.
 func (s *LogicVolumeService) GetLogicVolumesByNodeName(ctx context.Context, nodeName string, tryReader bool) ([]*carinav1.LogicVolume, error) {
 	return s.lvGetter.GetByNodeName(ctx, nodeName, tryReader)
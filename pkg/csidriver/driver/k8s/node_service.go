@@ -32,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"github.com/carina-io/carina"
+	"github.com/carina-io/carina/api"
 	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
 	"github.com/carina-io/carina/getter"
 	"github.com/carina-io/carina/pkg/configuration"
@@ -57,6 +58,58 @@ type groupPair struct {
 	nodeName    string
 	group       string
 	allocatable int64
+	// rank the index of the first preferred topology the node matches, lower is preferred
+	rank int
+	// shared the raw disk already holds a volume of the same anti-affinity key
+	shared bool
+}
+
+// DiskAntiAffinity spreads the volumes sharing the key across different raw disks, or different pvs of the vg
+type DiskAntiAffinity struct {
+	// Policy preferred or required, empty means no anti-affinity
+	Policy string
+	// Key the anti-affinity key prefixed with the namespace of the pvc
+	Key string
+}
+
+// VolumeLayout the lvm layout of the volume requested by storage class parameters
+type VolumeLayout struct {
+	Thin        bool
+	Stripes     uint32
+	StripeSize  string
+	RaidType    string
+	Mirrors     uint32
+	CacheType   string
+	CacheRatio  uint32
+	CachePolicy string
+	// AntiAffinity is set by the storage class or the pvc annotation
+	AntiAffinity DiskAntiAffinity
+}
+
+// Copies the number of copies of data the volume consumes in the vg
+func (l VolumeLayout) Copies() int64 {
+	if l.RaidType != "" {
+		return int64(l.Mirrors) + 1
+	}
+	return 1
+}
+
+// CacheGb the size of lvm native cache in the same vg
+func (l VolumeLayout) CacheGb(requestGb int64) int64 {
+	if l.CacheType == "" {
+		return 0
+	}
+	return utils.CacheGb(requestGb, l.CacheRatio)
+}
+
+// Consumed the space the volume consumes in the vg, including the mirrors and the cache
+func (l VolumeLayout) Consumed(requestGb int64) int64 {
+	return requestGb*l.Copies() + l.CacheGb(requestGb)
+}
+
+// linear is a plain lvm volume which can be placed in any vg with enough free space
+func (l VolumeLayout) linear() bool {
+	return !l.Thin && l.Stripes <= 1 && l.RaidType == "" && l.CacheType == ""
 }
 
 // +kubebuilder:rbac:groups=carina.storage.io,resources=NodeStorageResources,verbs=get;list;watch
@@ -85,6 +138,24 @@ func (n NodeService) getLvExclusivityDisks(ctx context.Context, nodeName string)
 	return lvExclusivityDisks, nil
 }
 
+// getAntiAffinityDisks the raw disks holding the volumes of the anti-affinity key on the node
+func (n NodeService) getAntiAffinityDisks(ctx context.Context, nodeName, key string) ([]string, error) {
+	antiAffinityDisks := []string{}
+	if key == "" {
+		return antiAffinityDisks, nil
+	}
+	lvs, err := n.lvService.GetLogicVolumesByNodeName(ctx, nodeName, true)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "can not get logic volumes for nodeName %s", nodeName)
+	}
+	for _, lv := range lvs {
+		if lv.Annotations[carina.VolumeDiskAntiAffinityKey] == key {
+			antiAffinityDisks = append(antiAffinityDisks, lv.Spec.DeviceGroup)
+		}
+	}
+	return antiAffinityDisks, nil
+}
+
 func (n NodeService) getNodes(ctx context.Context, labels labels.Selector) (*corev1.NodeList, error) {
 	nodeList := new(corev1.NodeList)
 	var err error
@@ -114,12 +185,21 @@ func (n NodeService) HaveSelectedNode(ctx context.Context, namespace, name strin
 	return node, nil
 }
 
-func (n NodeService) SelectDeviceGroup(ctx context.Context, requestGb int64, exclusivityDisk bool, nodeName, volumeType, scDeviceGroup string) (string, error) {
-	if volumeType == carina.LvmVolumeType && scDeviceGroup != "" {
+// ClaimAnnotations returns the annotations of the pvc, which may override the storage class parameters
+func (n NodeService) ClaimAnnotations(ctx context.Context, namespace, name string) (map[string]string, error) {
+	pvc := new(corev1.PersistentVolumeClaim)
+	if err := n.getter.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, pvc); err != nil {
+		return nil, err
+	}
+	return pvc.Annotations, nil
+}
+
+func (n NodeService) SelectDeviceGroup(ctx context.Context, requestGb int64, exclusivityDisk bool, nodeName, volumeType, scDeviceGroup string, layout VolumeLayout, strategy string) (string, error) {
+	if volumeType == carina.LvmVolumeType && scDeviceGroup != "" && layout.linear() {
 		return scDeviceGroup, nil
 	}
 	var preselectNode []groupPair
-	var lvExclusivityDisks []string
+	var lvExclusivityDisks, antiAffinityDisks []string
 	var err error
 
 	nsr := new(carinav1beta1.NodeStorageResource)
@@ -131,17 +211,22 @@ func (n NodeService) SelectDeviceGroup(ctx context.Context, requestGb int64, exc
 		if lvExclusivityDisks, err = n.getLvExclusivityDisks(ctx, nodeName); err != nil {
 			return "", err
 		}
+		if antiAffinityDisks, err = n.getAntiAffinityDisks(ctx, nodeName, layout.AntiAffinity.Key); err != nil {
+			return "", err
+		}
 	}
 
+	keyPrefix := capacityKeyPrefix(layout.Thin)
+
 	for groupDetail, allocatable := range nsr.Status.Allocatable {
-		if allocatable.Value() < requestGb {
+		if allocatable.Value() < layout.Consumed(requestGb) {
 			continue
 		}
 
-		if !strings.HasPrefix(groupDetail, carina.DeviceCapacityKeyPrefix) {
+		if !strings.HasPrefix(groupDetail, keyPrefix) {
 			continue
 		}
-		group := strings.TrimPrefix(groupDetail, carina.DeviceCapacityKeyPrefix)
+		group := strings.TrimPrefix(groupDetail, keyPrefix)
 		isRawDevice := util.CheckRawDeviceGroup(strings.Split(group, "/")[0])
 
 		if volumeType == carina.RawVolumeType && isRawDevice {
@@ -165,12 +250,25 @@ func (n NodeService) SelectDeviceGroup(ctx context.Context, requestGb int64, exc
 			if existPartition {
 				continue
 			}
+			shared := utils.ContainsString(antiAffinityDisks, group)
+			if shared && layout.AntiAffinity.Policy == carina.DiskAntiAffinityRequired {
+				log.Infof("skip disk %s of anti-affinity key %s", group, layout.AntiAffinity.Key)
+				continue
+			}
 			preselectNode = append(preselectNode, groupPair{
 				group:       group,
 				allocatable: allocatable.Value(),
+				shared:      shared,
 			})
 		}
 		if volumeType == carina.LvmVolumeType && !isRawDevice {
+			if scDeviceGroup != "" && scDeviceGroup != group {
+				continue
+			}
+			if !layoutFits(nsr, group, requestGb, layout) {
+				log.Infof("skip device group %s without enough pvs for layout %+v", group, layout)
+				continue
+			}
 			preselectNode = append(preselectNode, groupPair{
 				group:       group,
 				allocatable: allocatable.Value(),
@@ -182,6 +280,7 @@ func (n NodeService) SelectDeviceGroup(ctx context.Context, requestGb int64, exc
 	if len(preselectNode) < 1 {
 		return "", ErrNodeNotFound
 	}
+	preselectNode = unshared(preselectNode)
 
 	if len(preselectNode) == 1 {
 		return preselectNode[0].group, nil
@@ -193,22 +292,23 @@ func (n NodeService) SelectDeviceGroup(ctx context.Context, requestGb int64, exc
 
 	// 这里只能选最小满足的，因为可能存在一个pod多个pv都需要落在这个节点
 	var selectDeviceGroup string
-	if configuration.SchedulerStrategy() == configuration.SchedulerBinpack {
+	if strategy == configuration.SchedulerBinpack {
 		selectDeviceGroup = preselectNode[0].group
-	} else if configuration.SchedulerStrategy() == configuration.Schedulerspreadout {
+	} else if strategy == configuration.Schedulerspreadout {
 		selectDeviceGroup = preselectNode[len(preselectNode)-1].group
 	} else {
-		return "", fmt.Errorf("Unsupported scheduling policies %s", configuration.SchedulerStrategy())
+		return "", fmt.Errorf("Unsupported scheduling policies %s", strategy)
 	}
 
 	return selectDeviceGroup, nil
 }
 
-func (n NodeService) SelectNode(ctx context.Context, requestGb int64, volumeType, scDeviceGroup string, requirement *csi.TopologyRequirement, exclusivityDisk bool) (string, string, error) {
+func (n NodeService) SelectNode(ctx context.Context, requestGb int64, volumeType, scDeviceGroup string, requirement *csi.TopologyRequirement, exclusivityDisk bool, layout VolumeLayout, strategy string) (string, string, error) {
 	nodeList, err := n.getNodes(ctx, nil)
 	if err != nil {
 		return "", "", err
 	}
+	keyPrefix := capacityKeyPrefix(layout.Thin)
 
 	var preselectNode []groupPair
 
@@ -218,7 +318,8 @@ func (n NodeService) SelectNode(ctx context.Context, requestGb int64, volumeType
 		}
 
 		// topology filter
-		if !topologyMatchNodeLabels(node.Labels, requirement) {
+		rank, ok := topologyMatchNodeLabels(node.Labels, requirement)
+		if !ok {
 			continue
 		}
 
@@ -228,23 +329,27 @@ func (n NodeService) SelectNode(ctx context.Context, requestGb int64, volumeType
 			continue
 		}
 
-		var lvExclusivityDisks []string
+		var lvExclusivityDisks, antiAffinityDisks []string
 		if volumeType == carina.RawVolumeType {
 			if lvExclusivityDisks, err = n.getLvExclusivityDisks(ctx, node.Name); err != nil {
 				log.Warnf("Failed to get lv exclusivity disks for node %s, err: %s, ignore it", node.Name, err.Error())
 				continue
 			}
+			if antiAffinityDisks, err = n.getAntiAffinityDisks(ctx, node.Name, layout.AntiAffinity.Key); err != nil {
+				log.Warnf("Failed to get anti-affinity disks for node %s, err: %s, ignore it", node.Name, err.Error())
+				continue
+			}
 		}
 
 		for groupDetail, allocatable := range nsr.Status.Allocatable {
-			if allocatable.Value() < requestGb {
+			if allocatable.Value() < layout.Consumed(requestGb) {
 				continue
 			}
 
-			if !strings.HasPrefix(groupDetail, carina.DeviceCapacityKeyPrefix) {
+			if !strings.HasPrefix(groupDetail, keyPrefix) {
 				continue
 			}
-			group := strings.TrimPrefix(groupDetail, carina.DeviceCapacityKeyPrefix)
+			group := strings.TrimPrefix(groupDetail, keyPrefix)
 			if scDeviceGroup != "" && scDeviceGroup != strings.Split(group, "/")[0] {
 				continue
 			}
@@ -267,17 +372,27 @@ func (n NodeService) SelectNode(ctx context.Context, requestGb int64, volumeType
 				if existPartition {
 					continue
 				}
+				shared := utils.ContainsString(antiAffinityDisks, group)
+				if shared && layout.AntiAffinity.Policy == carina.DiskAntiAffinityRequired {
+					continue
+				}
 				preselectNode = append(preselectNode, groupPair{
 					nodeName:    node.Name,
 					group:       group,
 					allocatable: allocatable.Value(),
+					rank:        rank,
+					shared:      shared,
 				})
 			}
 			if volumeType == carina.LvmVolumeType && !isRawDevice {
+				if !layoutFits(nsr, group, requestGb, layout) {
+					continue
+				}
 				preselectNode = append(preselectNode, groupPair{
 					nodeName:    node.Name,
 					group:       group,
 					allocatable: allocatable.Value(),
+					rank:        rank,
 				})
 			}
 		}
@@ -285,6 +400,7 @@ func (n NodeService) SelectNode(ctx context.Context, requestGb int64, volumeType
 	if len(preselectNode) < 1 {
 		return "", "", ErrNodeNotFound
 	}
+	preselectNode = unshared(mostPreferred(preselectNode))
 
 	if len(preselectNode) == 1 {
 		return preselectNode[0].nodeName, preselectNode[0].group, nil
@@ -294,23 +410,23 @@ func (n NodeService) SelectNode(ctx context.Context, requestGb int64, volumeType
 		return preselectNode[i].allocatable < preselectNode[j].allocatable
 	})
 
-	// 根据配置文件中设置算法进行节点选择
+	// 根据存储类或配置文件中设置算法进行节点选择
 	var nodeName, selectDeviceGroup string
-	if configuration.SchedulerStrategy() == configuration.SchedulerBinpack {
+	if strategy == configuration.SchedulerBinpack {
 		nodeName = preselectNode[0].nodeName
 		selectDeviceGroup = preselectNode[0].group
-	} else if configuration.SchedulerStrategy() == configuration.Schedulerspreadout {
+	} else if strategy == configuration.Schedulerspreadout {
 		nodeName = preselectNode[len(preselectNode)-1].nodeName
 		selectDeviceGroup = preselectNode[len(preselectNode)-1].group
 	} else {
-		return "", "", fmt.Errorf("Unsupported scheduling policies %s", configuration.SchedulerStrategy())
+		return "", "", fmt.Errorf("Unsupported scheduling policies %s", strategy)
 	}
 
 	return nodeName, selectDeviceGroup, nil
 }
 
 // GetCapacityByNodeName returns capacity of specified node by name.
-func (n NodeService) GetCapacityByNodeName(ctx context.Context, nodeName, lvDeviceGroup string) (int64, error) {
+func (n NodeService) GetCapacityByNodeName(ctx context.Context, nodeName, lvDeviceGroup string, thin bool) (int64, error) {
 	nsr := new(carinav1beta1.NodeStorageResource)
 	err := n.getter.Get(ctx, client.ObjectKey{Name: nodeName}, nsr)
 	if err != nil {
@@ -318,13 +434,31 @@ func (n NodeService) GetCapacityByNodeName(ctx context.Context, nodeName, lvDevi
 	}
 
 	for groupDetail, allocatable := range nsr.Status.Allocatable {
-		if groupDetail == carina.DeviceCapacityKeyPrefix+lvDeviceGroup {
+		if groupDetail == capacityKeyPrefix(thin)+lvDeviceGroup {
 			return allocatable.Value(), nil
 		}
 	}
 	return 0, errors.New("device group not found")
 }
 
+// layoutFits checks that the vg has enough pvs with free space for each stripe of each raid image
+func layoutFits(nsr *carinav1beta1.NodeStorageResource, vgName string, requestGb int64, layout VolumeLayout) bool {
+	for _, vg := range nsr.Status.VgGroups {
+		if vg.VGName == vgName {
+			return api.StripesFit(vg.PVS, vgName, uint64(requestGb<<30), uint(layout.Stripes), uint(layout.Copies()))
+		}
+	}
+	return layout.Stripes <= 1 && layout.Copies() <= 1
+}
+
+// capacityKeyPrefix thin volumes are accounted by the thin pool allocatable with overcommit ratio applied
+func capacityKeyPrefix(thin bool) string {
+	if thin {
+		return carina.ThinCapacityKeyPrefix
+	}
+	return carina.DeviceCapacityKeyPrefix
+}
+
 // GetTotalCapacity returns total capacity of all nodes.
 func (n NodeService) GetTotalCapacity(ctx context.Context, scDeviceGroup string, topology *csi.Topology, exclusivityDisk bool) (int64, error) {
 	var nodeLabels labels.Selector
@@ -402,7 +536,7 @@ func (n NodeService) GetTotalCapacity(ctx context.Context, scDeviceGroup string,
 	return capacity, nil
 }
 
-func (n NodeService) SelectMultiVolumeNode(ctx context.Context, backendDeviceGroup, cacheDeviceGroup string, backendRequestGb, cacheRequestGb int64, requirement *csi.TopologyRequirement) (string, error) {
+func (n NodeService) SelectMultiVolumeNode(ctx context.Context, backendDeviceGroup, cacheDeviceGroup string, backendRequestGb, cacheRequestGb int64, requirement *csi.TopologyRequirement, strategy string) (string, error) {
 	nodeList, err := n.getNodes(ctx, nil)
 	if err != nil {
 		return "", err
@@ -412,7 +546,8 @@ func (n NodeService) SelectMultiVolumeNode(ctx context.Context, backendDeviceGro
 
 	for _, node := range nodeList.Items {
 		// topology selector
-		if !topologyMatchNodeLabels(node.Labels, requirement) {
+		rank, ok := topologyMatchNodeLabels(node.Labels, requirement)
+		if !ok {
 			continue
 		}
 
@@ -446,6 +581,7 @@ func (n NodeService) SelectMultiVolumeNode(ctx context.Context, backendDeviceGro
 			preselectNode = append(preselectNode, groupPair{
 				nodeName:    node.Name,
 				allocatable: allocatable.Value(),
+				rank:        rank,
 			})
 		}
 
@@ -454,19 +590,20 @@ func (n NodeService) SelectMultiVolumeNode(ctx context.Context, backendDeviceGro
 	if len(preselectNode) < 1 {
 		return "", ErrNodeNotFound
 	}
+	preselectNode = mostPreferred(preselectNode)
 
 	sort.Slice(preselectNode, func(i, j int) bool {
 		return preselectNode[i].allocatable < preselectNode[j].allocatable
 	})
 
-	// 根据配置文件中设置算法进行节点选择
+	// 根据存储类或配置文件中设置算法进行节点选择
 	var nodeName string
-	if configuration.SchedulerStrategy() == configuration.SchedulerBinpack {
+	if strategy == configuration.SchedulerBinpack {
 		nodeName = preselectNode[0].nodeName
-	} else if configuration.SchedulerStrategy() == configuration.Schedulerspreadout {
+	} else if strategy == configuration.Schedulerspreadout {
 		nodeName = preselectNode[len(preselectNode)-1].nodeName
 	} else {
-		return "", fmt.Errorf("Unsupported scheduling policies %s", configuration.SchedulerStrategy())
+		return "", fmt.Errorf("Unsupported scheduling policies %s", strategy)
 	}
 
 	return nodeName, nil
@@ -481,26 +618,66 @@ func readyNode(node *corev1.Node) bool {
 	return false
 }
 
-func topologyMatchNodeLabels(nodeLabels map[string]string, requirement *csi.TopologyRequirement) bool {
-	if nodeLabels == nil || requirement == nil {
-		return false
+// topologyMatchNodeLabels the node must match one of the requisite topologies if any,
+// the rank is the index of the first preferred topology the node matches, len(preferred) if none.
+// The segments may include the node labels of the configured topologyKeys, e.g. zone and rack.
+func topologyMatchNodeLabels(nodeLabels map[string]string, requirement *csi.TopologyRequirement) (int, bool) {
+	preferred := requirement.GetPreferred()
+	requisite := requirement.GetRequisite()
+	if len(preferred) == 0 && len(requisite) == 0 {
+		return 0, true
+	}
+	if nodeLabels == nil {
+		return 0, false
+	}
+	nodeSet := labels.Set(nodeLabels)
+	if len(requisite) > 0 {
+		requisiteMatch := false
+		for _, topo := range requisite {
+			if labels.SelectorFromSet(topo.GetSegments()).Matches(nodeSet) {
+				requisiteMatch = true
+				break
+			}
+		}
+		if !requisiteMatch {
+			return 0, false
+		}
 	}
-	// topology filter
-	topologyMatch := false
-	for _, topo := range requirement.GetPreferred() {
-		if labels.SelectorFromSet(topo.GetSegments()).Matches(labels.Set(nodeLabels)) {
-			topologyMatch = true
-			break
+	for i, topo := range preferred {
+		if labels.SelectorFromSet(topo.GetSegments()).Matches(nodeSet) {
+			return i, true
 		}
 	}
-	if !topologyMatch {
-		for _, topo := range requirement.GetRequisite() {
-			if labels.SelectorFromSet(topo.GetSegments()).Matches(labels.Set(nodeLabels)) {
-				topologyMatch = true
-				break
-			}
+	return len(preferred), true
+}
+
+// mostPreferred keeps the candidates on the nodes matching the earliest preferred topology
+func mostPreferred(preselectNode []groupPair) []groupPair {
+	minRank := preselectNode[0].rank
+	for _, p := range preselectNode {
+		if p.rank < minRank {
+			minRank = p.rank
+		}
+	}
+	var preferred []groupPair
+	for _, p := range preselectNode {
+		if p.rank == minRank {
+			preferred = append(preferred, p)
 		}
 	}
+	return preferred
+}
 
-	return topologyMatch
+// unshared keeps the raw disks without the volumes of the same anti-affinity key, unless all of them are shared
+func unshared(preselectNode []groupPair) []groupPair {
+	var apart []groupPair
+	for _, p := range preselectNode {
+		if !p.shared {
+			apart = append(apart, p)
+		}
+	}
+	if len(apart) == 0 {
+		return preselectNode
+	}
+	return apart
 }
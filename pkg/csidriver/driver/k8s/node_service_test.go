@@ -0,0 +1,100 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/carina-io/carina"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopologyMatchNodeLabels(t *testing.T) {
+	nodeLabels := map[string]string{
+		carina.TopologyNodeKey:        "node1",
+		"topology.kubernetes.io/zone": "zone-a",
+		"example.com/rack":            "rack-1",
+	}
+	topology := func(segments map[string]string) *csi.Topology {
+		return &csi.Topology{Segments: segments}
+	}
+	table := []struct {
+		requirement *csi.TopologyRequirement
+		rank        int
+		ok          bool
+	}{
+		{requirement: nil, rank: 0, ok: true},
+		{
+			requirement: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{topology(map[string]string{"example.com/rack": "rack-2"})},
+			},
+			ok: false,
+		},
+		{
+			requirement: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{
+					topology(map[string]string{"topology.kubernetes.io/zone": "zone-a", "example.com/rack": "rack-1"}),
+					topology(map[string]string{"topology.kubernetes.io/zone": "zone-a", "example.com/rack": "rack-2"}),
+				},
+				Preferred: []*csi.Topology{
+					topology(map[string]string{"topology.kubernetes.io/zone": "zone-a", "example.com/rack": "rack-2"}),
+					topology(map[string]string{"topology.kubernetes.io/zone": "zone-a", "example.com/rack": "rack-1"}),
+				},
+			},
+			rank: 1,
+			ok:   true,
+		},
+		{
+			requirement: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{topology(map[string]string{"topology.kubernetes.io/zone": "zone-a"})},
+				Preferred: []*csi.Topology{topology(map[string]string{carina.TopologyNodeKey: "node2"})},
+			},
+			rank: 1,
+			ok:   true,
+		},
+	}
+
+	a := assert.New(t)
+	for _, e := range table {
+		rank, ok := topologyMatchNodeLabels(nodeLabels, e.requirement)
+		a.Equal(e.ok, ok)
+		if e.ok {
+			a.Equal(e.rank, rank)
+		}
+	}
+
+	preselectNode := mostPreferred([]groupPair{
+		{nodeName: "node1", rank: 1},
+		{nodeName: "node2", rank: 0},
+		{nodeName: "node3", rank: 0},
+	})
+	a.Equal([]groupPair{{nodeName: "node2", rank: 0}, {nodeName: "node3", rank: 0}}, preselectNode)
+}
+
+func TestUnshared(t *testing.T) {
+	a := assert.New(t)
+	preselectNode := unshared([]groupPair{
+		{group: "carina-raw-ssd/sdb", shared: true},
+		{group: "carina-raw-ssd/sdc"},
+	})
+	a.Equal([]groupPair{{group: "carina-raw-ssd/sdc"}}, preselectNode)
+
+	// the preferred anti-affinity falls back to the shared disks
+	preselectNode = unshared([]groupPair{{group: "carina-raw-ssd/sdb", shared: true}})
+	a.Equal([]groupPair{{group: "carina-raw-ssd/sdb", shared: true}}, preselectNode)
+}
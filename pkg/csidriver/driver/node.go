@@ -19,6 +19,7 @@ package driver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/anuvu/disko"
 	"github.com/anuvu/disko/linux"
 	"github.com/carina-io/carina"
@@ -26,6 +27,7 @@ import (
 	"github.com/carina-io/carina/pkg/csidriver/driver/k8s"
 	"github.com/carina-io/carina/pkg/csidriver/filesystem"
 	deviceManager "github.com/carina-io/carina/pkg/devicemanager"
+	"github.com/carina-io/carina/pkg/devicemanager/hostpath"
 	"github.com/carina-io/carina/pkg/devicemanager/types"
 	"github.com/carina-io/carina/utils"
 	"github.com/carina-io/carina/utils/log"
@@ -73,6 +75,277 @@ type nodeService struct {
 	mounter      mountutil.SafeFormatAndMount
 }
 
+func (s *nodeService) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	volumeContext := req.GetVolumeContext()
+	volumeID := req.GetVolumeId()
+
+	log.Info("NodeStageVolume called",
+		" volume_id ", volumeID,
+		" publish_context ", req.GetPublishContext(),
+		" staging_target_path ", req.GetStagingTargetPath(),
+		" volume_capability ", req.GetVolumeCapability(),
+		" num_secrets ", len(req.GetSecrets()),
+		" volume_context ", volumeContext)
+
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no volume_id is provided")
+	}
+	if len(req.GetStagingTargetPath()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no staging_target_path is provided")
+	}
+	if req.GetVolumeCapability() == nil {
+		return nil, status.Error(codes.InvalidArgument, "no volume_capability is provided")
+	}
+	isBlockVol := req.GetVolumeCapability().GetBlock() != nil
+	isFsVol := req.GetVolumeCapability().GetMount() != nil
+	if !(isBlockVol || isFsVol) {
+		return nil, status.Errorf(codes.InvalidArgument, "no supported volume capability: %v", req.GetVolumeCapability())
+	}
+
+	if acquired := s.mutex.TryAcquire(volumeID); !acquired {
+		log.Warnf("An stage operation with the given volume %s already exists", volumeID)
+		return nil, status.Errorf(codes.Aborted, "an stage operation with the given volume %s already exists", volumeID)
+	}
+	defer s.mutex.Release(volumeID)
+
+	cacheVolumeId := volumeContext[carina.VolumeCacheId]
+	if cacheVolumeId != "" {
+		return s.nodeStageBcacheVolume(ctx, req)
+	}
+
+	// block volumes are published as device files, nothing to stage unless they are encrypted
+	if isBlockVol && volumeContext[carina.VolumeEncrypted] != "true" {
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	var device string
+	lvr, err := s.k8sLVService.GetLogicVolumeByVolumeId(ctx, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	switch lvr.Annotations[carina.VolumeManagerType] {
+	case carina.LvmVolumeType:
+		lv, err := s.getLvFromContext(lvr.Spec.DeviceGroup, volumeID)
+		if err != nil {
+			return nil, err
+		}
+		if lv == nil {
+			return nil, status.Errorf(codes.NotFound, "failed to find LV: %s", volumeID)
+		}
+		device = filepath.Join(DeviceDirectory, volumeID)
+		if err = s.createDeviceIfNeeded(device, lv.LVKernelMajor, lv.LVKernelMinor); err != nil {
+			return nil, err
+		}
+	case carina.RawVolumeType:
+		device, err = s.getRawDevice(lvr.Spec.DeviceGroup, volumeID)
+		if err != nil {
+			return nil, err
+		}
+	case carina.HostVolumeType:
+		// host path volumes are bind mounted by NodePublishVolume
+		return &csi.NodeStageVolumeResponse{}, nil
+	default:
+		log.Errorf("Create LogicVolume: Create with no support volume type undefined")
+		return nil, status.Errorf(codes.InvalidArgument, "Create with no support type ")
+	}
+
+	device, err = s.openLuksDevice(req, device)
+	if err != nil {
+		return nil, err
+	}
+	if isBlockVol {
+		log.Info("NodeStageVolume(block) succeeded",
+			" volume_id ", volumeID,
+			" device ", device)
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+	return s.nodeStageFilesystemVolume(req, device)
+}
+
+func (s *nodeService) nodeStageBcacheVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	volumeContext := req.GetVolumeContext()
+
+	backendDevice := volumeContext[carina.VolumeDevicePath]
+	cacheDevice := volumeContext[carina.VolumeCacheDevicePath]
+	block := volumeContext[carina.VolumeCacheBlock]
+	bucket := volumeContext[carina.VolumeCacheBucket]
+	cachePolicy := volumeContext[carina.VolumeCachePolicy]
+	// the cache mode changed on the live volume takes precedence over the storage class
+	if lv, err := s.k8sLVService.GetLogicVolumeByVolumeId(ctx, req.GetVolumeId()); err == nil && utils.ContainsString([]string{"writethrough", "writeback", "writearound"}, lv.Annotations[carina.VolumeCachePolicy]) {
+		cachePolicy = lv.Annotations[carina.VolumeCachePolicy]
+	}
+
+	if backendDevice == "" || cacheDevice == "" {
+		return nil, status.Errorf(codes.FailedPrecondition, "carina.storage.io/path %s carina.storage.io/cache/path %s, can not be empty", backendDevice, cacheDevice)
+	}
+
+	// the bcache device is created once and shared by all the publish of this volume
+	cacheDeviceInfo, err := s.getActiveBcacheDevice(backendDevice)
+	if err != nil {
+		cacheDeviceInfo, err = s.dm.VolumeManager.CreateBcache(backendDevice, cacheDevice, block, bucket, cachePolicy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	device, err := s.openLuksDevice(req, cacheDeviceInfo.BcachePath)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetVolumeCapability().GetBlock() != nil {
+		log.Info("NodeStageVolume(block) succeeded",
+			" volume_id ", req.GetVolumeId(),
+			" bcache_device ", cacheDeviceInfo.BcachePath)
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+	return s.nodeStageFilesystemVolume(req, device)
+}
+
+// openLuksDevice opens the encrypted volume with the passphrase of node stage secrets and returns the dm-crypt device,
+// the device is returned as it is if the volume is not encrypted
+func (s *nodeService) openLuksDevice(req *csi.NodeStageVolumeRequest, device string) (string, error) {
+	if req.GetVolumeContext()[carina.VolumeEncrypted] != "true" {
+		return device, nil
+	}
+	passphrase := req.GetSecrets()[carina.EncryptionPassphraseKey]
+	if passphrase == "" {
+		return "", status.Errorf(codes.InvalidArgument, "no %s in node stage secrets of encrypted volume %s, the node publish secrets are not used, set csi.storage.k8s.io/node-stage-secret-name in the storage class", carina.EncryptionPassphraseKey, req.GetVolumeId())
+	}
+	mapperPath, err := filesystem.NewLuks(&s.mounter).Open(device, req.GetVolumeId(), passphrase)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to open encrypted volume %s: %v", req.GetVolumeId(), err)
+	}
+	return mapperPath, nil
+}
+
+func (s *nodeService) nodeStageFilesystemVolume(req *csi.NodeStageVolumeRequest, device string) (*csi.NodeStageVolumeResponse, error) {
+	// Check request
+	mountOption := req.GetVolumeCapability().GetMount()
+	if mountOption.FsType == "" {
+		mountOption.FsType = "ext4"
+	}
+	accessMode := req.GetVolumeCapability().GetAccessMode().GetMode()
+	if !isSupportedAccessMode(accessMode) {
+		modeName := csi.VolumeCapability_AccessMode_Mode_name[int32(accessMode)]
+		return nil, status.Errorf(codes.FailedPrecondition, "unsupported access mode: %s", modeName)
+	}
+
+	stagingPath := req.GetStagingTargetPath()
+	mountOptions := append([]string{}, mountOption.MountFlags...)
+
+	err := os.MkdirAll(stagingPath, 0755)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "mkdir failed: target=%s, error=%v", stagingPath, err)
+	}
+
+	fsType, err := filesystem.DetectFilesystem(device)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "filesystem check failed: volume=%s, error=%v", req.GetVolumeId(), err)
+	}
+
+	if fsType != "" && fsType != mountOption.FsType {
+		return nil, status.Errorf(codes.Internal, "target device is already formatted with different filesystem: volume=%s, current=%s, new:%s", req.GetVolumeId(), fsType, mountOption.FsType)
+	}
+
+	// the restored or cloned xfs has the same uuid as the source
+	_, fromSnapshot := req.GetVolumeContext()[carina.VolumeSourceSnapshot]
+	_, fromVolume := req.GetVolumeContext()[carina.VolumeSourceVolume]
+	if mountOption.FsType == "xfs" && (fromSnapshot || fromVolume) {
+		mountOptions = append(mountOptions, "nouuid")
+	}
+
+	mounted, err := filesystem.IsMounted(device, stagingPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "mount check failed: target=%s, error=%v", stagingPath, err)
+	}
+
+	if !mounted {
+		log.Infof("mount %s %s %s %s", device, stagingPath, mountOption.FsType, strings.Join(mountOptions, ","))
+		if err := s.mounter.FormatAndMount(device, stagingPath, mountOption.FsType, mountOptions); err != nil {
+			return nil, status.Errorf(codes.Internal, "mount failed: volume=%s, error=%v", req.GetVolumeId(), err)
+		}
+		if err := os.Chmod(stagingPath, 0777|os.ModeSetgid); err != nil {
+			return nil, status.Errorf(codes.Internal, "chmod 2777 failed: target=%s, error=%v", stagingPath, err)
+		}
+		if err := s.resizeStagedFilesystem(req, device, fsType); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("NodeStageVolume(fs) succeeded",
+		" volume_id ", req.GetVolumeId(),
+		" staging_target_path ", stagingPath,
+		" fstype ", mountOption.FsType)
+
+	return &csi.NodeStageVolumeResponse{}, nil
+}
+
+// resizeStagedFilesystem the volume restored from snapshot or cloned from volume may be larger than the source filesystem,
+// and the bcache device may be larger than the filesystem created before
+func (s *nodeService) resizeStagedFilesystem(req *csi.NodeStageVolumeRequest, device, fsType string) error {
+	_, fromSnapshot := req.GetVolumeContext()[carina.VolumeSourceSnapshot]
+	_, fromVolume := req.GetVolumeContext()[carina.VolumeSourceVolume]
+	isCache := req.GetVolumeContext()[carina.VolumeCacheId] != ""
+	if (!fromSnapshot && !fromVolume && !isCache) || fsType == "" {
+		return nil
+	}
+	r := filesystem.NewResizeFs(&s.mounter)
+	if _, err := r.Resize(device, req.GetStagingTargetPath()); err != nil {
+		return status.Errorf(codes.Internal, "failed to resize filesystem %s (mounted at: %s): %v", req.GetVolumeId(), req.GetStagingTargetPath(), err)
+	}
+	return nil
+}
+
+func (s *nodeService) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	volID := req.GetVolumeId()
+	stagingPath := req.GetStagingTargetPath()
+	log.Info("NodeUnstageVolume called",
+		" volume_id ", volID,
+		" staging_target_path ", stagingPath)
+
+	if len(volID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no volume_id is provided")
+	}
+	if len(stagingPath) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no staging_target_path is provided")
+	}
+
+	if acquired := s.mutex.TryAcquire(volID); !acquired {
+		log.Warnf("An unstage operation with the given volume %s already exists", volID)
+		return nil, status.Errorf(codes.Aborted, "an unstage operation with the given volume %s already exists", volID)
+	}
+	defer s.mutex.Release(volID)
+
+	// unmount the global mount of filesystem volumes, the block volumes only have a staging directory
+	if err := mountutil.CleanupMountPoint(stagingPath, s.mounter.Interface, true); err != nil {
+		return nil, status.Errorf(codes.Internal, "unmount failed for %s: error=%v", stagingPath, err)
+	}
+
+	// the dm-crypt device must be closed before the bcache device under it is stopped
+	if err := filesystem.NewLuks(&s.mounter).Close(volID); err != nil {
+		return nil, status.Errorf(codes.Internal, "close encrypted device failed for %s: error=%v", volID, err)
+	}
+
+	bcacheDevice, err := s.getBcacheDevice(volID)
+	if err == nil && bcacheDevice != nil && bcacheDevice.DevicePath != "" {
+		log.Infof("remove bcache device %s backend device %s", bcacheDevice.BcachePath, bcacheDevice.DevicePath)
+		if err = s.dm.VolumeManager.DeleteBcache(bcacheDevice.DevicePath, ""); err != nil {
+			return nil, status.Errorf(codes.Internal, "remove device failed for %s: error=%v", bcacheDevice.BcachePath, err)
+		}
+	}
+
+	// device file for mount-type lvm volume
+	device := filepath.Join(DeviceDirectory, volID)
+	if err = os.Remove(device); err != nil && !os.IsNotExist(err) {
+		return nil, status.Errorf(codes.Internal, "remove device failed for %s: error=%v", device, err)
+	}
+
+	log.Info("NodeUnstageVolume is succeeded",
+		" volume_id ", volID,
+		" staging_target_path ", stagingPath)
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
 func (s *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
 	volumeContext := req.GetVolumeContext()
 	volumeID := req.GetVolumeId()
@@ -107,6 +380,10 @@ func (s *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	}
 	defer s.mutex.Release(volumeID)
 
+	if volumeContext[carina.VolumeEncrypted] == "true" {
+		return s.nodePublishLuksVolume(req)
+	}
+
 	cacheVolumeId := volumeContext[carina.VolumeCacheId]
 	if cacheVolumeId != "" {
 		return s.nodePublishBcacheVolume(ctx, req)
@@ -131,7 +408,7 @@ func (s *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		if isBlockVol {
 			_, err = s.nodePublishLvmBlockVolume(req, lv)
 		} else if isFsVol {
-			_, err = s.nodePublishLvmFilesystemVolume(req, lv)
+			_, err = s.nodePublishStagedFilesystemVolume(req, filepath.Join(DeviceDirectory, volumeID))
 		}
 
 		if err != nil {
@@ -153,7 +430,7 @@ func (s *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		if isBlockVol {
 			_, err = s.nodePublishRawBlockVolume(req, disk, &partition)
 		} else if isFsVol {
-			_, err = s.nodePublishRawFilesystemVolume(req, disk, &partition)
+			_, err = s.nodePublishStagedFilesystemVolume(req, linux.GetPartitionKname(disk.Path, partition.Number))
 		}
 
 		if err != nil {
@@ -175,12 +452,34 @@ func (s *nodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 
 func (s *nodeService) nodePublishLvmBlockVolume(req *csi.NodePublishVolumeRequest, lv *types.LvInfo) (*csi.NodePublishVolumeResponse, error) {
 	// Find lv and create a block device with it
+	return s.nodePublishBlockDevice(req, lv.LVKernelMajor, lv.LVKernelMinor)
+}
+
+// nodePublishLuksVolume publishes the dm-crypt device opened by NodeStageVolume
+func (s *nodeService) nodePublishLuksVolume(req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	if !filesystem.IsLuksOpen(volumeID) {
+		return nil, status.Errorf(codes.FailedPrecondition, "encrypted volume %s is not staged", volumeID)
+	}
+	device := filesystem.LuksMapperPath(volumeID)
+	if req.GetVolumeCapability().GetBlock() != nil {
+		var stat unix.Stat_t
+		if err := filesystem.Stat(device, &stat); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to stat %s: %v", device, err)
+		}
+		return s.nodePublishBlockDevice(req, unix.Major(uint64(stat.Rdev)), unix.Minor(uint64(stat.Rdev)))
+	}
+	return s.nodePublishStagedFilesystemVolume(req, device)
+}
+
+// nodePublishBlockDevice creates the device file of the block volume at the target path
+func (s *nodeService) nodePublishBlockDevice(req *csi.NodePublishVolumeRequest, major, minor uint32) (*csi.NodePublishVolumeResponse, error) {
 	var stat unix.Stat_t
 	target := req.GetTargetPath()
 	err := filesystem.Stat(target, &stat)
 	switch err {
 	case nil:
-		if stat.Rdev == unix.Mkdev(lv.LVKernelMajor, lv.LVKernelMinor) && stat.Mode&devicePermission == devicePermission {
+		if stat.Rdev == unix.Mkdev(major, minor) && stat.Mode&devicePermission == devicePermission {
 			return &csi.NodePublishVolumeResponse{}, nil
 		}
 		if err = os.Remove(target); err != nil {
@@ -196,7 +495,11 @@ func (s *nodeService) nodePublishLvmBlockVolume(req *csi.NodePublishVolumeReques
 		return nil, status.Errorf(codes.Internal, "mkdir failed: target=%s, error=%v", path.Dir(target), err)
 	}
 
-	devno := unix.Mkdev(lv.LVKernelMajor, lv.LVKernelMinor)
+	if err := checkSingleWriterDevice(req, major, minor); err != nil {
+		return nil, err
+	}
+
+	devno := unix.Mkdev(major, minor)
 	if err := filesystem.Mknod(target, devicePermission, int(devno)); err != nil {
 		return nil, status.Errorf(codes.Internal, "mknod failed for %s: error=%v", target, err)
 	}
@@ -249,6 +552,10 @@ func (s *nodeService) nodePublishRawBlockVolume(req *csi.NodePublishVolumeReques
 		return nil, status.Errorf(codes.Internal, "mkdir failed: target=%s, error=%v", path.Dir(target), err)
 	}
 
+	if err := checkSingleWriterDevice(req, uint32(MAJOR), uint32(MINOR)); err != nil {
+		return nil, err
+	}
+
 	devno := unix.Mkdev(uint32(MAJOR), uint32(MINOR))
 	if err := filesystem.Mknod(target, devicePermission, int(devno)); err != nil {
 		return nil, status.Errorf(codes.Internal, "mknod failed for %s: error=%v", target, err)
@@ -260,122 +567,30 @@ func (s *nodeService) nodePublishRawBlockVolume(req *csi.NodePublishVolumeReques
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
-func (s *nodeService) nodePublishLvmFilesystemVolume(req *csi.NodePublishVolumeRequest, lv *types.LvInfo) (*csi.NodePublishVolumeResponse, error) {
-	// Check request
-	mountOption := req.GetVolumeCapability().GetMount()
-	if mountOption.FsType == "" {
-		mountOption.FsType = "ext4"
-	}
-	accessMode := req.GetVolumeCapability().GetAccessMode().GetMode()
-	if accessMode != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER {
-		modeName := csi.VolumeCapability_AccessMode_Mode_name[int32(accessMode)]
-		return nil, status.Errorf(codes.FailedPrecondition, "unsupported access mode: %s", modeName)
-	}
-
-	// Find lv and create a block device with it
-	device := filepath.Join(DeviceDirectory, req.GetVolumeId())
-	err := s.createDeviceIfNeeded(device, lv.LVKernelMajor, lv.LVKernelMinor)
-	if err != nil {
-		return nil, err
-	}
-
-	var mountOptions []string
-	if req.GetReadonly() {
-		mountOptions = append(mountOptions, "ro")
-	}
-
-	for _, m := range mountOption.MountFlags {
-		if m == "rw" && req.GetReadonly() {
-			return nil, status.Error(codes.InvalidArgument, "mount option \"rw\" is specified even though read only mode is specified")
-		}
-		mountOptions = append(mountOptions, m)
-	}
-
-	err = os.MkdirAll(req.GetTargetPath(), 0755)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "mkdir failed: target=%s, error=%v", req.GetTargetPath(), err)
-	}
-
-	fsType, err := filesystem.DetectFilesystem(device)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "filesystem check failed: volume=%s, error=%v", req.GetVolumeId(), err)
-	}
-
-	if fsType != "" && fsType != mountOption.FsType {
-		return nil, status.Errorf(codes.Internal, "target device is already formatted with different filesystem: volume=%s, current=%s, new:%s", req.GetVolumeId(), fsType, mountOption.FsType)
-	}
-
-	if mountOption.FsType == "xfs" {
-		mountOptions = append(mountOptions, "nouuid")
-	}
-
-	mounted, err := filesystem.IsMounted(device, req.GetTargetPath())
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "mount check failed: target=%s, error=%v", req.GetTargetPath(), err)
-	}
-
-	if !mounted {
-		log.Infof("mount %s %s %s %s", device, req.GetTargetPath(), mountOption.FsType, strings.Join(mountOptions, ","))
-		if err := s.mounter.FormatAndMount(device, req.GetTargetPath(), mountOption.FsType, mountOptions); err != nil {
-			return nil, status.Errorf(codes.Internal, "mount failed: volume=%s, error=%v", req.GetVolumeId(), err)
-		}
-		if err := os.Chmod(req.GetTargetPath(), 0777|os.ModeSetgid); err != nil {
-			return nil, status.Errorf(codes.Internal, "chmod 2777 failed: target=%s, error=%v", req.GetTargetPath(), err)
-		}
-	}
-
-	log.Info("NodePublishVolume(fs) succeeded",
-		" volume_id ", req.GetVolumeId(),
-		" target_path ", req.GetTargetPath(),
-		" fstype ", mountOption.FsType)
-
-	return &csi.NodePublishVolumeResponse{}, nil
-}
-func (s *nodeService) nodePublishRawFilesystemVolume(req *csi.NodePublishVolumeRequest, disk disko.Disk, part *disko.Partition) (*csi.NodePublishVolumeResponse, error) {
-	// Check request
-	log.Info("NodePublishVolume device: Filesystem")
-	mountOption := req.GetVolumeCapability().GetMount()
-	if mountOption.FsType == "" {
-		mountOption.FsType = "ext4"
-	}
-	accessMode := req.GetVolumeCapability().GetAccessMode().GetMode()
-	if accessMode != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER {
-		modeName := csi.VolumeCapability_AccessMode_Mode_name[int32(accessMode)]
-		return nil, status.Errorf(codes.FailedPrecondition, "unsupported access mode: %s", modeName)
+// nodePublishStagedFilesystemVolume bind mount the global mount created by NodeStageVolume to the target path
+func (s *nodeService) nodePublishStagedFilesystemVolume(req *csi.NodePublishVolumeRequest, device string) (*csi.NodePublishVolumeResponse, error) {
+	stagingPath := req.GetStagingTargetPath()
+	if len(stagingPath) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no staging_target_path is provided")
 	}
-	device := linux.GetPartitionKname(disk.Path, part.Number)
-	log.Info("NodePublishVolume device: ", device)
 
-	partinfo, err := linux.GetUdevInfo(device)
+	staged, err := filesystem.IsMounted(device, stagingPath)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get partinfo %s", err)
+		return nil, status.Errorf(codes.Internal, "mount check failed: target=%s, error=%v", stagingPath, err)
 	}
-	var MAJOR uint64
-	var MINOR uint64
-	if str, ok := partinfo.Properties["MAJOR"]; ok {
-		MAJOR, _ = strconv.ParseUint(str, 10, 32)
+	if !staged {
+		return nil, status.Errorf(codes.FailedPrecondition, "volume %s is not staged at %s", req.GetVolumeId(), stagingPath)
 	}
 
-	if str, ok := partinfo.Properties["MINOR"]; ok {
-		MINOR, _ = strconv.ParseUint(str, 10, 32)
-	}
-	// Find lv and create a block device with it
-	//device := filepath.Join(DeviceDirectory, req.GetVolumeId())
-	err = s.createDeviceIfNeeded(device, uint32(MAJOR), uint32(MINOR))
-	if err != nil {
-		return nil, err
-	}
-
-	var mountOptions []string
+	mountOptions := []string{"bind"}
 	if req.GetReadonly() {
 		mountOptions = append(mountOptions, "ro")
 	}
 
-	for _, m := range mountOption.MountFlags {
+	for _, m := range req.GetVolumeCapability().GetMount().GetMountFlags() {
 		if m == "rw" && req.GetReadonly() {
 			return nil, status.Error(codes.InvalidArgument, "mount option \"rw\" is specified even though read only mode is specified")
 		}
-		mountOptions = append(mountOptions, m)
 	}
 
 	err = os.MkdirAll(req.GetTargetPath(), 0755)
@@ -383,34 +598,25 @@ func (s *nodeService) nodePublishRawFilesystemVolume(req *csi.NodePublishVolumeR
 		return nil, status.Errorf(codes.Internal, "mkdir failed: target=%s, error=%v", req.GetTargetPath(), err)
 	}
 
-	fsType, err := filesystem.DetectFilesystem(device)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "filesystem check failed: volume=%s, error=%v", req.GetVolumeId(), err)
-	}
-
-	if fsType != "" && fsType != mountOption.FsType {
-		return nil, status.Errorf(codes.Internal, "target device is already formatted with different filesystem: volume=%s, current=%s, new:%s", req.GetVolumeId(), fsType, mountOption.FsType)
-	}
-
 	mounted, err := filesystem.IsMounted(device, req.GetTargetPath())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "mount check failed: target=%s, error=%v", req.GetTargetPath(), err)
 	}
 
 	if !mounted {
-		log.Infof("mount %s %s %s %s", device, req.GetTargetPath(), mountOption.FsType, strings.Join(mountOptions, ","))
-		if err := s.mounter.FormatAndMount(device, req.GetTargetPath(), mountOption.FsType, mountOptions); err != nil {
-			return nil, status.Errorf(codes.Internal, "mount failed: volume=%s, error=%v", req.GetVolumeId(), err)
+		if err := s.checkSingleWriterMount(req, stagingPath); err != nil {
+			return nil, err
 		}
-		if err := os.Chmod(req.GetTargetPath(), 0777|os.ModeSetgid); err != nil {
-			return nil, status.Errorf(codes.Internal, "chmod 2777 failed: target=%s, error=%v", req.GetTargetPath(), err)
+		log.Infof("mount %s %s %s", stagingPath, req.GetTargetPath(), strings.Join(mountOptions, ","))
+		if err := s.mounter.Mount(stagingPath, req.GetTargetPath(), "", mountOptions); err != nil {
+			return nil, status.Errorf(codes.Internal, "mount failed: volume=%s, error=%v", req.GetVolumeId(), err)
 		}
 	}
 
 	log.Info("NodePublishVolume(fs) succeeded",
 		" volume_id ", req.GetVolumeId(),
-		" target_path ", req.GetTargetPath(),
-		" fstype ", mountOption.FsType)
+		" staging_target_path ", stagingPath,
+		" target_path ", req.GetTargetPath())
 
 	return &csi.NodePublishVolumeResponse{}, nil
 }
@@ -419,7 +625,7 @@ func (s *nodeService) nodePublishHostFilesystemVolume(req *csi.NodePublishVolume
 	// Check request
 	log.Info("NodePublishVolume device: HostFilesystem")
 	accessMode := req.GetVolumeCapability().GetAccessMode().GetMode()
-	if accessMode != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER {
+	if !isSupportedAccessMode(accessMode) {
 		modeName := csi.VolumeCapability_AccessMode_Mode_name[int32(accessMode)]
 		return nil, status.Errorf(codes.FailedPrecondition, "unsupported access mode: %s", modeName)
 	}
@@ -462,6 +668,9 @@ func (s *nodeService) nodePublishHostFilesystemVolume(req *csi.NodePublishVolume
 	}
 
 	if !mounted {
+		if err := s.checkSingleWriterMount(req, device); err != nil {
+			return nil, err
+		}
 		log.Infof("mount --bind %s %s", device, req.GetTargetPath())
 		if err = filesystem.BindMount(device, req.GetTargetPath()); err != nil {
 			return nil, status.Errorf(codes.Internal, "mount failed: volume=%s, error=%v", req.GetVolumeId(), err)
@@ -476,6 +685,53 @@ func (s *nodeService) nodePublishHostFilesystemVolume(req *csi.NodePublishVolume
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// checkSingleWriterMount the volume with SINGLE_NODE_SINGLE_WRITER can't be mounted to other target path
+func (s *nodeService) checkSingleWriterMount(req *csi.NodePublishVolumeRequest, source string) error {
+	if req.GetVolumeCapability().GetAccessMode().GetMode() != csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER {
+		return nil
+	}
+	refs, err := s.mounter.GetMountRefs(source)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get mount refs of %s: %v", source, err)
+	}
+	for _, ref := range refs {
+		if ref != req.GetTargetPath() {
+			return status.Errorf(codes.FailedPrecondition, "volume %s is SINGLE_NODE_SINGLE_WRITER and already published at %s", req.GetVolumeId(), ref)
+		}
+	}
+	return nil
+}
+
+// checkSingleWriterDevice the volume with SINGLE_NODE_SINGLE_WRITER can't be published as other device file,
+// kubelet publishes the block volume of each pod in the same directory
+func checkSingleWriterDevice(req *csi.NodePublishVolumeRequest, major, minor uint32) error {
+	if req.GetVolumeCapability().GetAccessMode().GetMode() != csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER {
+		return nil
+	}
+	target := req.GetTargetPath()
+	entries, err := os.ReadDir(filepath.Dir(target))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return status.Errorf(codes.Internal, "failed to read dir %s: %v", filepath.Dir(target), err)
+	}
+	for _, e := range entries {
+		p := filepath.Join(filepath.Dir(target), e.Name())
+		if p == filepath.Clean(target) {
+			continue
+		}
+		var stat unix.Stat_t
+		if err := filesystem.Stat(p, &stat); err != nil {
+			continue
+		}
+		if stat.Mode&unix.S_IFMT == unix.S_IFBLK && stat.Rdev == unix.Mkdev(major, minor) {
+			return status.Errorf(codes.FailedPrecondition, "volume %s is SINGLE_NODE_SINGLE_WRITER and already published at %s", req.GetVolumeId(), p)
+		}
+	}
+	return nil
+}
+
 func (s *nodeService) createDeviceIfNeeded(device string, major, minor uint32) error {
 	var stat unix.Stat_t
 	err := filesystem.Stat(device, &stat)
@@ -527,7 +783,6 @@ func (s *nodeService) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 		return nil, err
 	}
 	var device string
-	var backendDevice string = ""
 	switch lvr.Annotations[carina.VolumeManagerType] {
 	case carina.LvmVolumeType:
 		device = filepath.Join(DeviceDirectory, volID)
@@ -555,19 +810,16 @@ func (s *nodeService) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	bcacheDevice, err := s.getBcacheDevice(volID)
 	if err == nil && bcacheDevice != nil {
 		device = bcacheDevice.BcachePath
-		backendDevice = bcacheDevice.DevicePath
-		log.Infof("bcache volume cache device %s backend device %s", device, backendDevice)
+		log.Infof("bcache volume cache device %s backend device %s", device, bcacheDevice.DevicePath)
+	}
+	// the encrypted volume is mounted from the dm-crypt device
+	if filesystem.IsLuksOpen(volID) {
+		device = filesystem.LuksMapperPath(volID)
 	}
 
+	// the device file and bcache device are removed by NodeUnstageVolume
 	info, err := os.Stat(target)
 	if os.IsNotExist(err) {
-		if backendDevice != "" {
-			_ = s.dm.VolumeManager.DeleteBcache(backendDevice, "")
-		}
-		// target_path does not exist, but device for mount-type PV may still exist.
-		if lvr.Annotations[carina.VolumeManagerType] != carina.RawVolumeType {
-			_ = os.Remove(device)
-		}
 		return &csi.NodeUnpublishVolumeResponse{}, nil
 	} else if err != nil {
 		return nil, status.Errorf(codes.Internal, "stat failed for %s: %v", target, err)
@@ -575,26 +827,12 @@ func (s *nodeService) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 
 	// remove device file if target_path is device, unmount target_path otherwise
 	if info.IsDir() {
-		if backendDevice != "" {
-			unpublishResp, err := s.nodeUnpublishBFileSystemCacheVolume(req, device, backendDevice)
-			if err != nil {
-				return unpublishResp, err
-			}
-		} else {
-			unpublishResp, err := s.nodeUnpublishFilesystemVolume(req, device, lvr.Annotations[carina.VolumeManagerType])
-			if err != nil {
-				return unpublishResp, err
-			}
-		}
-		return &csi.NodeUnpublishVolumeResponse{}, nil
-	}
-	if backendDevice != "" {
-		return s.nodeUnpublishBlockCacheVolume(req, device, backendDevice)
+		return s.nodeUnpublishFilesystemVolume(req, device)
 	}
 	return s.nodeUnpublishBlockVolume(req, device)
 }
 
-func (s *nodeService) nodeUnpublishFilesystemVolume(req *csi.NodeUnpublishVolumeRequest, device string, deviceType string) (*csi.NodeUnpublishVolumeResponse, error) {
+func (s *nodeService) nodeUnpublishFilesystemVolume(req *csi.NodeUnpublishVolumeRequest, device string) (*csi.NodeUnpublishVolumeResponse, error) {
 	target := req.GetTargetPath()
 	mounted, err := filesystem.IsMounted(device, target)
 	if err != nil {
@@ -608,12 +846,6 @@ func (s *nodeService) nodeUnpublishFilesystemVolume(req *csi.NodeUnpublishVolume
 	if err = os.RemoveAll(target); err != nil {
 		return nil, status.Errorf(codes.Internal, "remove dir failed for %s: error=%v", target, err)
 	}
-	if deviceType != carina.RawVolumeType {
-		err = os.Remove(device)
-		if err != nil && !os.IsNotExist(err) {
-			return nil, status.Errorf(codes.Internal, "remove device failed for %s: error=%v", device, err)
-		}
-	}
 	log.Info("NodeUnpublishVolume(fs) is succeeded",
 		" volume_id ", req.GetVolumeId(),
 		" target_path ", target)
@@ -631,46 +863,6 @@ func (s *nodeService) nodeUnpublishBlockVolume(req *csi.NodeUnpublishVolumeReque
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
-func (s *nodeService) nodeUnpublishBFileSystemCacheVolume(req *csi.NodeUnpublishVolumeRequest, device, backendDevice string) (*csi.NodeUnpublishVolumeResponse, error) {
-	target := req.GetTargetPath()
-	mounted, err := filesystem.IsMounted(device, target)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "mount check failed: target=%s, error=%v", target, err)
-	}
-	if mounted {
-		if err = s.mounter.Unmount(target); err != nil {
-			return nil, status.Errorf(codes.Internal, "unmount failed for %s: error=%v", target, err)
-		}
-	}
-	if err = os.RemoveAll(target); err != nil {
-		return nil, status.Errorf(codes.Internal, "remove dir failed for %s: error=%v", target, err)
-	}
-	// delete bcache device
-	err = s.dm.VolumeManager.DeleteBcache(backendDevice, "")
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "remove device failed for %s: error=%v", device, err)
-	}
-	log.Info("NodeUnpublishVolume(fs) is succeeded",
-		" volume_id ", req.GetVolumeId(),
-		" target_path ", target)
-	return &csi.NodeUnpublishVolumeResponse{}, nil
-}
-
-func (s *nodeService) nodeUnpublishBlockCacheVolume(req *csi.NodeUnpublishVolumeRequest, device, backendDevice string) (*csi.NodeUnpublishVolumeResponse, error) {
-	if err := os.Remove(req.GetTargetPath()); err != nil {
-		return nil, status.Errorf(codes.Internal, "remove failed for %s: error=%v", req.GetTargetPath(), err)
-	}
-	// delete bcache device
-	err := s.dm.VolumeManager.DeleteBcache(backendDevice, "")
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "remove device failed for %s: error=%v", device, err)
-	}
-	log.Info("NodeUnpublishVolume(block) is succeeded",
-		" volume_id ", req.GetVolumeId(),
-		" target_path ", req.GetTargetPath())
-	return &csi.NodeUnpublishVolumeResponse{}, nil
-}
-
 func (s *nodeService) nodeUnpublishHostVolume(req *csi.NodeUnpublishVolumeRequest, deviceGroup string) (*csi.NodeUnpublishVolumeResponse, error) {
 	target := req.GetTargetPath()
 	workDir := carina.DefaultHostPath
@@ -740,7 +932,8 @@ func (s *nodeService) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVo
 			return nil, status.Errorf(codes.Internal, "seek on %s was failed: %v", p, err)
 		}
 		return &csi.NodeGetVolumeStatsResponse{
-			Usage: []*csi.VolumeUsage{{Total: pos, Unit: csi.VolumeUsage_BYTES}},
+			Usage:           []*csi.VolumeUsage{{Total: pos, Unit: csi.VolumeUsage_BYTES}},
+			VolumeCondition: s.getVolumeCondition(ctx, volID),
 		}, nil
 	}
 
@@ -755,11 +948,25 @@ func (s *nodeService) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVo
 
 	var usage []*csi.VolumeUsage
 	if sfs.Blocks > 0 {
+		total := int64(sfs.Blocks) * sfs.Frsize
+		used := int64(sfs.Blocks-sfs.Bfree) * sfs.Frsize
+		available := int64(sfs.Bavail) * sfs.Frsize
+		// the host volume is limited by project quota, statfs reports the whole filesystem of it
+		if quotaUsed, quotaLimit, err := hostpath.GetQuota(p); err == nil && quotaLimit > 0 {
+			total = int64(quotaLimit)
+			used = int64(quotaUsed)
+			if available > total-used {
+				available = total - used
+			}
+			if available < 0 {
+				available = 0
+			}
+		}
 		usage = append(usage, &csi.VolumeUsage{
 			Unit:      csi.VolumeUsage_BYTES,
-			Total:     int64(sfs.Blocks) * sfs.Frsize,
-			Used:      int64(sfs.Blocks-sfs.Bfree) * sfs.Frsize,
-			Available: int64(sfs.Bavail) * sfs.Frsize,
+			Total:     total,
+			Used:      used,
+			Available: available,
 		})
 	}
 	if sfs.Files > 0 {
@@ -770,7 +977,20 @@ func (s *nodeService) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVo
 			Available: int64(sfs.Ffree),
 		})
 	}
-	return &csi.NodeGetVolumeStatsResponse{Usage: usage}, nil
+	return &csi.NodeGetVolumeStatsResponse{Usage: usage, VolumeCondition: s.getVolumeCondition(ctx, volID)}, nil
+}
+
+// getVolumeCondition checks the local device of the volume, such as inactive lv, missing pv, detached bcache and missing partition
+func (s *nodeService) getVolumeCondition(ctx context.Context, volumeID string) *csi.VolumeCondition {
+	lvr, err := s.k8sLVService.GetLogicVolumeByVolumeId(ctx, volumeID)
+	if err != nil {
+		return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf("failed to get LogicVolume of %s: %v", volumeID, err)}
+	}
+	abnormal, message := s.dm.VolumeCondition(lvr)
+	if !abnormal {
+		message = "volume is healthy"
+	}
+	return &csi.VolumeCondition{Abnormal: abnormal, Message: message}
 }
 
 func (s *nodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
@@ -808,6 +1028,14 @@ func (s *nodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		return nil, status.Errorf(codes.Internal, "stat failed for %s: %v", vpath, err)
 	}
 
+	// grow the dm-crypt device before the filesystem on it
+	encrypted := filesystem.IsLuksOpen(vid)
+	if encrypted {
+		if err := filesystem.NewLuks(&s.mounter).Resize(vid); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to resize encrypted device of %s: %v", vid, err)
+		}
+	}
+
 	isBlock := !info.IsDir()
 	if isBlock {
 		log.Info("NodeExpandVolume(block) is skipped",
@@ -856,6 +1084,10 @@ func (s *nodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		return nil, status.Errorf(codes.InvalidArgument, "Create with no support type ")
 	}
 
+	if encrypted {
+		device = filesystem.LuksMapperPath(vid)
+	}
+
 	args := []string{"-o", "source", "--noheadings", "--target", req.GetVolumePath()}
 	output, err := s.mounter.Exec.Command(findmntCmd, args...).Output()
 	if err != nil {
@@ -888,8 +1120,11 @@ func (s *nodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 
 func (s *nodeService) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
 	capabilities := []csi.NodeServiceCapability_RPC_Type{
+		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
 		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
 		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+		csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
 	}
 
 	csiCaps := make([]*csi.NodeServiceCapability, len(capabilities))
@@ -909,13 +1144,25 @@ func (s *nodeService) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilit
 }
 
 func (s *nodeService) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	nodeDiskSelectGroup := s.dm.GetNodeDiskSelectGroup()
+	if nodeDiskSelectGroup == nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to get device groups of node %s", s.dm.NodeName)
+	}
+	segments, err := s.dm.GetNodeTopology()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to get topology of node %s: %v", s.dm.NodeName, err)
+	}
+	segments[carina.TopologyNodeKey] = s.dm.NodeName
+	// every node exposes the segments of all device groups, the external-provisioner requires the same topology keys on the nodes
+	for _, ds := range configuration.DiskSelector() {
+		_, ok := nodeDiskSelectGroup[ds.Name]
+		segments[carina.TopologyDeviceGroupKeyPrefix+ds.Name] = strconv.FormatBool(ok)
+	}
 	return &csi.NodeGetInfoResponse{
 		NodeId:            s.dm.NodeName,
 		MaxVolumesPerNode: 1000,
 		AccessibleTopology: &csi.Topology{
-			Segments: map[string]string{
-				carina.TopologyNodeKey: s.dm.NodeName,
-			},
+			Segments: segments,
 		},
 	}, nil
 }
@@ -938,6 +1185,38 @@ func (s *nodeService) getPartitionFromContext(deviceGroup, volumeID string) (dis
 	return s.dm.Partition.GetPartition(utils.PartitionName(volumeID), deviceGroup)
 }
 
+// getRawDevice returns the partition device of raw volume and creates its device file if needed
+func (s *nodeService) getRawDevice(deviceGroup, volumeID string) (string, error) {
+	partition, err := s.getPartitionFromContext(deviceGroup, volumeID)
+	if err != nil {
+		return "", err
+	}
+	if partition.Name == "" {
+		return "", status.Errorf(codes.NotFound, "failed to find partition: %s", utils.PartitionName(volumeID))
+	}
+	disk, err := s.dm.Partition.ScanDisk(deviceGroup)
+	if err != nil {
+		return "", err
+	}
+	device := linux.GetPartitionKname(disk.Path, partition.Number)
+	partinfo, err := linux.GetUdevInfo(device)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to get partinfo %s", err)
+	}
+	var MAJOR uint64
+	var MINOR uint64
+	if str, ok := partinfo.Properties["MAJOR"]; ok {
+		MAJOR, _ = strconv.ParseUint(str, 10, 32)
+	}
+	if str, ok := partinfo.Properties["MINOR"]; ok {
+		MINOR, _ = strconv.ParseUint(str, 10, 32)
+	}
+	if err = s.createDeviceIfNeeded(device, uint32(MAJOR), uint32(MINOR)); err != nil {
+		return "", err
+	}
+	return device, nil
+}
+
 func (s *nodeService) getBcacheDevice(volumeID string) (*types.BcacheDeviceInfo, error) {
 	currentDiskSelector := configuration.DiskSelector()
 	var diskClass = []string{}
@@ -962,22 +1241,10 @@ func (s *nodeService) getBcacheDevice(volumeID string) (*types.BcacheDeviceInfo,
 }
 
 func (s *nodeService) nodePublishBcacheVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
-
-	volumeContext := req.GetVolumeContext()
-
-	backendDevice := volumeContext[carina.VolumeDevicePath]
-	cacheDevice := volumeContext[carina.VolumeCacheDevicePath]
-	block := volumeContext[carina.VolumeCacheBlock]
-	bucket := volumeContext[carina.VolumeCacheBucket]
-	cachePolicy := volumeContext[carina.VolumeCachePolicy]
-
-	if backendDevice == "" || cacheDevice == "" {
-		return nil, status.Errorf(codes.FailedPrecondition, "carina.storage.io/path %s carina.storage.io/cache/path %s, can not be empty", backendDevice, cacheDevice)
-	}
-
-	cacheDeviceInfo, err := s.dm.VolumeManager.CreateBcache(backendDevice, cacheDevice, block, bucket, cachePolicy)
+	backendDevice := req.GetVolumeContext()[carina.VolumeDevicePath]
+	cacheDeviceInfo, err := s.getActiveBcacheDevice(backendDevice)
 	if err != nil {
-		return nil, err
+		return nil, status.Errorf(codes.FailedPrecondition, "bcache device of volume %s is not staged: %v", req.GetVolumeId(), err)
 	}
 
 	isBlockVol := req.GetVolumeCapability().GetBlock() != nil
@@ -985,7 +1252,7 @@ func (s *nodeService) nodePublishBcacheVolume(ctx context.Context, req *csi.Node
 	if isBlockVol {
 		_, err = s.nodePublishBcacheBlockVolume(req, cacheDeviceInfo)
 	} else if isFsVol {
-		_, err = s.nodePublishBcacheFilesystemVolume(req, cacheDeviceInfo)
+		_, err = s.nodePublishStagedFilesystemVolume(req, cacheDeviceInfo.BcachePath)
 	}
 	if err != nil {
 		return nil, err
@@ -994,102 +1261,21 @@ func (s *nodeService) nodePublishBcacheVolume(ctx context.Context, req *csi.Node
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
-func (s *nodeService) nodePublishBcacheBlockVolume(req *csi.NodePublishVolumeRequest, cacheDeviceInfo *types.BcacheDeviceInfo) (*csi.NodePublishVolumeResponse, error) {
-	// Find lv and create a block device with it
-	var stat unix.Stat_t
-	target := req.GetTargetPath()
-	err := filesystem.Stat(target, &stat)
-	switch err {
-	case nil:
-		if stat.Rdev == unix.Mkdev(cacheDeviceInfo.KernelMajor, cacheDeviceInfo.KernelMinor) && stat.Mode&devicePermission == devicePermission {
-			return &csi.NodePublishVolumeResponse{}, nil
-		}
-		if err = os.Remove(target); err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to remove %s", target)
-		}
-	case unix.ENOENT:
-	default:
-		return nil, status.Errorf(codes.Internal, "failed to stat: %v", err)
+// getActiveBcacheDevice returns the bcache device registered on the backend device
+func (s *nodeService) getActiveBcacheDevice(backendDevice string) (*types.BcacheDeviceInfo, error) {
+	if backendDevice == "" {
+		return nil, errors.New("backend device is empty")
 	}
-
-	err = os.MkdirAll(path.Dir(target), 0755)
+	info, err := s.dm.VolumeManager.BcacheDeviceInfo(backendDevice)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "mkdir failed: target=%s, error=%v", path.Dir(target), err)
+		return nil, err
 	}
-
-	devno := unix.Mkdev(cacheDeviceInfo.KernelMajor, cacheDeviceInfo.KernelMinor)
-	if err := filesystem.Mknod(target, devicePermission, int(devno)); err != nil {
-		return nil, status.Errorf(codes.Internal, "mknod failed for %s: error=%v", target, err)
+	if !strings.HasPrefix(info.Name, "bcache") {
+		return nil, fmt.Errorf("no bcache device on %s", backendDevice)
 	}
-
-	log.Info("NodePublishVolume(block) succeeded",
-		" volume_id ", req.GetVolumeId(),
-		" target_path ", target)
-	return &csi.NodePublishVolumeResponse{}, nil
+	return info, nil
 }
 
-func (s *nodeService) nodePublishBcacheFilesystemVolume(req *csi.NodePublishVolumeRequest, cacheDeviceInfo *types.BcacheDeviceInfo) (*csi.NodePublishVolumeResponse, error) {
-	// Check request
-	mountOption := req.GetVolumeCapability().GetMount()
-	if mountOption.FsType == "" {
-		mountOption.FsType = "ext4"
-	}
-	accessMode := req.GetVolumeCapability().GetAccessMode().GetMode()
-	if accessMode != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER {
-		modeName := csi.VolumeCapability_AccessMode_Mode_name[int32(accessMode)]
-		return nil, status.Errorf(codes.FailedPrecondition, "unsupported access mode: %s", modeName)
-	}
-
-	var mountOptions []string
-	if req.GetReadonly() {
-		mountOptions = append(mountOptions, "ro")
-	}
-
-	for _, m := range mountOption.MountFlags {
-		if m == "rw" && req.GetReadonly() {
-			return nil, status.Error(codes.InvalidArgument, "mount option \"rw\" is specified even though read only mode is specified")
-		}
-		mountOptions = append(mountOptions, m)
-	}
-
-	err := os.MkdirAll(req.GetTargetPath(), 0755)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "mkdir failed: target=%s, error=%v", req.GetTargetPath(), err)
-	}
-
-	fsType, err := filesystem.DetectFilesystem(cacheDeviceInfo.BcachePath)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "filesystem check failed: volume=%s, error=%v", req.GetVolumeId(), err)
-	}
-
-	if fsType != "" && fsType != mountOption.FsType {
-		return nil, status.Errorf(codes.Internal, "target device is already formatted with different filesystem: volume=%s, current=%s, new:%s", req.GetVolumeId(), fsType, mountOption.FsType)
-	}
-
-	mounted, err := filesystem.IsMounted(cacheDeviceInfo.BcachePath, req.GetTargetPath())
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "mount check failed: target=%s, error=%v", req.GetTargetPath(), err)
-	}
-
-	if !mounted {
-		log.Infof("mount %s %s %s %s", cacheDeviceInfo.BcachePath, req.GetTargetPath(), mountOption.FsType, strings.Join(mountOptions, ","))
-		if err := s.mounter.FormatAndMount(cacheDeviceInfo.BcachePath, req.GetTargetPath(), mountOption.FsType, mountOptions); err != nil {
-			return nil, status.Errorf(codes.Internal, "mount failed: volume=%s, error=%v", req.GetVolumeId(), err)
-		}
-		if err := os.Chmod(req.GetTargetPath(), 0777|os.ModeSetgid); err != nil {
-			return nil, status.Errorf(codes.Internal, "chmod 2777 failed: target=%s, error=%v", req.GetTargetPath(), err)
-		}
-
-		r := filesystem.NewResizeFs(&s.mounter)
-		if _, err := r.Resize(cacheDeviceInfo.BcachePath, req.GetTargetPath()); err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to resize filesystem %s (mounted at: %s): %v", cacheDeviceInfo.BcachePath, req.GetTargetPath(), err)
-		}
-	}
-
-	log.Info("NodePublishVolume(fs) succeeded",
-		" volume_id ", req.GetVolumeId(),
-		" target_path ", req.GetTargetPath(),
-		" fstype ", mountOption.FsType)
-
-	return &csi.NodePublishVolumeResponse{}, nil
+func (s *nodeService) nodePublishBcacheBlockVolume(req *csi.NodePublishVolumeRequest, cacheDeviceInfo *types.BcacheDeviceInfo) (*csi.NodePublishVolumeResponse, error) {
+	return s.nodePublishBlockDevice(req, cacheDeviceInfo.KernelMajor, cacheDeviceInfo.KernelMinor)
 }
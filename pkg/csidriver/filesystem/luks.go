@@ -0,0 +1,121 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carina-io/carina/utils/log"
+	"k8s.io/mount-utils"
+)
+
+const (
+	cryptsetupCmd = "cryptsetup"
+	// luksMapperPrefix the dm-crypt devices of carina volumes are /dev/mapper/luks-<volume id>
+	luksMapperPrefix = "luks-"
+	mapperDirectory  = "/dev/mapper"
+)
+
+// Luks Provides support for dm-crypt/LUKS encrypted devices
+type Luks struct {
+	mounter *mount.SafeFormatAndMount
+}
+
+// NewLuks returns new instance of luks
+func NewLuks(mounter *mount.SafeFormatAndMount) *Luks {
+	return &Luks{mounter: mounter}
+}
+
+// LuksMapperName returns the dm-crypt device name of the volume
+func LuksMapperName(volumeID string) string {
+	return luksMapperPrefix + volumeID
+}
+
+// LuksMapperPath returns the dm-crypt device path of the volume
+func LuksMapperPath(volumeID string) string {
+	return filepath.Join(mapperDirectory, LuksMapperName(volumeID))
+}
+
+// IsLuksOpen returns true if the dm-crypt device of the volume exists
+func IsLuksOpen(volumeID string) bool {
+	_, err := os.Stat(LuksMapperPath(volumeID))
+	return err == nil
+}
+
+// Open opens the LUKS device as /dev/mapper/luks-<volume id>, the device is formatted with LUKS2 at first use.
+// The volume key is kept in the dm-crypt table instead of the kernel keyring, so the device can be resized without passphrase.
+func (l *Luks) Open(device, volumeID, passphrase string) (string, error) {
+	mapperPath := LuksMapperPath(volumeID)
+	if IsLuksOpen(volumeID) {
+		return mapperPath, nil
+	}
+
+	fsType, err := DetectFilesystem(device)
+	if err != nil {
+		return "", err
+	}
+	switch fsType {
+	case "crypto_LUKS":
+	case "":
+		log.Infof("luksFormat %s", device)
+		if output, err := l.run(passphrase, "luksFormat", "--type", "luks2", "--batch-mode", "--key-file=-", device); err != nil {
+			return "", fmt.Errorf("luksFormat %s failed: %v. output: %s", device, err, output)
+		}
+	default:
+		// never encrypt the device with data, the volume may be created without encryption
+		return "", fmt.Errorf("device %s is already formatted with %s, can not be encrypted", device, fsType)
+	}
+
+	log.Infof("luksOpen %s %s", device, LuksMapperName(volumeID))
+	if output, err := l.run(passphrase, "luksOpen", "--disable-keyring", "--key-file=-", device, LuksMapperName(volumeID)); err != nil {
+		return "", fmt.Errorf("luksOpen %s failed: %v. output: %s", device, err, output)
+	}
+	return mapperPath, nil
+}
+
+// Close closes the dm-crypt device of the volume
+func (l *Luks) Close(volumeID string) error {
+	if !IsLuksOpen(volumeID) {
+		return nil
+	}
+	log.Infof("luksClose %s", LuksMapperName(volumeID))
+	if output, err := l.run("", "luksClose", LuksMapperName(volumeID)); err != nil {
+		return fmt.Errorf("luksClose %s failed: %v. output: %s", LuksMapperName(volumeID), err, output)
+	}
+	return nil
+}
+
+// Resize grows the dm-crypt device of the volume to the size of the underlying device
+func (l *Luks) Resize(volumeID string) error {
+	log.Infof("cryptsetup resize %s", LuksMapperName(volumeID))
+	if output, err := l.run("", "resize", LuksMapperName(volumeID)); err != nil {
+		return fmt.Errorf("resize of %s failed: %v. output: %s", LuksMapperName(volumeID), err, output)
+	}
+	return nil
+}
+
+func (l *Luks) run(passphrase string, args ...string) (string, error) {
+	cmd := l.mounter.Exec.Command(cryptsetupCmd, args...)
+	if passphrase != "" {
+		cmd.SetStdin(strings.NewReader(passphrase))
+	}
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
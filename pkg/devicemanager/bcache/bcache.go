@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"github.com/carina-io/carina/pkg/devicemanager/types"
 	"github.com/carina-io/carina/utils/exec"
+	"strings"
 )
 
 type BcacheImplement struct {
@@ -97,3 +98,20 @@ func (bi *BcacheImplement) SetCacheMode(bcache string, cachePolicy string) error
 	cmd := fmt.Sprintf("echo %s > /sys/block/%s/bcache/cache_mode", cachePolicy, bcache)
 	return bi.Executor.ExecuteCommand("/bin/sh", "-c", cmd)
 }
+
+// GetCacheMode cat /sys/block/bcache0/bcache/cache_mode
+func (bi *BcacheImplement) GetCacheMode(bcache string) (string, error) {
+	cacheMode, err := bi.Executor.ExecuteCommandWithOutput("cat", fmt.Sprintf("/sys/block/%s/bcache/cache_mode", bcache))
+	if err != nil {
+		return "", err
+	}
+	return ParseCacheMode(cacheMode), nil
+}
+
+func (bi *BcacheImplement) GetBcacheState(bcache string) (string, error) {
+	state, err := bi.Executor.ExecuteCommandWithOutput("cat", fmt.Sprintf("/sys/block/%s/bcache/state", bcache))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(state), nil
+}
@@ -31,4 +31,8 @@ type Bcache interface {
 	ShowDevice(dev string) (*types.BcacheDeviceInfo, error)
 
 	SetCacheMode(bcache string, cachePolicy string) error
+	// GetCacheMode returns the active cache mode of bcache device, writethrough/writeback/writearound/none
+	GetCacheMode(bcache string) (string, error)
+	// GetBcacheState returns the state of bcache device, no cache/clean/dirty/inconsistent
+	GetBcacheState(bcache string) (string, error)
 }
@@ -116,3 +116,16 @@ func parseDevice(deviceInfo string) *types.BcacheDeviceInfo {
 	resp.BcachePath = "/dev/" + resp.Name
 	return resp
 }
+
+/*
+ParseCacheMode 当前的缓存模式在方括号中
+writethrough [writeback] writearound none
+*/
+func ParseCacheMode(cacheMode string) string {
+	for _, mode := range strings.Fields(cacheMode) {
+		if strings.HasPrefix(mode, "[") && strings.HasSuffix(mode, "]") {
+			return strings.Trim(mode, "[]")
+		}
+	}
+	return ""
+}
@@ -15,9 +15,9 @@ import (
 )
 
 type HostPath interface {
-	CreateVolume(name, deviceGroup string) error
+	CreateVolume(name, deviceGroup string, size uint64) error
 	DeleteVolume(name, deviceGroup string) error
-	ResizeVolume(name, deviceGroup string) error
+	ResizeVolume(name, deviceGroup string, size uint64) error
 }
 
 const (
@@ -28,28 +28,19 @@ type LocalHostImplement struct {
 	Mutex *mutx.GlobalLocks
 }
 
-func (v *LocalHostImplement) CreateVolume(name, deviceGroup string) error {
+// CreateVolume creates the directory of host volume and limits its space to size bytes by project quota,
+// ErrQuotaNotSupported is returned after the directory is created if the filesystem does not enable project quota
+func (v *LocalHostImplement) CreateVolume(name, deviceGroup string, size uint64) error {
 	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
 		log.Info("wait other task release mutex, please retry...")
 		return errors.New("get global mutex failed")
 	}
 	defer v.Mutex.Release(VOLUMEMUTEX)
 
-	workDir := carina.DefaultHostPath
-	currentDiskSelector := configuration.DiskSelector()
-	for _, v := range currentDiskSelector {
-		if v.Name == deviceGroup && strings.ToLower(v.Policy) == carina.HostVolumeType {
-			if v.Re != nil && len(v.Re) > 0 {
-				if !filepath.IsAbs(v.Re[0]) {
-					return errors.New(fmt.Sprint("path must be absolute: %s", v.Re[0]))
-				}
-				workDir = v.Re[0]
-				break
-			}
-		}
+	device, err := volumePath(name, deviceGroup)
+	if err != nil {
+		return err
 	}
-	name = carina.HostPrefix + name
-	device := filepath.Join(workDir, name)
 
 	if !utils.DirExists(device) {
 		if err := os.MkdirAll(device, 0777); err != nil {
@@ -59,7 +50,7 @@ func (v *LocalHostImplement) CreateVolume(name, deviceGroup string) error {
 			return err
 		}
 	}
-	return nil
+	return SetQuota(device, size)
 }
 
 func (v *LocalHostImplement) DeleteVolume(name, deviceGroup string) error {
@@ -69,24 +60,16 @@ func (v *LocalHostImplement) DeleteVolume(name, deviceGroup string) error {
 	}
 	defer v.Mutex.Release(VOLUMEMUTEX)
 
-	workDir := carina.DefaultHostPath
-	currentDiskSelector := configuration.DiskSelector()
-	for _, v := range currentDiskSelector {
-		if v.Name == deviceGroup && strings.ToLower(v.Policy) == carina.HostVolumeType {
-			if v.Re != nil && len(v.Re) > 0 {
-				if !filepath.IsAbs(v.Re[0]) {
-					return errors.New(fmt.Sprint("path must be absolute: %s", v.Re[0]))
-				}
-				workDir = v.Re[0]
-				break
-			}
-		}
+	device, err := volumePath(name, deviceGroup)
+	if err != nil {
+		return err
 	}
-	name = carina.HostPrefix + name
-	device := filepath.Join(workDir, name)
 
 	if utils.DirExists(device) {
 		_ = filesystem.UnbindMount(device)
+		if err := ClearQuota(device); err != nil && !errors.Is(err, ErrQuotaNotSupported) {
+			log.Warnf("failed to clear quota of %s: %v", device, err)
+		}
 		if err := os.RemoveAll(device); err != nil {
 			return err
 		}
@@ -94,11 +77,38 @@ func (v *LocalHostImplement) DeleteVolume(name, deviceGroup string) error {
 	return nil
 }
 
-func (v *LocalHostImplement) ResizeVolume(name, deviceGroup string) error {
+// ResizeVolume updates the project quota of host volume to size bytes
+func (v *LocalHostImplement) ResizeVolume(name, deviceGroup string, size uint64) error {
 	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
 		log.Info("wait other task release mutex, please retry...")
 		return errors.New("get global mutex failed")
 	}
 	defer v.Mutex.Release(VOLUMEMUTEX)
-	return nil
+
+	device, err := volumePath(name, deviceGroup)
+	if err != nil {
+		return err
+	}
+	if !utils.DirExists(device) {
+		return fmt.Errorf("host volume %s is not found", device)
+	}
+	return SetQuota(device, size)
+}
+
+// volumePath returns the directory of host volume under the path of its device group
+func volumePath(name, deviceGroup string) (string, error) {
+	workDir := carina.DefaultHostPath
+	currentDiskSelector := configuration.DiskSelector()
+	for _, v := range currentDiskSelector {
+		if v.Name == deviceGroup && strings.ToLower(v.Policy) == carina.HostVolumeType {
+			if v.Re != nil && len(v.Re) > 0 {
+				if !filepath.IsAbs(v.Re[0]) {
+					return "", fmt.Errorf("path must be absolute: %s", v.Re[0])
+				}
+				workDir = v.Re[0]
+				break
+			}
+		}
+	}
+	return filepath.Join(workDir, carina.HostPrefix+name), nil
 }
@@ -0,0 +1,229 @@
+package hostpath
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The directory of each host volume is assigned a project id, and the block hard limit of the project is set to
+// the size of the volume. Both xfs mounted with prjquota and ext4 with project feature and quota enabled are supported.
+
+const (
+	fsIocFsgetxattr    = 0x801c581f
+	fsIocFssetxattr    = 0x401c5820
+	fsXflagProjinherit = 0x00000200
+
+	qGetquota    = 0x800007
+	qSetquota    = 0x800008
+	prjQuota     = 2
+	qifBlimits   = 1
+	qifDqblksize = 1024
+
+	// projectIdBase the project ids of host volumes start from here, the ids below are left to the administrator
+	projectIdBase = 1 << 20
+)
+
+// ErrQuotaNotSupported the filesystem of the host volume does not enable project quota
+var ErrQuotaNotSupported = errors.New("project quota is not enabled on the filesystem")
+
+// fsxattr struct fsxattr of linux/fs.h
+type fsxattr struct {
+	Xflags     uint32
+	Extsize    uint32
+	Nextents   uint32
+	Projid     uint32
+	Cowextsize uint32
+	Pad        [8]byte
+}
+
+// dqblk struct if_dqblk of linux/quota.h
+type dqblk struct {
+	Bhardlimit uint64
+	Bsoftlimit uint64
+	Curspace   uint64
+	Ihardlimit uint64
+	Isoftlimit uint64
+	Curinodes  uint64
+	Btime      uint64
+	Itime      uint64
+	Valid      uint32
+}
+
+// SetQuota limits the space of the directory to size bytes, a project id is assigned to the directory at first
+func SetQuota(dir string, size uint64) error {
+	device, err := quotaDevice(dir)
+	if err != nil {
+		return err
+	}
+	projectId, err := getProjectId(dir)
+	if err != nil {
+		return err
+	}
+	if projectId == 0 {
+		if projectId, err = nextProjectId(filepath.Dir(dir)); err != nil {
+			return err
+		}
+		if err = setProjectId(dir, projectId); err != nil {
+			return err
+		}
+	}
+	quota := dqblk{
+		Bhardlimit: (size + qifDqblksize - 1) / qifDqblksize,
+		Valid:      qifBlimits,
+	}
+	return quotactl(qSetquota, device, projectId, &quota)
+}
+
+// ClearQuota removes the limit of the project of the directory
+func ClearQuota(dir string) error {
+	device, err := quotaDevice(dir)
+	if err != nil {
+		return err
+	}
+	projectId, err := getProjectId(dir)
+	if err != nil || projectId == 0 {
+		return err
+	}
+	return quotactl(qSetquota, device, projectId, &dqblk{Valid: qifBlimits})
+}
+
+// GetQuota returns the used bytes and the limit bytes of the directory, the limit is 0 if the directory has no quota
+func GetQuota(dir string) (uint64, uint64, error) {
+	projectId, err := getProjectId(dir)
+	if err != nil || projectId == 0 {
+		return 0, 0, err
+	}
+	device, err := quotaDevice(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	quota := dqblk{}
+	if err = quotactl(qGetquota, device, projectId, &quota); err != nil {
+		return 0, 0, err
+	}
+	return quota.Curspace, quota.Bhardlimit * qifDqblksize, nil
+}
+
+func getProjectId(dir string) (uint32, error) {
+	attr, err := fsGetxattr(dir)
+	if err != nil {
+		return 0, err
+	}
+	return attr.Projid, nil
+}
+
+// setProjectId the files created in the directory inherit its project id
+func setProjectId(dir string, projectId uint32) error {
+	attr, err := fsGetxattr(dir)
+	if err != nil {
+		return err
+	}
+	attr.Projid = projectId
+	attr.Xflags |= fsXflagProjinherit
+	return fsioctl(dir, fsIocFssetxattr, &attr)
+}
+
+// nextProjectId returns the project id larger than all the volumes in the work directory
+func nextProjectId(workDir string) (uint32, error) {
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return 0, err
+	}
+	var projectId uint32 = projectIdBase
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		id, err := getProjectId(filepath.Join(workDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		if id >= projectId {
+			projectId = id + 1
+		}
+	}
+	return projectId, nil
+}
+
+func fsGetxattr(dir string) (fsxattr, error) {
+	attr := fsxattr{}
+	err := fsioctl(dir, fsIocFsgetxattr, &attr)
+	return attr, err
+}
+
+func fsioctl(dir string, request uintptr, attr *fsxattr) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), request, uintptr(unsafe.Pointer(attr)))
+	switch errno {
+	case 0:
+		return nil
+	case unix.ENOTTY, unix.EOPNOTSUPP, unix.EINVAL:
+		return ErrQuotaNotSupported
+	default:
+		return fmt.Errorf("ioctl %s failed: %v", dir, errno)
+	}
+}
+
+func quotactl(cmd int, device string, projectId uint32, quota *dqblk) error {
+	special, err := unix.BytePtrFromString(device)
+	if err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_QUOTACTL, uintptr(cmd<<8|prjQuota), uintptr(unsafe.Pointer(special)),
+		uintptr(projectId), uintptr(unsafe.Pointer(quota)), 0, 0)
+	switch errno {
+	case 0:
+		return nil
+	case unix.ESRCH, unix.ENOSYS, unix.EOPNOTSUPP, unix.EINVAL:
+		return ErrQuotaNotSupported
+	default:
+		return fmt.Errorf("quotactl %s project %d failed: %v", device, projectId, errno)
+	}
+}
+
+// quotaDevice returns the block device of the filesystem the directory belongs to
+func quotaDevice(dir string) (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(dir, &stat); err != nil {
+		return "", err
+	}
+	devNumber := fmt.Sprintf("%d:%d", unix.Major(uint64(stat.Dev)), unix.Minor(uint64(stat.Dev)))
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[2] != devNumber {
+			continue
+		}
+		for i := 6; i+2 < len(fields); i++ {
+			if fields[i] != "-" {
+				continue
+			}
+			if fields[i+1] != "xfs" && fields[i+1] != "ext4" {
+				return "", ErrQuotaNotSupported
+			}
+			return fields[i+2], nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("failed to find the device of %s", dir)
+}
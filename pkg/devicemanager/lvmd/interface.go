@@ -32,6 +32,16 @@ type Lvm2 interface {
 	// PVScan 扫描pv加入cache,在服务启动时执行
 	PVScan(dev string) error
 	PVDisplay(dev string) (*api.PVInfo, error)
+	// PVTags 返回卷组中每个pv的标签
+	PVTags(vg string) (map[string][]string, error)
+	PVAddTag(dev, tag string) error
+	PVDelTag(dev, tag string) error
+	// PVChangeAllocatable 禁止或允许在pv上分配新的空间
+	PVChangeAllocatable(dev string, allocatable bool) error
+	// PVMove 后台迁移pv上的数据到卷组中的其他pv
+	PVMove(dev string) error
+	// PVMoveProgress 返回卷组中正在迁移的pv及其迁移进度百分比
+	PVMoveProgress(vg string) (map[string]string, error)
 
 	VGCheck(vg string) error
 	VGCreate(vg string, tags, pvs []string) error
@@ -50,14 +60,31 @@ type Lvm2 interface {
 	DeleteThinPool(lv, vg string) error
 	LVCreateFromPool(lv, thin, vg string, size uint64) error
 	LVCreateFromVG(lv, vg string, size uint64, tags []string, stripe uint, stripeSize string) error
+	// LVCreateRaid 创建raid1/raid10卷，镜像分布在不同的pv上
+	LVCreateRaid(lv, vg, raidType string, size uint64, mirrors, stripe uint, stripeSize string, tags []string) error
+	// LVRepair 使用卷组中的剩余空间替换raid卷中缺失的镜像
+	LVRepair(lv, vg string) error
+	// LVCreateOnPVs 在指定的pv上创建卷，segType为空时创建线性卷，pvs为空时由lvm选择pv
+	LVCreateOnPVs(lv, vg, segType string, size uint64, pvs []string) error
+	// LVAttachCache 将缓存卷挂载到数据卷上，cacheType为cache或者writecache
+	LVAttachCache(lv, cacheLv, vg, cacheType, cacheMode string) error
+	// LVUncache 刷新缓存数据后移除数据卷上的缓存卷
+	LVUncache(lv, vg string) error
 	LVRemove(lv, vg string) error
 	LVResize(lv, vg string, size uint64) error
+	// LVCopy 按块复制卷数据，目标卷不能小于源卷
+	LVCopy(srcLv, dstLv, vg string) error
+	// LVCreateFromSnapshot 基于thin快照创建可写的thin卷
+	LVCreateFromSnapshot(lv, snap, vg string) error
+	LVDelTag(lv, vg, tag string) error
 	LVDisplay(lv, vg string) (*types.LvInfo, error)
+	// LVDevices 返回卷所在的pv
+	LVDevices(lv, vg string) ([]string, error)
 	// LVS 这个方法会频繁调用
 	LVS(lvName string) ([]types.LvInfo, error)
 
 	// CreateSnapshot 快照占用Pool空间，要有足够对池空间才能创建快照，不然会导致数据损坏
-	CreateSnapshot(snap, lv, vg string) error
+	CreateSnapshot(snap, lv, vg string, size uint64) error
 	DeleteSnapshot(snap, vg string) error
 	// RestoreSnapshot 恢复快照会导致此快照消失
 	RestoreSnapshot(snap, vg string) error
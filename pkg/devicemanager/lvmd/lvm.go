@@ -111,6 +111,58 @@ func (lv2 *Lvm2Implement) PVScan(dev string) error {
 	return lv2.Executor.ExecuteCommand("pvscan", args...)
 }
 
+// PVTags pvs --noheadings --separator=; -o pv_name,pv_tags v1
+func (lv2 *Lvm2Implement) PVTags(vg string) (map[string][]string, error) {
+	out, err := lv2.Executor.ExecuteCommandWithOutput("pvs", "--noheadings", "--separator=;", "-o", "pv_name,pv_tags", vg)
+	if err != nil {
+		return nil, err
+	}
+	return parsePvTags(out), nil
+}
+
+// PVAddTag pvchange --addtag tag /dev/loop4
+func (lv2 *Lvm2Implement) PVAddTag(dev, tag string) error {
+	return lv2.Executor.ExecuteCommand("pvchange", "--addtag", tag, dev)
+}
+
+// PVDelTag pvchange --deltag tag /dev/loop4
+func (lv2 *Lvm2Implement) PVDelTag(dev, tag string) error {
+	return lv2.Executor.ExecuteCommand("pvchange", "--deltag", tag, dev)
+}
+
+// PVChangeAllocatable pvchange -x n /dev/loop4
+func (lv2 *Lvm2Implement) PVChangeAllocatable(dev string, allocatable bool) error {
+	flag := "n"
+	if allocatable {
+		flag = "y"
+	}
+	return lv2.Executor.ExecuteCommand("pvchange", "-x", flag, dev)
+}
+
+// PVMove pvmove -b /dev/loop5
+func (lv2 *Lvm2Implement) PVMove(dev string) error {
+	output, err := lv2.Executor.ExecuteCommandWithOutput("pvmove", "-b", dev)
+	if err != nil && !strings.Contains(output, "No data to move") {
+		log.Error(output)
+		return err
+	}
+	return nil
+}
+
+// PVMoveProgress lvs --noheadings --separator=; -a -o move_pv,copy_percent v1
+/*
+# lvs --noheadings --separator=; -a -o move_pv,copy_percent v1
+  /dev/loop5;37.50
+  ;
+*/
+func (lv2 *Lvm2Implement) PVMoveProgress(vg string) (map[string]string, error) {
+	out, err := lv2.Executor.ExecuteCommandWithOutput("lvs", "--noheadings", "--separator=;", "-a", "-o", "move_pv,copy_percent", vg)
+	if err != nil {
+		return nil, err
+	}
+	return parsePvMoveProgress(out), nil
+}
+
 func (lv2 *Lvm2Implement) VGCheck(vg string) error {
 	return lv2.Executor.ExecuteCommand("vgck", vg)
 }
@@ -278,6 +330,65 @@ func (lv2 *Lvm2Implement) LVRemove(lv, vg string) error {
 	return lv2.Executor.ExecuteCommand("lvremove", "-f", fmt.Sprintf("%s/%s", vg, lv))
 }
 
+// LVCreateRaid lvcreate --type raid1 -m 1 -n m1 -L 2g -W y -y v1
+func (lv2 *Lvm2Implement) LVCreateRaid(lv, vg, raidType string, size uint64, mirrors, stripe uint, stripeSize string, tags []string) error {
+	args := []string{"-n", lv, "--type", raidType, "-m", fmt.Sprintf("%d", mirrors), "-L", fmt.Sprintf("%vg", size>>30), "-W", "y", "-y"}
+	for _, tag := range tags {
+		if tag != "" {
+			args = append(args, "--add-tag="+tag)
+		}
+	}
+	if stripe != 0 {
+		args = append(args, "-i", fmt.Sprintf("%d", stripe))
+
+		if stripeSize != "" {
+			args = append(args, "-I", stripeSize)
+		}
+	}
+	args = append(args, vg)
+
+	return lv2.Executor.ExecuteCommand("lvcreate", args...)
+}
+
+// LVRepair lvconvert --repair -y v1/m1
+func (lv2 *Lvm2Implement) LVRepair(lv, vg string) error {
+	return lv2.Executor.ExecuteCommand("lvconvert", "--repair", "-y", fmt.Sprintf("%s/%s", vg, lv))
+}
+
+// LVCreateOnPVs lvcreate --type cache-pool -n c1 -L 2g -W y -y v1 /dev/sdb
+func (lv2 *Lvm2Implement) LVCreateOnPVs(lv, vg, segType string, size uint64, pvs []string) error {
+	args := []string{"-n", lv, "-L", fmt.Sprintf("%vg", size>>30), "-W", "y", "-y"}
+	if segType != "" {
+		args = append(args, "--type", segType)
+	}
+	args = append(args, vg)
+	args = append(args, pvs...)
+
+	return lv2.Executor.ExecuteCommand("lvcreate", args...)
+}
+
+// LVAttachCache lvconvert -y --type cache --cachepool v1/c1 --cachemode writethrough v1/m1
+// lvconvert -y --type writecache --cachevol v1/c1 v1/m1
+func (lv2 *Lvm2Implement) LVAttachCache(lv, cacheLv, vg, cacheType, cacheMode string) error {
+	args := []string{"-y", "--type", cacheType}
+	if cacheType == "writecache" {
+		args = append(args, "--cachevol", fmt.Sprintf("%s/%s", vg, cacheLv))
+	} else {
+		args = append(args, "--cachepool", fmt.Sprintf("%s/%s", vg, cacheLv))
+		if cacheMode != "" {
+			args = append(args, "--cachemode", cacheMode)
+		}
+	}
+	args = append(args, fmt.Sprintf("%s/%s", vg, lv))
+
+	return lv2.Executor.ExecuteCommand("lvconvert", args...)
+}
+
+// LVUncache lvconvert -y --uncache v1/m1
+func (lv2 *Lvm2Implement) LVUncache(lv, vg string) error {
+	return lv2.Executor.ExecuteCommand("lvconvert", "-y", "--uncache", fmt.Sprintf("%s/%s", vg, lv))
+}
+
 // LVResize lvresize -L 2g v1/m2
 func (lv2 *Lvm2Implement) LVResize(lv, vg string, size uint64) error {
 	return lv2.Executor.ExecuteCommand("lvresize", "-L", fmt.Sprintf("%vg", size>>30), fmt.Sprintf("%s/%s", vg, lv))
@@ -295,6 +406,20 @@ func (lv2 *Lvm2Implement) LVDisplay(lv, vg string) (*types.LvInfo, error) {
 	return &lvInfo[0], nil
 }
 
+// LVDevices lvs --noheadings -o devices v1/lv1
+/*
+# lvs --noheadings -o devices v1/lv1
+  /dev/loop4(0)
+  /dev/loop4(256),/dev/loop5(0)
+*/
+func (lv2 *Lvm2Implement) LVDevices(lv, vg string) ([]string, error) {
+	out, err := lv2.Executor.ExecuteCommandWithOutput("lvs", "--noheadings", "-o", "devices", fmt.Sprintf("%s/%s", vg, lv))
+	if err != nil {
+		return nil, err
+	}
+	return parseLvDevices(out), nil
+}
+
 // LVS
 /*
 # lvs -o lv_name,lv_path,lv_size,lv_kernel_major,lv_kernel_minor,origin,origin_size,pool_lv,thin_count,lv_tags --noheadings --separator=, --units=b --nosuffix --unbuffered --nameprefixes
@@ -304,7 +429,7 @@ func (lv2 *Lvm2Implement) LVDisplay(lv, vg string) (*types.LvInfo, error) {
 
 */
 func (lv2 *Lvm2Implement) LVS(lvName string) ([]types.LvInfo, error) {
-	fields := []string{"-o", "lv_name,vg_name,lv_path,lv_size,data_percent,lv_attr,lv_kernel_major,lv_kernel_minor,origin,origin_size,pool_lv,thin_count,lv_tags,lv_active"}
+	fields := []string{"-o", "lv_name,vg_name,lv_path,lv_size,data_percent,lv_attr,lv_kernel_major,lv_kernel_minor,origin,origin_size,pool_lv,thin_count,lv_tags,lv_active,lv_layout,copy_percent,lv_health_status"}
 	args := []string{"--noheadings", "--separator=,", "--units=b", "--nosuffix", "--unbuffered", "--nameprefixes"}
 
 	if lvName != "" {
@@ -321,11 +446,31 @@ func (lv2 *Lvm2Implement) LVS(lvName string) ([]types.LvInfo, error) {
 	return parseLvs(lvsInfo), nil
 }
 
+// LVCopy dd if=/dev/v1/snapshot-m1 of=/dev/v1/volume-m2 bs=4M conv=fsync
+func (lv2 *Lvm2Implement) LVCopy(srcLv, dstLv, vg string) error {
+	return lv2.Executor.ExecuteCommand("dd", fmt.Sprintf("if=/dev/%s/%s", vg, srcLv), fmt.Sprintf("of=/dev/%s/%s", vg, dstLv), "bs=4M", "conv=fsync")
+}
+
+// LVCreateFromSnapshot lvcreate -s v1/snapshot-m1 -n volume-m2 -kn -ay -Ky
+func (lv2 *Lvm2Implement) LVCreateFromSnapshot(lv, snap, vg string) error {
+	return lv2.Executor.ExecuteCommand("lvcreate", "-s", fmt.Sprintf("%s/%s", vg, snap), "-n", lv, "-kn", "-ay", "-Ky")
+}
+
+// LVDelTag lvchange --deltag tag v1/m2
+func (lv2 *Lvm2Implement) LVDelTag(lv, vg, tag string) error {
+	return lv2.Executor.ExecuteCommand("lvchange", "--deltag", tag, fmt.Sprintf("%s/%s", vg, lv))
+}
+
 // CreateSnapshot lvcreate -s v1/m2 -n snaph-m1 -ay -Ky
-func (lv2 *Lvm2Implement) CreateSnapshot(snap, lv, vg string) error {
+// size为0时创建thin快照，占用Pool空间；否则创建普通快照，size为COW空间大小
+func (lv2 *Lvm2Implement) CreateSnapshot(snap, lv, vg string, size uint64) error {
 	// Pool容量时lv卷的三倍，则能创建两个快照
 	// TODO: 需要检查pool>lvm卷,若是相等则不支持创建快照操作
-	return lv2.Executor.ExecuteCommand("lvcreate", "-s", fmt.Sprintf("%s/%s", vg, lv), "-n", snap, "-ay", "-Ky")
+	args := []string{"-s", fmt.Sprintf("%s/%s", vg, lv), "-n", snap, "-ay", "-Ky"}
+	if size > 0 {
+		args = append(args, "-L", fmt.Sprintf("%vb", size))
+	}
+	return lv2.Executor.ExecuteCommand("lvcreate", args...)
 }
 
 // DeleteSnapshot
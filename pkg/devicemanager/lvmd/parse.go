@@ -20,6 +20,7 @@ import (
 	"github.com/carina-io/carina"
 	"github.com/carina-io/carina/api"
 	"github.com/carina-io/carina/pkg/devicemanager/types"
+	"github.com/carina-io/carina/utils"
 	"github.com/carina-io/carina/utils/log"
 	"strconv"
 	"strings"
@@ -119,17 +120,72 @@ func parseLvs(lvsString string) []types.LvInfo {
 				tmp.LVAttr = k[1]
 			case "LVM2_LV_ACTIVE":
 				tmp.LVActive = k[1]
+			case "LVM2_LV_LAYOUT":
+				tmp.LVLayout = k[1]
+			case "LVM2_COPY_PERCENT":
+				tmp.CopyPercent, _ = strconv.ParseFloat(k[1], 64)
+			case "LVM2_LV_HEALTH_STATUS":
+				tmp.HealthStatus = k[1]
 			default:
 				log.Warnf("undefined field %s=%s", k[0], k[1])
 			}
 		}
-		if strings.HasPrefix(tmp.LVName, carina.VolumePrefix) || strings.HasPrefix(tmp.LVName, carina.ThinPrefix) {
+		if strings.HasPrefix(tmp.LVName, carina.VolumePrefix) || strings.HasPrefix(tmp.LVName, carina.ThinPrefix) || strings.HasPrefix(tmp.LVName, carina.SnapshotPrefix) {
 			resp = append(resp, tmp)
 		}
 	}
 	return resp
 }
 
+func parsePvTags(pvsString string) map[string][]string {
+	// /dev/loop2;carina.aa.0123456789abcdef.pvc-1,carina.aa.0123456789abcdef.pvc-2
+	// /dev/loop3;
+	resp := map[string][]string{}
+	for _, line := range strings.Split(pvsString, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ";", 2)
+		resp[fields[0]] = []string{}
+		if len(fields) < 2 || fields[1] == "" {
+			continue
+		}
+		resp[fields[0]] = strings.Split(fields[1], ",")
+	}
+	return resp
+}
+
+func parsePvMoveProgress(lvsString string) map[string]string {
+	// /dev/loop5;37.50
+	// ;
+	resp := map[string]string{}
+	for _, line := range strings.Split(lvsString, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), ";", 2)
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		resp[fields[0]] = fields[1]
+	}
+	return resp
+}
+
+func parseLvDevices(lvsString string) []string {
+	// /dev/loop4(256),/dev/loop5(0)
+	var resp []string
+	for _, line := range strings.Split(lvsString, "\n") {
+		for _, device := range strings.Split(strings.TrimSpace(line), ",") {
+			if i := strings.Index(device, "("); i >= 0 {
+				device = device[:i]
+			}
+			if device != "" && !utils.ContainsString(resp, device) {
+				resp = append(resp, device)
+			}
+		}
+	}
+	return resp
+}
+
 func parsePvs(pvsString string) []api.PVInfo {
 	// LVM2_PV_NAME='/dev/loop2',LVM2_VG_NAME='lvmvg',LVM2_PV_FMT='lvm2',LVM2_PV_ATTR='a--',LVM2_PV_SIZE='16101933056',LVM2_PV_FREE='16101933056'
 	resp := []api.PVInfo{}
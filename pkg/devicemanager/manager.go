@@ -18,18 +18,27 @@ package deviceManager
 
 import (
 	"context"
+	"fmt"
 	"github.com/carina-io/carina/pkg/devicemanager/hostpath"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/carina-io/carina"
+	carinav1 "github.com/carina-io/carina/api/v1"
+	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
 	"github.com/carina-io/carina/pkg/configuration"
 	"github.com/carina-io/carina/pkg/devicemanager/bcache"
 	"github.com/carina-io/carina/pkg/devicemanager/lvmd"
 	"github.com/carina-io/carina/pkg/devicemanager/partition"
+	"github.com/carina-io/carina/pkg/devicemanager/smart"
 	"github.com/carina-io/carina/pkg/devicemanager/volume"
+	"github.com/carina-io/carina/utils"
 	"github.com/carina-io/carina/utils/exec"
 	"github.com/carina-io/carina/utils/log"
 	"github.com/carina-io/carina/utils/mutx"
@@ -38,11 +47,14 @@ import (
 type Trigger string
 
 const (
-	Dummy                 Trigger = "dummy"
-	ConfigModify          Trigger = "configModify"
-	LVMCheck              Trigger = "lvmCheck"
-	CleanupOrphan         Trigger = "cleanupOrphan"
-	LogicVolumeController Trigger = "logicVolumeController"
+	Dummy                   Trigger = "dummy"
+	ConfigModify            Trigger = "configModify"
+	LVMCheck                Trigger = "lvmCheck"
+	CleanupOrphan           Trigger = "cleanupOrphan"
+	LogicVolumeController   Trigger = "logicVolumeController"
+	LogicSnapshotController Trigger = "logicSnapshotController"
+	DiskCordonController    Trigger = "diskCordonController"
+	DiskHealthCheck         Trigger = "diskHealthCheck"
 )
 
 type VolumeEvent struct {
@@ -59,8 +71,16 @@ type DeviceManager struct {
 	//磁盘以及分区操作
 	Partition     partition.LocalPartition
 	Host          hostpath.HostPath
+	Smart         smart.Smart
 	NodeName      string
 	noticeUpdates []chan *VolumeEvent
+	// 磁盘选择器变更计划及磁盘隔离进度，上报到nodeStorageResource
+	statusMutex sync.Mutex
+	diskPlan    *carinav1beta1.DiskPlan
+	diskCordons []carinav1beta1.DiskCordonStatus
+	// pv所在磁盘的缓存，避免每次上报状态都执行lsblk
+	pvDiskMutex sync.Mutex
+	pvDisks     map[string]string
 }
 
 func NewDeviceManager(nodeName string, cache cache.Cache, client client.Client) *DeviceManager {
@@ -73,6 +93,7 @@ func NewDeviceManager(nodeName string, cache cache.Cache, client client.Client)
 		VolumeManager: &volume.LocalVolumeImplement{Mutex: mutex, Lv: &lvmd.Lvm2Implement{Executor: executor}, Bcache: &bcache.BcacheImplement{Executor: executor}},
 		Partition:     &partition.LocalPartitionImplement{Mutex: mutex, CacheParttionNum: make(map[string]uint), Executor: executor},
 		Host:          &hostpath.LocalHostImplement{Mutex: mutex},
+		Smart:         &smart.SmartImplement{Executor: executor, CacheTime: smart.DefaultCacheTime},
 		NodeName:      nodeName,
 		noticeUpdates: []chan *VolumeEvent{},
 	}
@@ -100,6 +121,28 @@ func (dm *DeviceManager) GetNodeDiskSelectGroup() map[string]configuration.DiskS
 	return diskClass
 }
 
+// GetNodeTopology returns the labels of the node for the topology keys in config.json,
+// the missing labels are reported with an empty value so that all nodes have the same topology keys
+func (dm *DeviceManager) GetNodeTopology() (map[string]string, error) {
+	topology := map[string]string{}
+	topologyKeys := configuration.TopologyKeys()
+	if len(topologyKeys) == 0 {
+		return topology, nil
+	}
+	node := &corev1.Node{}
+	if err := dm.Cache.Get(context.Background(), client.ObjectKey{Name: dm.NodeName}, node); err != nil {
+		return nil, err
+	}
+	for _, key := range topologyKeys {
+		value, ok := node.Labels[key]
+		if !ok {
+			log.Warnf("node %s has no label of topology key %s, report it with an empty value", dm.NodeName, key)
+		}
+		topology[key] = value
+	}
+	return topology, nil
+}
+
 func (dm *DeviceManager) NoticeUpdateCapacity(trigger Trigger, done chan struct{}) {
 	for _, notice := range dm.noticeUpdates {
 		select {
@@ -110,6 +153,111 @@ func (dm *DeviceManager) NoticeUpdateCapacity(trigger Trigger, done chan struct{
 	}
 }
 
+// SetDiskPlan 更新磁盘选择器变更计划，nil表示没有待执行的变更
+func (dm *DeviceManager) SetDiskPlan(plan *carinav1beta1.DiskPlan) {
+	dm.statusMutex.Lock()
+	defer dm.statusMutex.Unlock()
+	dm.diskPlan = plan.DeepCopy()
+}
+
+// GetDiskPlan 返回磁盘选择器变更计划的副本
+func (dm *DeviceManager) GetDiskPlan() *carinav1beta1.DiskPlan {
+	dm.statusMutex.Lock()
+	defer dm.statusMutex.Unlock()
+	return dm.diskPlan.DeepCopy()
+}
+
+// SetDiskCordons 更新被隔离磁盘的进度
+func (dm *DeviceManager) SetDiskCordons(cordons []carinav1beta1.DiskCordonStatus) {
+	dm.statusMutex.Lock()
+	defer dm.statusMutex.Unlock()
+	dm.diskCordons = append([]carinav1beta1.DiskCordonStatus{}, cordons...)
+}
+
+// GetDiskCordons 返回被隔离磁盘的进度
+func (dm *DeviceManager) GetDiskCordons() []carinav1beta1.DiskCordonStatus {
+	dm.statusMutex.Lock()
+	defer dm.statusMutex.Unlock()
+	if len(dm.diskCordons) == 0 {
+		return nil
+	}
+	return append([]carinav1beta1.DiskCordonStatus{}, dm.diskCordons...)
+}
+
+// PVDisk returns the kernel name of the disk of the pv, the parent disk if the pv is a partition,
+// empty for the virtual devices such as raid
+func (dm *DeviceManager) PVDisk(pvName string) string {
+	dm.pvDiskMutex.Lock()
+	defer dm.pvDiskMutex.Unlock()
+	if disk, ok := dm.pvDisks[pvName]; ok {
+		return disk
+	}
+	devices, err := dm.Partition.ListDevicesDetailWithoutFilter(pvName)
+	if err != nil || len(devices) == 0 {
+		return ""
+	}
+	disk := ""
+	switch devices[0].Type {
+	case "disk":
+		disk = filepath.Base(devices[0].Name)
+	case "part":
+		disk = filepath.Base(devices[0].ParentName)
+	}
+	if dm.pvDisks == nil {
+		dm.pvDisks = map[string]string{}
+	}
+	dm.pvDisks[pvName] = disk
+	return disk
+}
+
+// PVUnschedulable returns true if diskHealthPolicy is unschedulable and the disk of the pv fails the SMART check
+func (dm *DeviceManager) PVUnschedulable(pvName string) bool {
+	if configuration.DiskHealthPolicy() != configuration.DiskHealthUnschedulable {
+		return false
+	}
+	disk := dm.PVDisk(pvName)
+	if disk == "" {
+		return false
+	}
+	health, err := dm.Smart.DiskHealth(disk)
+	return err == nil && health.Failing()
+}
+
 func (dm *DeviceManager) RegisterNoticeChan(notice chan *VolumeEvent) {
 	dm.noticeUpdates = append(dm.noticeUpdates, notice)
 }
+
+// RaidStatus returns the sync progress and health of the raid volume, nil for other volumes
+func (dm *DeviceManager) RaidStatus(lv *carinav1.LogicVolume) *carinav1.RaidStatus {
+	if lv.Spec.RaidType == "" {
+		return nil
+	}
+	lvInfo, err := dm.VolumeManager.VolumeInfo(carina.VolumePrefix+lv.Name, lv.Spec.DeviceGroup)
+	if err != nil {
+		return &carinav1.RaidStatus{Degraded: true, HealthStatus: err.Error()}
+	}
+	return &carinav1.RaidStatus{
+		SyncPercent:  strconv.FormatFloat(lvInfo.CopyPercent, 'f', 2, 64),
+		Degraded:     volume.RaidDegraded(*lvInfo),
+		HealthStatus: lvInfo.HealthStatus,
+	}
+}
+
+// VolumeCondition returns true and the reason if the local device of logicVolume is abnormal
+func (dm *DeviceManager) VolumeCondition(lv *carinav1.LogicVolume) (bool, string) {
+	switch lv.Annotations[carina.VolumeManagerType] {
+	case carina.RawVolumeType:
+		partition, err := dm.Partition.GetPartition(utils.PartitionName(lv.Name), lv.Spec.DeviceGroup)
+		if err != nil {
+			return true, fmt.Sprintf("disk %s is not found: %s", lv.Spec.DeviceGroup, err.Error())
+		}
+		if partition.Name == "" {
+			return true, fmt.Sprintf("partition %s is missing from disk %s", utils.PartitionName(lv.Name), lv.Spec.DeviceGroup)
+		}
+		return false, ""
+	case carina.HostVolumeType:
+		return false, ""
+	default:
+		return dm.VolumeManager.VolumeCondition(carina.VolumePrefix+lv.Name, lv.Spec.DeviceGroup)
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
@@ -39,6 +41,8 @@ var (
 		return true
 	}
 	mysys = linux.System()
+	// lsblk --pairs 输出格式 NAME="/dev/sda" MODEL="Samsung SSD 860"
+	lsblkPairRegexp = regexp.MustCompile(`([A-Z:-]+)="([^"]*)"`)
 )
 
 type LocalPartition interface {
@@ -48,6 +52,7 @@ type LocalPartition interface {
 	CreatePartition(name, groups string, size uint64) error
 	GetPartition(name, groups string) (disko.Partition, error)
 	UpdatePartition(name, groups string, size uint64) error
+	CopyPartition(srcName, srcGroups, dstName, dstGroups string) error
 	DeletePartition(name, groups string) error
 	DeletePartitionByPartNumber(disk disko.Disk, number uint) error
 	UpdatePartitionCache(name string, number uint) error
@@ -282,6 +287,33 @@ func (ld *LocalPartitionImplement) UpdatePartition(name, groups string, size uin
 	return ld.PartProbe()
 }
 
+// CopyPartition 按块复制分区数据，目标分区不能小于源分区
+func (ld *LocalPartitionImplement) CopyPartition(srcName, srcGroups, dstName, dstGroups string) error {
+	srcDevice, err := ld.partitionDevice(srcName, srcGroups)
+	if err != nil {
+		return err
+	}
+	dstDevice, err := ld.partitionDevice(dstName, dstGroups)
+	if err != nil {
+		return err
+	}
+	log.Info("copy partition ", srcDevice, " to ", dstDevice)
+	return ld.Executor.ExecuteCommand("dd", "if="+srcDevice, "of="+dstDevice, "bs=4M", "conv=fsync")
+}
+
+func (ld *LocalPartitionImplement) partitionDevice(name, groups string) (string, error) {
+	disk, err := ld.ScanDisk(groups)
+	if err != nil {
+		return "", err
+	}
+	for _, part := range disk.Partitions {
+		if part.Name == name {
+			return linux.GetPartitionKname(disk.Path, part.Number), nil
+		}
+	}
+	return "", fmt.Errorf("partition %s not found in %s", name, groups)
+}
+
 func (ld *LocalPartitionImplement) DeletePartition(name, groups string) error {
 	if !ld.Mutex.TryAcquire(DISKMUTEX) {
 		log.Info("wait other task release mutex, please retry...")
@@ -386,8 +418,10 @@ func (ld *LocalPartitionImplement) PartProbe() error {
 	return ld.Executor.ExecuteCommand("bash", "-c", "partprobe")
 }
 
+const lsblkColumns = "NAME,FSTYPE,MOUNTPOINT,SIZE,STATE,TYPE,ROTA,RO,PKNAME,MAJ:MIN,TRAN,MODEL,SERIAL,WWN"
+
 func (ld *LocalPartitionImplement) ListDevicesDetailWithoutFilter(device string) ([]*types.LocalDisk, error) {
-	args := []string{"--pairs", "--paths", "--bytes", "--output", "NAME,FSTYPE,MOUNTPOINT,SIZE,STATE,TYPE,ROTA,RO,PKNAME,MAJ:MIN"}
+	args := []string{"--pairs", "--paths", "--bytes", "--output", lsblkColumns}
 	if device != "" {
 		args = append(args, device)
 	}
@@ -397,7 +431,75 @@ func (ld *LocalPartitionImplement) ListDevicesDetailWithoutFilter(device string)
 		return nil, err
 	}
 
-	return parseDiskString(devices), nil
+	localDisks := parseDiskString(devices)
+	// 查询单个分区时输出中没有父磁盘，需要单独查询父磁盘的属性
+	var parents []*types.LocalDisk
+	if device != "" {
+		for _, d := range localDisks {
+			if d.Type != "part" || d.ParentName == "" {
+				continue
+			}
+			output, err := ld.Executor.ExecuteCommandWithOutput("lsblk", "--pairs", "--paths", "--bytes", "--nodeps", "--output", lsblkColumns, d.ParentName)
+			if err != nil {
+				log.Warnf("exec lsblk of parent disk %s failed %s", d.ParentName, err.Error())
+				continue
+			}
+			parents = append(parents, parseDiskString(output)...)
+		}
+	}
+	inheritParentAttributes(localDisks, parents)
+	symlinks := diskSymlinks()
+	for _, d := range localDisks {
+		d.Symlinks = symlinks[d.Name]
+	}
+	return localDisks, nil
+}
+
+// inheritParentAttributes lsblk不输出分区的TRAN、MODEL、SERIAL，分区从PKNAME父磁盘继承，磁盘选择器才能匹配分区
+func inheritParentAttributes(disks, parents []*types.LocalDisk) {
+	byName := map[string]*types.LocalDisk{}
+	for _, d := range parents {
+		byName[d.Name] = d
+	}
+	for _, d := range disks {
+		byName[d.Name] = d
+	}
+	for _, d := range disks {
+		parent, ok := byName[d.ParentName]
+		if d.Type != "part" || !ok {
+			continue
+		}
+		if d.Transport == "" {
+			d.Transport = parent.Transport
+		}
+		if d.Model == "" {
+			d.Model = parent.Model
+		}
+		if d.Serial == "" {
+			d.Serial = parent.Serial
+		}
+	}
+}
+
+// diskSymlinks 返回/dev/disk/by-id及/dev/disk/by-path下指向各设备的链接
+func diskSymlinks() map[string][]string {
+	symlinks := map[string][]string{}
+	for _, dir := range []string{"/dev/disk/by-id", "/dev/disk/by-path"} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Debugf("read dir %s failed %s", dir, err.Error())
+			continue
+		}
+		for _, entry := range entries {
+			link := filepath.Join(dir, entry.Name())
+			device, err := filepath.EvalSymlinks(link)
+			if err != nil {
+				continue
+			}
+			symlinks[device] = append(symlinks[device], link)
+		}
+	}
+	return symlinks
 }
 
 func (ld *LocalPartitionImplement) ListDevicesDetail(device string) ([]*types.LocalDisk, error) {
@@ -415,17 +517,14 @@ func parseDiskString(diskString string) []*types.LocalDisk {
 		return resp
 	}
 
-	diskString = strings.ReplaceAll(diskString, "\"", "")
-	//diskString = strings.ReplaceAll(diskString, " ", "")
 	parentDisk := map[string]int8{}
 
 	blksList := strings.Split(diskString, "\n")
 	for _, blks := range blksList {
 		tmp := types.LocalDisk{}
-		blk := strings.Split(blks, " ")
-		for _, b := range blk {
-			k := strings.Split(b, "=")
-
+		// MODEL等字段的值可能包含空格，按KEY="VALUE"解析
+		for _, k := range lsblkPairRegexp.FindAllStringSubmatch(blks, -1) {
+			k = k[1:]
 			switch k[0] {
 			case "NAME":
 				tmp.Name = k[1]
@@ -452,6 +551,14 @@ func parseDiskString(diskString string) []*types.LocalDisk {
 				parentDisk[tmp.ParentName] = 1
 			case "MAJ:MIN":
 				tmp.DeviceNumber = k[1]
+			case "TRAN":
+				tmp.Transport = k[1]
+			case "MODEL":
+				tmp.Model = strings.TrimSpace(k[1])
+			case "SERIAL":
+				tmp.Serial = strings.TrimSpace(k[1])
+			case "WWN":
+				tmp.WWN = k[1]
 			default:
 				log.Warnf("undefined filed %s-%s", k[0], k[1])
 			}
@@ -253,3 +253,36 @@ func TestClearPartition(t *testing.T) {
 	}
 
 }
+
+func TestParseDiskString(t *testing.T) {
+	out := `NAME="/dev/sda" FSTYPE="" MOUNTPOINT="" SIZE="107374182400" STATE="running" TYPE="disk" ROTA="1" RO="0" PKNAME="" MAJ:MIN="8:0" TRAN="sata" MODEL="Samsung SSD 860 " SERIAL="S3Z9NB0K" WWN="0x5002538e40a1b2c3"
+NAME="/dev/sda1" FSTYPE="xfs" MOUNTPOINT="/boot" SIZE="1073741824" STATE="" TYPE="part" ROTA="1" RO="0" PKNAME="/dev/sda" MAJ:MIN="8:1" TRAN="" MODEL="" SERIAL="" WWN="0x5002538e40a1b2c3"`
+	disks := parseDiskString(out)
+	if len(disks) != 2 {
+		t.Fatalf("expected 2 disks, got %d", len(disks))
+	}
+	sda := disks[0]
+	if sda.Name != "/dev/sda" || sda.Model != "Samsung SSD 860" || sda.Transport != "sata" || sda.Serial != "S3Z9NB0K" ||
+		sda.WWN != "0x5002538e40a1b2c3" || sda.Size != 107374182400 || sda.DeviceNumber != "8:0" || !sda.HavePartitions {
+		t.Errorf("unexpected disk %+v", sda)
+	}
+	if disks[1].MountPoint != "/boot" || disks[1].ParentName != "/dev/sda" {
+		t.Errorf("unexpected partition %+v", disks[1])
+	}
+}
+
+func TestInheritParentAttributes(t *testing.T) {
+	out := `NAME="/dev/sda" FSTYPE="" MOUNTPOINT="" SIZE="107374182400" STATE="running" TYPE="disk" ROTA="1" RO="0" PKNAME="" MAJ:MIN="8:0" TRAN="sata" MODEL="Samsung SSD 860 " SERIAL="S3Z9NB0K" WWN="0x5002538e40a1b2c3"
+NAME="/dev/sda2" FSTYPE="LVM2_member" MOUNTPOINT="" SIZE="53687091200" STATE="" TYPE="part" ROTA="1" RO="0" PKNAME="/dev/sda" MAJ:MIN="8:2" TRAN="" MODEL="" SERIAL="" WWN="0x5002538e40a1b2c3"`
+	disks := parseDiskString(out)
+	inheritParentAttributes(disks, nil)
+	assert.Equal(t, "sata", disks[1].Transport)
+	assert.Equal(t, "Samsung SSD 860", disks[1].Model)
+	assert.Equal(t, "S3Z9NB0K", disks[1].Serial)
+
+	// lsblk of a single partition does not list the parent disk
+	partition := parseDiskString(strings.Split(out, "\n")[1])
+	inheritParentAttributes(partition, disks[:1])
+	assert.Equal(t, "sata", partition[0].Transport)
+	assert.Equal(t, "Samsung SSD 860", partition[0].Model)
+}
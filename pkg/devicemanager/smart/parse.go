@@ -0,0 +1,121 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/carina-io/carina/api"
+)
+
+const (
+	// ataReallocatedSectorCt ATA SMART属性5 Reallocated_Sector_Ct
+	ataReallocatedSectorCt = 5
+	// smartctl退出码bit0为命令行错误，bit1为设备无法打开或处于休眠状态
+	smartctlExitFatal = 0x3
+)
+
+type smartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
+			String string `json:"string"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	AtaSmartAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value uint64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	ScsiGrownDefectList uint64 `json:"scsi_grown_defect_list"`
+	NvmeHealth          *struct {
+		CriticalWarning uint64 `json:"critical_warning"`
+		Temperature     int64  `json:"temperature"`
+		PercentageUsed  uint64 `json:"percentage_used"`
+		MediaErrors     uint64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	Temperature struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+}
+
+/*
+	{
+	  "smartctl": {"exit_status": 0},
+	  "smart_status": {"passed": true},
+	  "nvme_smart_health_information_log": {
+	    "critical_warning": 0,
+	    "temperature": 36,
+	    "percentage_used": 3,
+	    "media_errors": 0
+	  },
+	  "temperature": {"current": 36}
+	}
+*/
+func parseSmartctl(out string) (*api.DiskHealth, error) {
+	var output smartctlOutput
+	// 执行失败时输出末尾附带了错误信息，只解析第一个json对象
+	if err := json.NewDecoder(strings.NewReader(out)).Decode(&output); err != nil {
+		return nil, fmt.Errorf("failed to parse smartctl output: %s", err.Error())
+	}
+	if output.Smartctl.ExitStatus&smartctlExitFatal != 0 || output.SmartStatus == nil {
+		var messages []string
+		for _, m := range output.Smartctl.Messages {
+			messages = append(messages, m.String)
+		}
+		if len(messages) == 0 {
+			return nil, errors.New("smart status is unavailable")
+		}
+		return nil, errors.New(strings.Join(messages, "; "))
+	}
+
+	health := &api.DiskHealth{
+		Passed:             output.SmartStatus.Passed,
+		ReallocatedSectors: output.ScsiGrownDefectList,
+		Temperature:        output.Temperature.Current,
+	}
+	for _, attr := range output.AtaSmartAttributes.Table {
+		if attr.ID == ataReallocatedSectorCt {
+			health.ReallocatedSectors = attr.Raw.Value
+		}
+	}
+	var reasons []string
+	if !health.Passed {
+		reasons = append(reasons, "SMART overall-health self-assessment failed")
+	}
+	if nvme := output.NvmeHealth; nvme != nil {
+		health.MediaErrors = nvme.MediaErrors
+		health.PercentageUsed = nvme.PercentageUsed
+		if health.Temperature == 0 {
+			health.Temperature = nvme.Temperature
+		}
+		if nvme.CriticalWarning != 0 {
+			reasons = append(reasons, fmt.Sprintf("NVMe critical warning 0x%02x", nvme.CriticalWarning))
+		}
+	}
+	health.Message = strings.Join(reasons, "; ")
+	return health, nil
+}
@@ -0,0 +1,59 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package smart
+
+import (
+	"testing"
+
+	"github.com/carina-io/carina/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSmartctl(t *testing.T) {
+	ata := `{
+  "smartctl": {"exit_status": 8},
+  "smart_status": {"passed": false},
+  "ata_smart_attributes": {"table": [
+    {"id": 1, "name": "Raw_Read_Error_Rate", "raw": {"value": 12}},
+    {"id": 5, "name": "Reallocated_Sector_Ct", "raw": {"value": 24}}
+  ]},
+  "temperature": {"current": 41}
+}. exit status 8`
+	health, err := parseSmartctl(ata)
+	assert.NoError(t, err)
+	assert.Equal(t, &api.DiskHealth{ReallocatedSectors: 24, Temperature: 41, Message: "SMART overall-health self-assessment failed"}, health)
+	assert.True(t, health.Failing())
+
+	nvme := `{
+  "smartctl": {"exit_status": 0},
+  "smart_status": {"passed": true},
+  "nvme_smart_health_information_log": {"critical_warning": 0, "temperature": 36, "percentage_used": 3, "media_errors": 2}
+}`
+	health, err = parseSmartctl(nvme)
+	assert.NoError(t, err)
+	assert.Equal(t, &api.DiskHealth{Passed: true, MediaErrors: 2, PercentageUsed: 3, Temperature: 36}, health)
+	assert.False(t, health.Failing())
+
+	standby := `{
+  "smartctl": {"exit_status": 2, "messages": [{"string": "Device is in STANDBY mode, exit(2)", "severity": "information"}]}
+}`
+	_, err = parseSmartctl(standby)
+	assert.EqualError(t, err, "Device is in STANDBY mode, exit(2)")
+
+	_, err = parseSmartctl("smartctl: command not found")
+	assert.Error(t, err)
+}
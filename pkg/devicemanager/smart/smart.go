@@ -0,0 +1,78 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package smart
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carina-io/carina/api"
+	"github.com/carina-io/carina/utils/exec"
+)
+
+// DefaultCacheTime smartctl会访问磁盘固件，缓存结果避免每次上报状态或采集指标时重复执行
+const DefaultCacheTime = 3 * time.Minute
+
+type diskHealthCache struct {
+	health    *api.DiskHealth
+	err       error
+	collectAt time.Time
+}
+
+type SmartImplement struct {
+	Executor  exec.Executor
+	CacheTime time.Duration
+	mutex     sync.Mutex
+	cache     map[string]diskHealthCache
+}
+
+func (si *SmartImplement) DiskHealth(disk string) (*api.DiskHealth, error) {
+	disk = strings.TrimPrefix(disk, "/dev/")
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+	if si.cache == nil {
+		si.cache = map[string]diskHealthCache{}
+	}
+	cached, ok := si.cache[disk]
+	if ok && time.Since(cached.collectAt) < si.CacheTime {
+		return cached.health, cached.err
+	}
+
+	health, err := si.collect(disk)
+	if err != nil && cached.health != nil {
+		// 磁盘休眠时不唤醒磁盘，沿用上次采集的结果
+		health, err = cached.health, nil
+	}
+	si.cache[disk] = diskHealthCache{health: health, err: err, collectAt: time.Now()}
+	return health, err
+}
+
+func (si *SmartImplement) collect(disk string) (*api.DiskHealth, error) {
+	// smartctl的退出码按位表示磁盘状态，磁盘故障时退出码非0但仍输出完整的json
+	out, err := si.Executor.ExecuteCommandWithOutput("smartctl", "--json", "-a", "-n", "standby", fmt.Sprintf("/dev/%s", disk))
+	if out == "" && err != nil {
+		return nil, err
+	}
+	health, err := parseSmartctl(out)
+	if err != nil {
+		return nil, err
+	}
+	health.Disk = disk
+	return health, nil
+}
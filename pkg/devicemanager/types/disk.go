@@ -60,4 +60,14 @@ type LocalDisk struct {
 	DeviceNumber string `json:"deviceNumber"`
 	// Have partitions
 	HavePartitions bool `json:"havePartitions"`
+	// Transport is the device transport, such as nvme, sata, sas
+	Transport string `json:"transport"`
+	// Model is the device identifier
+	Model string `json:"model"`
+	// Serial is the disk serial number
+	Serial string `json:"serial"`
+	// WWN is the unique storage identifier
+	WWN string `json:"wwn"`
+	// Symlinks is the links of the device in /dev/disk/by-id and /dev/disk/by-path
+	Symlinks []string `json:"symlinks"`
 }
@@ -16,6 +16,8 @@
 
 package types
 
+import "strings"
+
 // LvInfo lv详细信息
 type LvInfo struct {
 	LVName        string  `json:"lvName"`
@@ -32,4 +34,17 @@ type LvInfo struct {
 	DataPercent   float64 `json:"dataPercent"`
 	LVAttr        string  `json:"lvAttr"`
 	LVActive      string  `json:"lvActive"`
+	LVLayout      string  `json:"lvLayout"`
+	CopyPercent   float64 `json:"copyPercent"`
+	HealthStatus  string  `json:"healthStatus"`
+}
+
+// HasLayout lv_layout是卷级别的字段，多个段的卷也只输出一行，值为逗号分隔的列表，如linear、raid,raid10、cache、writecache
+func (lv LvInfo) HasLayout(layout string) bool {
+	for _, l := range strings.Split(lv.LVLayout, ",") {
+		if l == layout {
+			return true
+		}
+	}
+	return false
 }
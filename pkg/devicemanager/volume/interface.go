@@ -25,25 +25,58 @@ import (
 // LocalVolume 本接口负责对外提供方法
 // 处理业务逻辑并调用lvm接口
 type LocalVolume interface {
-	CreateVolume(lvName, vgName string, size, ratio uint64) error
+	CreateVolume(lvName, vgName string, size, ratio uint64, stripes uint, stripeSize string) error
+	// CreateAntiAffinityVolume linear volume on one pv not used by the volumes of the same anti-affinity key
+	CreateAntiAffinityVolume(lvName, vgName string, size uint64, key string, required bool) error
 	DeleteVolume(lvName, vgName string) error
 	ResizeVolume(lvName, vgName string, size, ratio uint64) error
 	VolumeList(lvName, vgName string) ([]types.LvInfo, error)
 	VolumeInfo(lvName, vgName string) (*types.LvInfo, error)
 
+	// CreateThinVolume thin volume in the shared thin pool of vg
+	CreateThinVolume(lvName, vgName string, size uint64, overcommit float64) error
+	ResizeThinVolume(lvName, vgName string, size uint64, overcommit float64) error
+	ThinPoolUsage(vgName string) (uint64, uint64, error)
+
+	// CreateRaidVolume raid1/raid10 volume with mirrors on different pvs
+	CreateRaidVolume(lvName, vgName string, size uint64, raidType string, mirrors, stripes uint, stripeSize string) error
+	RepairRaidVolumes(vgName string) error
+
+	// CreateCacheVolume volume with lvm native dm-cache or writecache in the same vg
+	CreateCacheVolume(lvName, vgName string, size, cacheSize uint64, cacheType, cacheMode string) error
+	ResizeCacheVolume(lvName, vgName string, size, cacheSize uint64, cacheType, cacheMode string) error
+
+	// CreateSnapshot snapshot
+	CreateSnapshot(snapName, lvName, vgName string) error
+	DeleteSnapshot(snapName, vgName string) error
+	CreateVolumeFromSnapshot(lvName, vgName, snapName string, size uint64, raidType string, mirrors, stripes uint, stripeSize string) error
+	CreateVolumeFromVolume(lvName, vgName, srcLvName string, size uint64, raidType string, mirrors, stripes uint, stripeSize string) error
+
 	// GetCurrentVgStruct 额外的方法
 	GetCurrentVgStruct() ([]api.VgGroup, error)
 	GetCurrentPvStruct() ([]api.PVInfo, error)
 	AddNewDiskToVg(disk, vgName string) error
 	RemoveDiskInVg(disk, vgName string) error
+	// CordonDisk stops new allocations on the pv, CordonedDisks returns the pvs cordoned by carina
+	CordonDisk(disk string) error
+	UncordonDisk(disk string) error
+	CordonedDisks() ([]string, error)
+	// DrainDisk moves the extents of the cordoned pv to the other pvs, then removes it from the vg
+	DrainDisk(disk, vgName string) (string, bool, error)
 
 	HealthCheck()
 	RefreshLvmCache()
+	// VolumeCondition returns true and the reason if the volume is abnormal
+	VolumeCondition(lvName, vgName string) (bool, string)
 
 	// CreateBcache bcache
 	CreateBcache(dev, cacheDev string, block, bucket string, cacheMode string) (*types.BcacheDeviceInfo, error)
 	DeleteBcache(dev, cacheDev string) error
 	BcacheDeviceInfo(dev string) (*types.BcacheDeviceInfo, error)
+	// BcacheCacheMode returns the active cache mode and the state of the bcache device on the backend device
+	BcacheCacheMode(dev string) (string, string, error)
+	// SetBcacheCacheMode changes the cache mode of the bcache device on the backend device
+	SetBcacheCacheMode(dev, cacheMode string) error
 
 	GetLv() lvmd.Lvm2
 }
@@ -18,9 +18,14 @@ package volume
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"github.com/carina-io/carina"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,6 +34,7 @@ import (
 	"github.com/carina-io/carina/pkg/devicemanager/bcache"
 	"github.com/carina-io/carina/pkg/devicemanager/lvmd"
 	"github.com/carina-io/carina/pkg/devicemanager/types"
+	"github.com/carina-io/carina/utils"
 	"github.com/carina-io/carina/utils/log"
 	"github.com/carina-io/carina/utils/mutx"
 	"google.golang.org/grpc/codes"
@@ -37,20 +43,674 @@ import (
 
 const (
 	VOLUMEMUTEX = "VolumeMutex"
+	// restoringTag 标记正在从快照复制数据的卷，复制完成后移除
+	restoringTag = "carina-restoring"
+	// cacheSuffix lvm原生缓存卷的名称后缀，挂载后缓存卷成为数据卷的隐藏子卷
+	cacheSuffix = "_cache"
+	// antiAffinityTagPrefix pv标签记录其上的反亲和卷，格式为carina.aa.<key的哈希>.<卷名>
+	antiAffinityTagPrefix = "carina.aa."
+	// cordonTag 标记由carina隔离的pv，取消隔离时只恢复带有此标签的pv
+	cordonTag = "carina.cordon"
 )
 
+// ErrBcacheNotActive bcache设备在NodeStageVolume时创建，卷未被挂载时不存在
+var ErrBcacheNotActive = errors.New("bcache device is not active")
+
 type LocalVolumeImplement struct {
 	Lv     lvmd.Lvm2
 	Bcache bcache.Bcache
 	Mutex  *mutx.GlobalLocks
 }
 
-func (v *LocalVolumeImplement) CreateVolume(lvName, vgName string, size, ratio uint64) error {
-	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
-		log.Info("wait other task release mutex, please retry...")
-		return errors.New("get global mutex failed")
+func (v *LocalVolumeImplement) CreateVolume(lvName, vgName string, size, ratio uint64, stripes uint, stripeSize string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	vgInfo, err := v.Lv.VGDisplay(vgName)
+	if err != nil {
+		log.Errorf("get device group info failed %s %s", vgName, err.Error())
+		return err
+	}
+	if vgInfo == nil {
+		log.Error("cannot find device group info")
+		return errors.New("cannot find device group info")
+	}
+
+	if vgInfo.VGFree-size < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { ////avoid edge conditions
+		log.Warnf("%s don't have enough space, reserved 10g", vgName)
+		return errors.New(carina.ResourceExhausted)
+	}
+
+	name := carina.VolumePrefix + lvName
+
+	lvInfo, _ := v.Lv.LVDisplay(name, vgName)
+	if lvInfo != nil && lvInfo.VGName == vgName {
+		log.Infof("%s/%s volume exists", vgName, name)
+		return nil
+	}
+
+	// 条带卷的每个条带需要落在不同的pv上
+	if stripes > 1 {
+		pvs, err := v.Lv.PVS()
+		if err != nil {
+			log.Errorf("get pv info failed %s %s", vgName, err.Error())
+			return err
+		}
+		if !api.StripesFit(pvPointers(pvs), vgName, size, stripes, 1) {
+			log.Warnf("%s don't have %d pvs with enough space for stripes", vgName, stripes)
+			return errors.New(carina.ResourceExhausted)
+		}
+	}
+
+	// 创建volume卷
+	return v.Lv.LVCreateFromVG(name, vgName, size, []string{}, stripes, stripeSize)
+}
+
+// CreateAntiAffinityVolume 反亲和的卷整体落在一个pv上，并选择没有同组卷的pv中剩余空间最大的一个，
+// 卷创建后在pv上添加标签，供同组的后续卷避开该pv
+func (v *LocalVolumeImplement) CreateAntiAffinityVolume(lvName, vgName string, size uint64, key string, required bool) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	vgInfo, err := v.Lv.VGDisplay(vgName)
+	if err != nil {
+		log.Errorf("get device group info failed %s %s", vgName, err.Error())
+		return err
+	}
+	if vgInfo == nil {
+		log.Error("cannot find device group info")
+		return errors.New("cannot find device group info")
+	}
+
+	name := carina.VolumePrefix + lvName
+	keyTag := antiAffinityKeyTag(key)
+
+	lvInfo, _ := v.Lv.LVDisplay(name, vgName)
+	if lvInfo != nil && lvInfo.VGName == vgName {
+		log.Infof("%s/%s volume exists", vgName, name)
+		// 上次创建卷后添加标签失败，重试时补上标签
+		return v.tagAntiAffinity(name, vgName, keyTag+lvName)
+	}
+
+	if vgInfo.VGFree < size || vgInfo.VGFree-size < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { //avoid edge conditions
+		log.Warnf("%s don't have enough space, reserved 10g", vgName)
+		return errors.New(carina.ResourceExhausted)
+	}
+
+	pvs, err := v.Lv.PVS()
+	if err != nil {
+		log.Errorf("get pv info failed %s %s", vgName, err.Error())
+		return err
+	}
+	pvTags, err := v.Lv.PVTags(vgName)
+	if err != nil {
+		log.Errorf("get pv tags failed %s %s", vgName, err.Error())
+		return err
+	}
+
+	pv := selectAntiAffinityPV(pvs, pvTags, vgName, size, keyTag)
+	if pv == "" {
+		if required {
+			log.Warnf("%s don't have pv with enough space apart from the volumes of anti-affinity key %s", vgName, key)
+			return errors.New(carina.ResourceExhausted)
+		}
+		// 没有可以避开同组卷的pv时退化为普通卷
+		log.Infof("no pv of %s is apart from the volumes of anti-affinity key %s, create %s as usual", vgName, key, name)
+		if err := v.Lv.LVCreateFromVG(name, vgName, size, []string{}, 0, ""); err != nil {
+			return err
+		}
+		return v.tagAntiAffinity(name, vgName, keyTag+lvName)
+	}
+
+	if err := v.Lv.LVCreateOnPVs(name, vgName, "", size, []string{pv}); err != nil {
+		return err
+	}
+	return v.Lv.PVAddTag(pv, keyTag+lvName)
+}
+
+// tagAntiAffinity 为卷所在的pv添加记录该卷的标签
+func (v *LocalVolumeImplement) tagAntiAffinity(name, vgName, tag string) error {
+	devices, err := v.Lv.LVDevices(name, vgName)
+	if err != nil {
+		log.Errorf("get volume devices failed %s/%s %s", vgName, name, err.Error())
+		return err
+	}
+	pvTags, err := v.Lv.PVTags(vgName)
+	if err != nil {
+		log.Errorf("get pv tags failed %s %s", vgName, err.Error())
+		return err
+	}
+	for _, device := range devices {
+		if utils.ContainsString(pvTags[device], tag) {
+			continue
+		}
+		if err := v.Lv.PVAddTag(device, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// antiAffinityKeyTag pv标签只允许有限的字符，使用key的哈希标识同组的卷
+func antiAffinityKeyTag(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("%s%x.", antiAffinityTagPrefix, sum[:8])
+}
+
+// selectAntiAffinityPV 在能容纳整个卷的pv中，选择没有同组卷且剩余空间最大的pv
+func selectAntiAffinityPV(pvs []api.PVInfo, pvTags map[string][]string, vgName string, size uint64, keyTag string) string {
+	var candidates []api.PVInfo
+	for _, pv := range pvs {
+		if pv.VGName != vgName || pv.PVFree < size || !pv.Allocatable() {
+			continue
+		}
+		shared := false
+		for _, tag := range pvTags[pv.PVName] {
+			if strings.HasPrefix(tag, keyTag) {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			candidates = append(candidates, pv)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].PVFree > candidates[j].PVFree
+	})
+	return candidates[0].PVName
+}
+
+// releaseAntiAffinity 删除卷后移除pv上记录该卷的标签
+func (v *LocalVolumeImplement) releaseAntiAffinity(lvName, vgName string) {
+	pvTags, err := v.Lv.PVTags(vgName)
+	if err != nil {
+		log.Warnf("get pv tags failed %s %s", vgName, err.Error())
+		return
+	}
+	for pv, tags := range pvTags {
+		for _, tag := range tags {
+			if !strings.HasPrefix(tag, antiAffinityTagPrefix) || !strings.HasSuffix(tag, "."+lvName) {
+				continue
+			}
+			if err := v.Lv.PVDelTag(pv, tag); err != nil {
+				log.Warnf("delete tag %s of pv %s failed %s", tag, pv, err.Error())
+			}
+		}
+	}
+}
+
+// pvPointers 转换为与NodeStorageResource中一致的pv列表
+func pvPointers(pvs []api.PVInfo) []*api.PVInfo {
+	result := make([]*api.PVInfo, 0, len(pvs))
+	for i := range pvs {
+		result = append(result, &pvs[i])
+	}
+	return result
+}
+
+// CreateRaidVolume 创建raid1/raid10卷，卷组需要有足够的pv容纳所有镜像
+func (v *LocalVolumeImplement) CreateRaidVolume(lvName, vgName string, size uint64, raidType string, mirrors, stripes uint, stripeSize string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	vgInfo, err := v.Lv.VGDisplay(vgName)
+	if err != nil {
+		log.Errorf("get device group info failed %s %s", vgName, err.Error())
+		return err
+	}
+	if vgInfo == nil {
+		log.Error("cannot find device group info")
+		return errors.New("cannot find device group info")
+	}
+
+	name := carina.VolumePrefix + lvName
+
+	lvInfo, _ := v.Lv.LVDisplay(name, vgName)
+	if lvInfo != nil && lvInfo.VGName == vgName {
+		log.Infof("%s/%s volume exists", vgName, name)
+		return nil
+	}
+
+	total := size * uint64(mirrors+1)
+	if vgInfo.VGFree < total || vgInfo.VGFree-total < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { //avoid edge conditions
+		log.Warnf("%s don't have enough space, reserved 10g", vgName)
+		return errors.New(carina.ResourceExhausted)
+	}
+
+	pvs, err := v.Lv.PVS()
+	if err != nil {
+		log.Errorf("get pv info failed %s %s", vgName, err.Error())
+		return err
+	}
+	if !api.StripesFit(pvPointers(pvs), vgName, size, stripes, mirrors+1) {
+		log.Warnf("%s don't have enough pvs for %s with %d mirrors", vgName, raidType, mirrors)
+		return errors.New(carina.ResourceExhausted)
+	}
+
+	return v.Lv.LVCreateRaid(name, vgName, raidType, size, mirrors, stripes, stripeSize, nil)
+}
+
+// RepairRaidVolumes 替换卷组中raid卷缺失的镜像，在卷组加入新磁盘后执行
+func (v *LocalVolumeImplement) RepairRaidVolumes(vgName string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	lvs, err := v.Lv.LVS(vgName)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, lv := range lvs {
+		if lv.VGName != vgName || !RaidDegraded(lv) {
+			continue
+		}
+		log.Infof("repair raid volume %s/%s", vgName, lv.LVName)
+		if err := v.Lv.LVRepair(lv.LVName, vgName); err != nil {
+			log.Errorf("repair raid volume %s/%s failed %s", vgName, lv.LVName, err.Error())
+			errs = append(errs, lv.LVName)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to repair raid volumes %s", strings.Join(errs, ","))
+	}
+	return nil
+}
+
+// RaidDegraded raid卷存在缺失或者需要刷新的镜像
+func RaidDegraded(lv types.LvInfo) bool {
+	if !lv.HasLayout("raid") {
+		return false
+	}
+	if len(lv.LVAttr) > 8 && lv.LVAttr[8] == 'p' {
+		return true
+	}
+	return lv.HealthStatus == "partial" || lv.HealthStatus == "refreshneeded"
+}
+
+// CreateCacheVolume 创建带有lvm原生缓存(dm-cache/writecache)的卷，数据卷优先落在旋转盘上，缓存卷优先落在非旋转盘上
+func (v *LocalVolumeImplement) CreateCacheVolume(lvName, vgName string, size, cacheSize uint64, cacheType, cacheMode string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	vgInfo, err := v.Lv.VGDisplay(vgName)
+	if err != nil {
+		log.Errorf("get device group info failed %s %s", vgName, err.Error())
+		return err
+	}
+	if vgInfo == nil {
+		log.Error("cannot find device group info")
+		return errors.New("cannot find device group info")
+	}
+
+	name := carina.VolumePrefix + lvName
+
+	lvInfo, _ := v.Lv.LVDisplay(name, vgName)
+	if lvInfo != nil && lvInfo.VGName == vgName && lvInfo.HasLayout(lvmCacheType(cacheType)) {
+		log.Infof("%s/%s volume exists", vgName, name)
+		return nil
+	}
+
+	pvs, err := v.Lv.PVS()
+	if err != nil {
+		log.Errorf("get pv info failed %s %s", vgName, err.Error())
+		return err
+	}
+	fast, slow := splitPVsByRotational(pvs, vgName)
+
+	// 数据卷已经存在时只需要挂载缓存卷
+	if lvInfo == nil {
+		total := size + cacheSize
+		if vgInfo.VGFree < total || vgInfo.VGFree-total < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { //avoid edge conditions
+			log.Warnf("%s don't have enough space, reserved 10g", vgName)
+			return errors.New(carina.ResourceExhausted)
+		}
+		if err := v.Lv.LVCreateOnPVs(name, vgName, "", size, slow); err != nil {
+			return err
+		}
+	}
+	return v.attachCache(name, vgName, cacheSize, cacheType, cacheMode, fast)
+}
+
+// ResizeCacheVolume 缓存卷不支持直接扩容，先移除缓存卷，扩容数据卷后按新的容量重新挂载缓存卷
+func (v *LocalVolumeImplement) ResizeCacheVolume(lvName, vgName string, size, cacheSize uint64, cacheType, cacheMode string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	vgInfo, err := v.Lv.VGDisplay(vgName)
+	if err != nil {
+		log.Errorf("get device group info failed %s %s", vgName, err.Error())
+		return err
+	}
+	if vgInfo == nil {
+		log.Error("cannot find device group info")
+		return errors.New("cannot find device group info")
+	}
+
+	name := carina.VolumePrefix + lvName
+
+	lvInfo, err := v.Lv.LVDisplay(name, vgName)
+	if err != nil || lvInfo == nil {
+		log.Infof("%s/%s volume don't exists", vgName, name)
+		return errors.New("volume don't exists")
+	}
+	cached := lvInfo.HasLayout(lvmCacheType(cacheType))
+	if lvInfo.LVSize >= size && cached {
+		log.Infof("%s/%s have expend", vgName, lvName)
+		return nil
+	}
+
+	// 移除的缓存卷空间会归还卷组
+	var oldCacheSize uint64
+	if cached && size > 0 {
+		oldCacheSize = cacheSize * lvInfo.LVSize / size
+	}
+	var growth uint64
+	if size > lvInfo.LVSize {
+		growth = size - lvInfo.LVSize
+	}
+	free := vgInfo.VGFree + oldCacheSize
+	if free < growth+cacheSize || free-growth-cacheSize < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { //avoid edge conditions
+		log.Warnf("%s don't have enough space, reserved 10g", vgName)
+		return errors.New(carina.ResourceExhausted)
+	}
+
+	pvs, err := v.Lv.PVS()
+	if err != nil {
+		log.Errorf("get pv info failed %s %s", vgName, err.Error())
+		return err
+	}
+	fast, _ := splitPVsByRotational(pvs, vgName)
+
+	if cached {
+		if err := v.Lv.LVUncache(name, vgName); err != nil {
+			return err
+		}
+	}
+	if lvInfo.LVSize < size {
+		if err := v.Lv.LVResize(name, vgName, size); err != nil {
+			return err
+		}
+	}
+	return v.attachCache(name, vgName, cacheSize, cacheType, cacheMode, fast)
+}
+
+// attachCache 创建缓存卷并挂载到数据卷上，dm-cache使用cache pool，writecache使用cachevol
+func (v *LocalVolumeImplement) attachCache(name, vgName string, cacheSize uint64, cacheType, cacheMode string, pvs []string) error {
+	cacheName := name + cacheSuffix
+	segType := ""
+	if cacheType == carina.CacheTypeDmCache {
+		segType = "cache-pool"
+	}
+	if cacheInfo, _ := v.Lv.LVDisplay(cacheName, vgName); cacheInfo == nil {
+		if err := v.Lv.LVCreateOnPVs(cacheName, vgName, segType, cacheSize, pvs); err != nil {
+			return err
+		}
+	}
+	if err := v.Lv.LVAttachCache(name, cacheName, vgName, lvmCacheType(cacheType), cacheMode); err != nil {
+		// 挂载失败时删除缓存卷，重试时重新创建
+		_ = v.Lv.LVRemove(cacheName, vgName)
+		return err
+	}
+	return nil
+}
+
+// lvmCacheType 挂载缓存后数据卷的lv_layout
+func lvmCacheType(cacheType string) string {
+	if cacheType == carina.CacheTypeWritecache {
+		return "writecache"
+	}
+	return "cache"
+}
+
+// splitPVsByRotational 按是否为旋转盘划分卷组中的pv，卷组中只有一类磁盘时不指定pv
+func splitPVsByRotational(pvs []api.PVInfo, vgName string) ([]string, []string) {
+	var fast, slow []string
+	for _, pv := range pvs {
+		if pv.VGName != vgName {
+			continue
+		}
+		if rotational(pv.PVName) {
+			slow = append(slow, pv.PVName)
+		} else {
+			fast = append(fast, pv.PVName)
+		}
+	}
+	if len(fast) == 0 || len(slow) == 0 {
+		log.Warnf("%s don't have both rotational and non-rotational pvs, the cache is placed by lvm", vgName)
+		return nil, nil
+	}
+	return fast, slow
+}
+
+// rotational 分区没有queue目录，读取其所在磁盘的属性
+func rotational(dev string) bool {
+	if target, err := filepath.EvalSymlinks(dev); err == nil {
+		dev = target
+	}
+	sysPath := filepath.Join("/sys/class/block", filepath.Base(dev))
+	value, err := os.ReadFile(filepath.Join(sysPath, "queue", "rotational"))
+	if err != nil {
+		value, err = os.ReadFile(filepath.Join(sysPath, "..", "queue", "rotational"))
+	}
+	if err != nil {
+		return true
+	}
+	return strings.TrimSpace(string(value)) == "1"
+}
+
+func (v *LocalVolumeImplement) DeleteVolume(lvName, vgName string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	name := lvName
+	if !strings.HasPrefix(lvName, carina.VolumePrefix) {
+		name = carina.VolumePrefix + lvName
+	}
+
+	lvInfo, err := v.Lv.LVDisplay(name, vgName)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		log.Warnf("volume %s/%s not exist", vgName, lvName)
+		return nil
+	}
+	if err != nil {
+		log.Errorf("get volume failed %s/%s %s", vgName, lvName, err.Error())
+		return err
+	}
+	// delete bcache device if exists
+	_ = v.DeleteBcache(fmt.Sprintf("/dev/%s/%s", vgName, name), "")
+
+	if err := v.Lv.LVRemove(name, vgName); err != nil {
+		return err
+	}
+	v.releaseAntiAffinity(strings.TrimPrefix(name, carina.VolumePrefix), vgName)
+
+	// the lvm cache is removed together with the volume, unless it is detached by a failed resize
+	if cacheInfo, _ := v.Lv.LVDisplay(name+cacheSuffix, vgName); cacheInfo != nil {
+		_ = v.Lv.LVRemove(name+cacheSuffix, vgName)
+	}
+
+	// the shared thin pool is kept for other thin volumes
+	if lvInfo.PoolLV == "" || lvInfo.PoolLV == carina.ThinPoolName {
+		return nil
+	}
+
+	// backward compatible，克隆及快照恢复的卷也创建在源卷的thin pool中，池中没有其他卷时才删除
+	thinInfo, _ := v.Lv.LVDisplay(lvInfo.PoolLV, vgName)
+	if thinInfo == nil {
+		log.Error("cannot find thin info")
+		return nil
+	}
+	if thinInfo.ThinCount > 0 {
+		log.Infof("thin pool %s/%s still has %d volumes, skip deleting", vgName, lvInfo.PoolLV, thinInfo.ThinCount)
+		return nil
+	}
+	return v.Lv.DeleteThinPool(lvInfo.PoolLV, vgName)
+}
+
+func (v *LocalVolumeImplement) ResizeVolume(lvName, vgName string, size, ratio uint64) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	// vg 检查
+	vgInfo, err := v.Lv.VGDisplay(vgName)
+	if err != nil {
+		log.Errorf("get device group info failed %s %s", vgName, err.Error())
+		return err
+	}
+	if vgInfo == nil {
+		log.Error("cannot find device group info")
+		return errors.New("cannot find device group info")
+	}
+
+	name := carina.VolumePrefix + lvName
+
+	lvInfo, err := v.Lv.LVDisplay(name, vgName)
+	if err != nil {
+		log.Errorf("get volume info failed %s/%s %s", vgName, name, err.Error())
+		return nil
+	}
+	if lvInfo == nil {
+		log.Infof("%s/%s volume don't exists", vgName, name)
+		return errors.New("volume don't exists")
+	}
+
+	if lvInfo.LVSize == size {
+		log.Infof("%s/%s have expend", vgName, lvName)
+		return nil
+	}
+
+	if vgInfo.VGFree-(size-lvInfo.LVSize) < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { //avoid edge conditions
+		log.Warnf("%s don't have enough space, reserved 10g", vgName)
+		return errors.New(carina.ResourceExhausted)
+	}
+
+	// backward compatible
+	thinInfo, _ := v.Lv.LVDisplay(lvInfo.PoolLV, vgName)
+	if thinInfo != nil && thinInfo.LVSize < size {
+		if err := v.Lv.ResizeThinPool(lvInfo.PoolLV, vgName, size*ratio); err != nil {
+			return err
+		}
+	}
+
+	return v.Lv.LVResize(name, vgName, size)
+}
+
+// CreateThinVolume 在卷组共享的thin pool中创建卷，thin pool按照超分比例自动创建及扩容
+func (v *LocalVolumeImplement) CreateThinVolume(lvName, vgName string, size uint64, overcommit float64) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	name := carina.VolumePrefix + lvName
+
+	lvInfo, _ := v.Lv.LVDisplay(name, vgName)
+	if lvInfo != nil && lvInfo.VGName == vgName {
+		log.Infof("%s/%s volume exists", vgName, name)
+		return nil
+	}
+
+	_, virtualSize, err := v.ThinPoolUsage(vgName)
+	if err != nil {
+		return err
+	}
+	if err := v.ensureThinPool(vgName, virtualSize+size, overcommit); err != nil {
+		return err
+	}
+
+	return v.Lv.LVCreateFromPool(name, carina.ThinPoolName, vgName, size)
+}
+
+// ResizeThinVolume 扩容thin卷，thin pool不足时按照超分比例扩容
+func (v *LocalVolumeImplement) ResizeThinVolume(lvName, vgName string, size uint64, overcommit float64) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	name := carina.VolumePrefix + lvName
+
+	lvInfo, err := v.Lv.LVDisplay(name, vgName)
+	if err != nil || lvInfo == nil {
+		log.Errorf("get volume info failed %s/%s %v", vgName, name, err)
+		return errors.New("volume don't exists")
+	}
+
+	if lvInfo.LVSize >= size {
+		log.Infof("%s/%s have expend", vgName, lvName)
+		return nil
+	}
+
+	_, virtualSize, err := v.ThinPoolUsage(vgName)
+	if err != nil {
+		return err
+	}
+	if err := v.ensureThinPool(vgName, virtualSize-lvInfo.LVSize+size, overcommit); err != nil {
+		return err
+	}
+
+	return v.Lv.LVResize(name, vgName, size)
+}
+
+// ThinPoolUsage 返回卷组共享thin pool的大小以及池中所有thin卷的总大小
+func (v *LocalVolumeImplement) ThinPoolUsage(vgName string) (uint64, uint64, error) {
+	lvs, err := v.Lv.LVS(vgName)
+	if err != nil {
+		return 0, 0, err
 	}
-	defer v.Mutex.Release(VOLUMEMUTEX)
+	var poolSize, virtualSize uint64
+	for _, lv := range lvs {
+		if lv.VGName != vgName {
+			continue
+		}
+		if lv.LVName == carina.ThinPoolName {
+			poolSize = lv.LVSize
+		}
+		if lv.PoolLV == carina.ThinPoolName {
+			virtualSize += lv.LVSize
+		}
+	}
+	return poolSize, virtualSize, nil
+}
+
+// ensureThinPool 保证thin pool大小不小于 virtualSize/overcommit
+func (v *LocalVolumeImplement) ensureThinPool(vgName string, virtualSize uint64, overcommit float64) error {
+	if overcommit < 1 {
+		overcommit = 1
+	}
+	required := uint64(math.Ceil(float64(virtualSize) / overcommit))
+	// lvm 以GB为单位分配
+	required = (required + 1<<30 - 1) >> 30 << 30
 
 	vgInfo, err := v.Lv.VGDisplay(vgName)
 	if err != nil {
@@ -62,109 +722,232 @@ func (v *LocalVolumeImplement) CreateVolume(lvName, vgName string, size, ratio u
 		return errors.New("cannot find device group info")
 	}
 
-	if vgInfo.VGFree-size < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { ////avoid edge conditions
-		log.Warnf("%s don't have enough space, reserved 10g", vgName)
+	poolInfo, _ := v.Lv.LVDisplay(carina.ThinPoolName, vgName)
+	var poolSize uint64
+	if poolInfo != nil {
+		poolSize = poolInfo.LVSize
+	}
+	if poolInfo != nil && poolSize >= required {
+		return nil
+	}
+
+	delta := required - poolSize
+	if vgInfo.VGFree < delta || vgInfo.VGFree-delta < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { //avoid edge conditions
+		log.Warnf("%s don't have enough space for thin pool, reserved 10g", vgName)
 		return errors.New(carina.ResourceExhausted)
 	}
 
-	name := carina.VolumePrefix + lvName
+	if poolInfo == nil {
+		log.Infof("create thin pool %s/%s size %d", vgName, carina.ThinPoolName, required)
+		return v.Lv.CreateThinPool(carina.ThinPoolName, vgName, required)
+	}
+	log.Infof("resize thin pool %s/%s from %d to %d", vgName, carina.ThinPoolName, poolSize, required)
+	return v.Lv.ResizeThinPool(carina.ThinPoolName, vgName, required)
+}
 
-	lvInfo, _ := v.Lv.LVDisplay(name, vgName)
-	if lvInfo != nil && lvInfo.VGName == vgName {
-		log.Infof("%s/%s volume exists", vgName, name)
+// CreateSnapshot thin卷创建thin快照，普通卷创建与源卷等大的COW快照
+func (v *LocalVolumeImplement) CreateSnapshot(snapName, lvName, vgName string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	name := carina.SnapshotPrefix + snapName
+	snapInfo, _ := v.Lv.LVDisplay(name, vgName)
+	if snapInfo != nil && snapInfo.VGName == vgName {
+		log.Infof("%s/%s snapshot exists", vgName, name)
 		return nil
 	}
 
-	// 创建volume卷
-	return v.Lv.LVCreateFromVG(name, vgName, size, []string{}, 0, "")
+	lvInfo, err := v.Lv.LVDisplay(lvName, vgName)
+	if err != nil {
+		log.Errorf("get volume failed %s/%s %s", vgName, lvName, err.Error())
+		return err
+	}
+	if lvInfo == nil {
+		return fmt.Errorf("volume %s/%s not found", vgName, lvName)
+	}
+
+	var size uint64
+	if lvInfo.PoolLV == "" {
+		vgInfo, err := v.Lv.VGDisplay(vgName)
+		if err != nil {
+			log.Errorf("get device group info failed %s %s", vgName, err.Error())
+			return err
+		}
+		if vgInfo == nil {
+			log.Error("cannot find device group info")
+			return errors.New("cannot find device group info")
+		}
+		size = lvInfo.LVSize
+		if vgInfo.VGFree < size || vgInfo.VGFree-size < carina.DefaultReservedSpace-carina.DefaultEdgeSpace {
+			log.Warnf("%s don't have enough space, reserved 10g", vgName)
+			return errors.New(carina.ResourceExhausted)
+		}
+	}
+
+	return v.Lv.CreateSnapshot(name, lvName, vgName, size)
 }
 
-func (v *LocalVolumeImplement) DeleteVolume(lvName, vgName string) error {
+func (v *LocalVolumeImplement) DeleteSnapshot(snapName, vgName string) error {
 	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
 		log.Info("wait other task release mutex, please retry...")
 		return errors.New("get global mutex failed")
 	}
 	defer v.Mutex.Release(VOLUMEMUTEX)
 
-	name := lvName
-	if !strings.HasPrefix(lvName, carina.VolumePrefix) {
-		name = carina.VolumePrefix + lvName
+	name := snapName
+	if !strings.HasPrefix(snapName, carina.SnapshotPrefix) {
+		name = carina.SnapshotPrefix + snapName
 	}
 
-	lvInfo, err := v.Lv.LVDisplay(name, vgName)
+	_, err := v.Lv.LVDisplay(name, vgName)
 	if err != nil && strings.Contains(err.Error(), "not found") {
-		log.Warnf("volume %s/%s not exist", vgName, lvName)
+		log.Warnf("snapshot %s/%s not exist", vgName, name)
 		return nil
 	}
 	if err != nil {
-		log.Errorf("get volume failed %s/%s %s", vgName, lvName, err.Error())
+		log.Errorf("get snapshot failed %s/%s %s", vgName, name, err.Error())
 		return err
 	}
-	// delete bcache device if exists
-	_ = v.DeleteBcache(fmt.Sprintf("/dev/%s/%s", vgName, name), "")
+	return v.Lv.DeleteSnapshot(name, vgName)
+}
 
-	if err := v.Lv.LVRemove(name, vgName); err != nil {
+// CreateVolumeFromSnapshot thin快照直接创建thin卷，普通快照则创建新卷并复制快照数据
+func (v *LocalVolumeImplement) CreateVolumeFromSnapshot(lvName, vgName, snapName string, size uint64, raidType string, mirrors, stripes uint, stripeSize string) error {
+	name := carina.VolumePrefix + lvName
+	snap := snapName
+	if !strings.HasPrefix(snapName, carina.SnapshotPrefix) {
+		snap = carina.SnapshotPrefix + snapName
+	}
+
+	needCopy, err := v.prepareVolumeFromSnapshot(name, vgName, snap, size, raidType, mirrors, stripes, stripeSize)
+	if err != nil || !needCopy {
 		return err
 	}
 
-	// backward compatible
-	thinInfo, _ := v.Lv.LVDisplay(lvInfo.PoolLV, vgName)
-	if thinInfo == nil {
-		log.Error("cannot find thin info")
+	// 复制数据耗时较长，不持有全局锁，依靠restoringTag保证中断后可以重新复制
+	log.Infof("copy snapshot %s/%s to volume %s", vgName, snap, name)
+	if err := v.Lv.LVCopy(snap, name, vgName); err != nil {
+		return err
+	}
+	return v.Lv.LVDelTag(name, vgName, restoringTag)
+}
+
+// CreateVolumeFromVolume thin卷直接创建thin快照卷，普通卷则通过临时快照复制数据
+func (v *LocalVolumeImplement) CreateVolumeFromVolume(lvName, vgName, srcLvName string, size uint64, raidType string, mirrors, stripes uint, stripeSize string) (err error) {
+	name := carina.VolumePrefix + lvName
+	srcName := srcLvName
+	if !strings.HasPrefix(srcLvName, carina.VolumePrefix) {
+		srcName = carina.VolumePrefix + srcLvName
+	}
+
+	lvInfo, _ := v.Lv.LVDisplay(name, vgName)
+	if lvInfo != nil && !strings.Contains(lvInfo.LVTags, restoringTag) {
+		log.Infof("%s/%s volume exists", vgName, name)
 		return nil
 	}
-	return v.Lv.DeleteThinPool(lvInfo.PoolLV, vgName)
+
+	srcInfo, err := v.Lv.LVDisplay(srcName, vgName)
+	if err != nil {
+		log.Errorf("get volume failed %s/%s %s", vgName, srcName, err.Error())
+		return err
+	}
+	if srcInfo.PoolLV != "" {
+		_, err := v.prepareVolumeFromSnapshot(name, vgName, srcName, size, raidType, mirrors, stripes, stripeSize)
+		return err
+	}
+
+	// 普通卷的数据在复制期间可能被修改，先创建快照保证数据一致，无论成功与否都删除临时快照，重试时重新创建
+	tmpSnap := "clone-" + lvName
+	defer func() {
+		if delErr := v.DeleteSnapshot(tmpSnap, vgName); delErr != nil {
+			log.Errorf("delete clone snapshot failed %s/%s %s", vgName, tmpSnap, delErr.Error())
+			if err == nil {
+				err = delErr
+			}
+		}
+	}()
+	if err := v.CreateSnapshot(tmpSnap, srcName, vgName); err != nil {
+		return err
+	}
+	return v.CreateVolumeFromSnapshot(lvName, vgName, tmpSnap, size, raidType, mirrors, stripes, stripeSize)
 }
 
-func (v *LocalVolumeImplement) ResizeVolume(lvName, vgName string, size, ratio uint64) error {
+// prepareVolumeFromSnapshot thin快照直接创建thin卷，否则按源卷的raid及条带布局创建需要复制数据的卷
+func (v *LocalVolumeImplement) prepareVolumeFromSnapshot(name, vgName, snap string, size uint64, raidType string, mirrors, stripes uint, stripeSize string) (bool, error) {
 	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
 		log.Info("wait other task release mutex, please retry...")
-		return errors.New("get global mutex failed")
+		return false, errors.New("get global mutex failed")
 	}
 	defer v.Mutex.Release(VOLUMEMUTEX)
 
-	// vg 检查
-	vgInfo, err := v.Lv.VGDisplay(vgName)
+	snapInfo, err := v.Lv.LVDisplay(snap, vgName)
 	if err != nil {
-		log.Errorf("get device group info failed %s %s", vgName, err.Error())
-		return err
+		log.Errorf("get snapshot failed %s/%s %s", vgName, snap, err.Error())
+		return false, err
 	}
-	if vgInfo == nil {
-		log.Error("cannot find device group info")
-		return errors.New("cannot find device group info")
+
+	lvInfo, _ := v.Lv.LVDisplay(name, vgName)
+	if snapInfo.PoolLV != "" {
+		if lvInfo == nil {
+			if err := v.Lv.LVCreateFromSnapshot(name, snap, vgName); err != nil {
+				return false, err
+			}
+		}
+		if size > snapInfo.LVSize && (lvInfo == nil || lvInfo.LVSize < size) {
+			return false, v.Lv.LVResize(name, vgName, size)
+		}
+		return false, nil
 	}
 
-	name := carina.VolumePrefix + lvName
+	if lvInfo != nil {
+		if !strings.Contains(lvInfo.LVTags, restoringTag) {
+			log.Infof("%s/%s volume exists", vgName, name)
+			return false, nil
+		}
+		return true, nil
+	}
 
-	lvInfo, err := v.Lv.LVDisplay(name, vgName)
+	vgInfo, err := v.Lv.VGDisplay(vgName)
 	if err != nil {
-		log.Errorf("get volume info failed %s/%s %s", vgName, name, err.Error())
-		return nil
+		log.Errorf("get device group info failed %s %s", vgName, err.Error())
+		return false, err
 	}
-	if lvInfo == nil {
-		log.Infof("%s/%s volume don't exists", vgName, name)
-		return errors.New("volume don't exists")
+	if vgInfo == nil {
+		log.Error("cannot find device group info")
+		return false, errors.New("cannot find device group info")
 	}
-
-	if lvInfo.LVSize == size {
-		log.Infof("%s/%s have expend", vgName, lvName)
-		return nil
+	var copies uint = 1
+	if raidType != "" {
+		copies = mirrors + 1
 	}
-
-	if vgInfo.VGFree-(size-lvInfo.LVSize) < carina.DefaultReservedSpace-carina.DefaultEdgeSpace { //avoid edge conditions
+	total := size * uint64(copies)
+	if vgInfo.VGFree < total || vgInfo.VGFree-total < carina.DefaultReservedSpace-carina.DefaultEdgeSpace {
 		log.Warnf("%s don't have enough space, reserved 10g", vgName)
-		return errors.New(carina.ResourceExhausted)
+		return false, errors.New(carina.ResourceExhausted)
 	}
-
-	// backward compatible
-	thinInfo, _ := v.Lv.LVDisplay(lvInfo.PoolLV, vgName)
-	if thinInfo != nil && thinInfo.LVSize < size {
-		if err := v.Lv.ResizeThinPool(lvInfo.PoolLV, vgName, size*ratio); err != nil {
-			return err
+	if raidType != "" || stripes > 1 {
+		pvs, err := v.Lv.PVS()
+		if err != nil {
+			log.Errorf("get pv info failed %s %s", vgName, err.Error())
+			return false, err
+		}
+		if !api.StripesFit(pvPointers(pvs), vgName, size, stripes, copies) {
+			log.Warnf("%s don't have enough pvs for %d stripes with %d copies", vgName, stripes, copies)
+			return false, errors.New(carina.ResourceExhausted)
 		}
 	}
-
-	return v.Lv.LVResize(name, vgName, size)
+	if raidType != "" {
+		err = v.Lv.LVCreateRaid(name, vgName, raidType, size, mirrors, stripes, stripeSize, []string{restoringTag})
+	} else {
+		err = v.Lv.LVCreateFromVG(name, vgName, size, []string{restoringTag}, stripes, stripeSize)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func (v *LocalVolumeImplement) VolumeList(lvName, vgName string) ([]types.LvInfo, error) {
@@ -190,6 +973,39 @@ func (v *LocalVolumeImplement) VolumeInfo(lvName, vgName string) (*types.LvInfo,
 	return nil, errors.New("not found")
 }
 
+// VolumeCondition 检查卷是否激活、卷组是否缺失磁盘以及bcache是否脱离缓存盘
+func (v *LocalVolumeImplement) VolumeCondition(lvName, vgName string) (bool, string) {
+	lvInfo, err := v.VolumeInfo(lvName, vgName)
+	if err != nil {
+		return true, fmt.Sprintf("logic volume %s/%s is not found: %s", vgName, lvName, err.Error())
+	}
+	if lvInfo.LVActive != "active" {
+		return true, fmt.Sprintf("logic volume %s/%s is %s", vgName, lvName, lvInfo.LVActive)
+	}
+	// the 9th attribute bit of lv is p(partial) when one or more of the physical volumes are missing
+	if len(lvInfo.LVAttr) > 8 && lvInfo.LVAttr[8] == 'p' {
+		return true, fmt.Sprintf("physical volume of logic volume %s/%s is missing", vgName, lvName)
+	}
+
+	devicePath := fmt.Sprintf("/dev/%s/%s", vgName, lvName)
+	bcacheInfo, err := v.BcacheDeviceInfo(devicePath)
+	if err != nil || !strings.HasPrefix(bcacheInfo.Name, "bcache") {
+		return false, ""
+	}
+	state, err := v.Bcache.GetBcacheState(bcacheInfo.Name)
+	if err != nil {
+		log.Warnf("get bcache %s state failed %s", bcacheInfo.Name, err.Error())
+		return false, ""
+	}
+	if state == "no cache" {
+		return true, fmt.Sprintf("bcache backing device %s of %s is detached from cache device", devicePath, bcacheInfo.Name)
+	}
+	if state == "inconsistent" {
+		return true, fmt.Sprintf("bcache device %s is inconsistent", bcacheInfo.Name)
+	}
+	return false, ""
+}
+
 func (v *LocalVolumeImplement) GetCurrentVgStruct() ([]api.VgGroup, error) {
 
 	resp := []api.VgGroup{}
@@ -344,6 +1160,148 @@ func (v *LocalVolumeImplement) RemoveDiskInVg(disk, vgName string) error {
 	return nil
 }
 
+// CordonDisk 禁止在pv上分配新的空间，已有的卷不受影响
+func (v *LocalVolumeImplement) CordonDisk(disk string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	pv, err := v.findPV(disk)
+	if err != nil {
+		return err
+	}
+	if pv.VGName == "" {
+		return fmt.Errorf("pv %s is not in any vg", disk)
+	}
+	pvTags, err := v.Lv.PVTags(pv.VGName)
+	if err != nil {
+		return err
+	}
+	if !utils.ContainsString(pvTags[disk], cordonTag) {
+		if err := v.Lv.PVAddTag(disk, cordonTag); err != nil {
+			return err
+		}
+	}
+	if pv.Allocatable() {
+		log.Infof("cordon pv %s of vg %s", disk, pv.VGName)
+		return v.Lv.PVChangeAllocatable(disk, false)
+	}
+	return nil
+}
+
+// UncordonDisk 恢复在pv上分配空间
+func (v *LocalVolumeImplement) UncordonDisk(disk string) error {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	log.Infof("uncordon pv %s", disk)
+	if err := v.Lv.PVChangeAllocatable(disk, true); err != nil {
+		return err
+	}
+	return v.Lv.PVDelTag(disk, cordonTag)
+}
+
+// CordonedDisks 返回由carina隔离的pv
+func (v *LocalVolumeImplement) CordonedDisks() ([]string, error) {
+	vgs, err := v.Lv.VGS()
+	if err != nil {
+		return nil, err
+	}
+	var disks []string
+	for _, vg := range vgs {
+		pvTags, err := v.Lv.PVTags(vg.VGName)
+		if err != nil {
+			return nil, err
+		}
+		for pv, tags := range pvTags {
+			if utils.ContainsString(tags, cordonTag) {
+				disks = append(disks, pv)
+			}
+		}
+	}
+	sort.Strings(disks)
+	return disks, nil
+}
+
+// DrainDisk 将已隔离的pv上的数据迁移到卷组中的其他pv，迁移完成后移出卷组
+// 返回迁移进度百分比及是否已移出卷组，卷组中其他pv的剩余空间不足时拒绝迁移
+func (v *LocalVolumeImplement) DrainDisk(disk, vgName string) (string, bool, error) {
+	progress, moved, err := v.moveDisk(disk, vgName)
+	if err != nil || !moved {
+		return progress, false, err
+	}
+	// 数据迁移完成后移出卷组
+	if err := v.RemoveDiskInVg(disk, vgName); err != nil {
+		return progress, false, err
+	}
+	return progress, true, nil
+}
+
+// moveDisk 返回pv上的数据是否已全部迁移
+func (v *LocalVolumeImplement) moveDisk(disk, vgName string) (string, bool, error) {
+	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
+		log.Info("wait other task release mutex, please retry...")
+		return "", false, errors.New("get global mutex failed")
+	}
+	defer v.Mutex.Release(VOLUMEMUTEX)
+
+	moving, err := v.Lv.PVMoveProgress(vgName)
+	if err != nil {
+		return "", false, err
+	}
+	if progress, ok := moving[disk]; ok {
+		return progress, false, nil
+	}
+	pvs, err := v.Lv.PVS()
+	if err != nil {
+		return "", false, err
+	}
+	var pv *api.PVInfo
+	var otherFree uint64
+	for i := range pvs {
+		if pvs[i].PVName == disk {
+			pv = &pvs[i]
+		} else if pvs[i].VGName == vgName && pvs[i].Allocatable() {
+			otherFree += pvs[i].PVFree
+		}
+	}
+	if pv == nil || pv.VGName != vgName {
+		return "", false, fmt.Errorf("pv %s is not in vg %s", disk, vgName)
+	}
+	used := pv.PVSize - pv.PVFree
+	if used == 0 {
+		return "100.00", true, nil
+	}
+	// 与RemoveDiskInVg一致，迁移后卷组仍需保留预留空间
+	if otherFree+carina.DefaultEdgeSpace < used+carina.DefaultReservedSpace {
+		return "", false, fmt.Errorf("%s: the other pvs of vg %s have %d bytes free, not enough for %d bytes of pv %s", carina.ResourceExhausted, vgName, otherFree, used, disk)
+	}
+	log.Infof("move %d bytes of pv %s in vg %s", used, disk, vgName)
+	if err := v.Lv.PVMove(disk); err != nil {
+		return "", false, err
+	}
+	return "0.00", false, nil
+}
+
+// findPV 返回pv的信息
+func (v *LocalVolumeImplement) findPV(disk string) (*api.PVInfo, error) {
+	pvs, err := v.Lv.PVS()
+	if err != nil {
+		return nil, err
+	}
+	for i := range pvs {
+		if pvs[i].PVName == disk {
+			return &pvs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("pv %s not found", disk)
+}
+
 func (v *LocalVolumeImplement) HealthCheck() {
 	if !v.Mutex.TryAcquire(VOLUMEMUTEX) {
 		log.Info("wait other task release mutex, please retry...")
@@ -427,6 +1385,47 @@ func (v *LocalVolumeImplement) DeleteBcache(dev, cacheDev string) error {
 	return nil
 }
 
+// BcacheCacheMode the dirty data in the cache is still written back after switching to writethrough, the state is dirty until it is drained
+func (v *LocalVolumeImplement) BcacheCacheMode(dev string) (string, string, error) {
+	deviceInfo, err := v.activeBcache(dev)
+	if err != nil {
+		return "", "", err
+	}
+	cacheMode, err := v.Bcache.GetCacheMode(deviceInfo.Name)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := v.Bcache.GetBcacheState(deviceInfo.Name)
+	if err != nil {
+		return "", "", err
+	}
+	return cacheMode, state, nil
+}
+
+func (v *LocalVolumeImplement) SetBcacheCacheMode(dev, cacheMode string) error {
+	deviceInfo, err := v.activeBcache(dev)
+	if err != nil {
+		return err
+	}
+	if err = v.Bcache.SetCacheMode(deviceInfo.Name, cacheMode); err != nil {
+		log.Errorf("set cache mode failed %s %s", deviceInfo.Name, err.Error())
+		return err
+	}
+	return nil
+}
+
+// activeBcache returns the bcache device registered on the backend device, the bcache device exists only when the volume is staged
+func (v *LocalVolumeImplement) activeBcache(dev string) (*types.BcacheDeviceInfo, error) {
+	deviceInfo, err := v.Bcache.GetDeviceBcache(dev)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(deviceInfo.Name, "bcache") {
+		return nil, ErrBcacheNotActive
+	}
+	return deviceInfo, nil
+}
+
 func (v *LocalVolumeImplement) BcacheDeviceInfo(dev string) (*types.BcacheDeviceInfo, error) {
 	bcacheInfo, err := v.Bcache.ShowDevice(dev)
 	if err != nil {
@@ -0,0 +1,88 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/carina-io/carina/pkg/devicemanager/bcache"
+	"github.com/carina-io/carina/pkg/devicemanager/lvmd"
+	"github.com/carina-io/carina/pkg/devicemanager/types"
+	"github.com/carina-io/carina/utils/mutx"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLvm 只实现删除卷用到的方法，thin pool的thin_count随池中卷的删除而减少
+type fakeLvm struct {
+	lvmd.Lvm2
+	lvs map[string]*types.LvInfo
+}
+
+func (f *fakeLvm) LVDisplay(lv, vg string) (*types.LvInfo, error) {
+	info, ok := f.lvs[lv]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return info, nil
+}
+
+func (f *fakeLvm) LVRemove(lv, vg string) error {
+	info, ok := f.lvs[lv]
+	if !ok {
+		return errors.New("not found")
+	}
+	if pool, ok := f.lvs[info.PoolLV]; ok {
+		pool.ThinCount--
+	}
+	delete(f.lvs, lv)
+	return nil
+}
+
+func (f *fakeLvm) DeleteThinPool(lv, vg string) error {
+	return f.LVRemove(lv, vg)
+}
+
+func (f *fakeLvm) PVTags(vg string) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
+
+type fakeBcache struct {
+	bcache.Bcache
+}
+
+func (f *fakeBcache) ShowDevice(dev string) (*types.BcacheDeviceInfo, error) {
+	return nil, errors.New("exit status 2")
+}
+
+func TestDeleteVolumeInLegacyThinPool(t *testing.T) {
+	lv := &fakeLvm{lvs: map[string]*types.LvInfo{
+		"thin-pvc-a":   {LVName: "thin-pvc-a", ThinCount: 2},
+		"volume-pvc-a": {LVName: "volume-pvc-a", PoolLV: "thin-pvc-a"},
+		"volume-pvc-b": {LVName: "volume-pvc-b", PoolLV: "thin-pvc-a"},
+	}}
+	v := &LocalVolumeImplement{Lv: lv, Bcache: &fakeBcache{}, Mutex: mutx.NewGlobalLocks()}
+
+	// the source volume is deleted first, the pool is kept for the clone
+	assert.NoError(t, v.DeleteVolume("pvc-a", "carina-vg-hdd"))
+	assert.NotContains(t, lv.lvs, "volume-pvc-a")
+	assert.Contains(t, lv.lvs, "volume-pvc-b")
+	assert.Contains(t, lv.lvs, "thin-pvc-a")
+
+	assert.NoError(t, v.DeleteVolume("pvc-b", "carina-vg-hdd"))
+	assert.Empty(t, lv.lvs)
+}
@@ -0,0 +1,216 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/carina-io/carina"
+	"github.com/carina-io/carina/pkg/csidriver/driver/k8s"
+	"github.com/carina-io/carina/pkg/devicemanager/bcache"
+)
+
+const (
+	bcacheSubSystem string = "bcache_stats"
+	// the bcache directory of the backend device is shared with /sys/block/bcacheN/bcache
+	sysDevBlockPath = "/sys/dev/block"
+)
+
+var (
+	bcacheModeLabels = append(append([]string{}, deviceStatLabels...), "mode")
+
+	bcacheHitsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_hits_total"),
+		"The total number of reads and writes hit the cache.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheMissesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_misses_total"),
+		"The total number of reads and writes missed the cache.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheBypassHitsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_bypass_hits_total"),
+		"The total number of bypassed ios hit the cache.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheBypassMissesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_bypass_misses_total"),
+		"The total number of bypassed ios missed the cache.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheMissCollisionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_miss_collisions_total"),
+		"The total number of cache misses raced with writes.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheReadaheadsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_readaheads_total"),
+		"The total number of readaheads.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheBypassedBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "bypassed_bytes_total"),
+		"The total number of bytes bypassed the cache.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheHitRatioDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_hit_ratio"),
+		"The percent of ios hit the cache since the bcache device is registered.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheDirtyDataDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "dirty_data_bytes"),
+		"The number of bytes in the cache not written back to the backend device.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheAvailablePercentDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_available_percent"),
+		"The percent of the cache set not containing dirty data.",
+		deviceStatLabels,
+		constLabels,
+	)
+	bcacheModeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, bcacheSubSystem, "cache_mode"),
+		"The active cache mode of the bcache device, the value is always 1.",
+		bcacheModeLabels,
+		constLabels,
+	)
+)
+
+type bcacheStatsCollector struct {
+	descs     []typedFactorDesc
+	lvService *k8s.LogicVolumeService
+}
+
+func newBcacheStatsCollector(lvService *k8s.LogicVolumeService) (Collector, error) {
+	return &bcacheStatsCollector{
+		descs: []typedFactorDesc{
+			{desc: bcacheHitsDesc, valueType: prometheus.CounterValue},
+			{desc: bcacheMissesDesc, valueType: prometheus.CounterValue},
+			{desc: bcacheBypassHitsDesc, valueType: prometheus.CounterValue},
+			{desc: bcacheBypassMissesDesc, valueType: prometheus.CounterValue},
+			{desc: bcacheMissCollisionsDesc, valueType: prometheus.CounterValue},
+			{desc: bcacheReadaheadsDesc, valueType: prometheus.CounterValue},
+			{desc: bcacheBypassedBytesDesc, valueType: prometheus.CounterValue},
+			{desc: bcacheHitRatioDesc, valueType: prometheus.GaugeValue},
+			{desc: bcacheDirtyDataDesc, valueType: prometheus.GaugeValue},
+			{desc: bcacheAvailablePercentDesc, valueType: prometheus.GaugeValue},
+		},
+		lvService: lvService,
+	}, nil
+}
+
+func (b *bcacheStatsCollector) Name() string {
+	return "bcache_stats"
+}
+
+func (b *bcacheStatsCollector) Update(ch chan<- prometheus.Metric) error {
+	logicVolumes, err := b.lvService.GetLogicVolumesByNodeName(context.Background(), nodeName, false)
+	if err != nil {
+		return err
+	}
+	for _, logicVolume := range logicVolumes {
+		// only the backend volume of bcache, the cache volume is named cache-xxx
+		if logicVolume.Annotations[carina.VolumeCacheDiskRatio] == "" || strings.HasPrefix(logicVolume.Name, "cache-") {
+			continue
+		}
+		// the bcache device exists only when the volume is staged
+		bcacheDir := filepath.Join(sysDevBlockPath, fmt.Sprintf("%d:%d", logicVolume.Status.DeviceMajor, logicVolume.Status.DeviceMinor), "bcache")
+		if _, err := os.Stat(bcacheDir); err != nil {
+			continue
+		}
+		labels := []string{logicVolume.Spec.NameSpace, logicVolume.Spec.Pvc, logicVolume.Name, logicVolume.Spec.DeviceGroup}
+		statsDir := filepath.Join(bcacheDir, "stats_total")
+		// need keep order with desc
+		for i, val := range []float64{
+			readBcacheValue(filepath.Join(statsDir, "cache_hits")),
+			readBcacheValue(filepath.Join(statsDir, "cache_misses")),
+			readBcacheValue(filepath.Join(statsDir, "cache_bypass_hits")),
+			readBcacheValue(filepath.Join(statsDir, "cache_bypass_misses")),
+			readBcacheValue(filepath.Join(statsDir, "cache_miss_collisions")),
+			readBcacheValue(filepath.Join(statsDir, "cache_readaheads")),
+			readBcacheValue(filepath.Join(statsDir, "bypassed")),
+			readBcacheValue(filepath.Join(statsDir, "cache_hit_ratio")),
+			readBcacheValue(filepath.Join(bcacheDir, "dirty_data")),
+			// the cache directory links to /sys/fs/bcache/<cset uuid> when the cache is attached
+			readBcacheValue(filepath.Join(bcacheDir, "cache", "cache_available_percent")),
+		} {
+			if i >= len(b.descs) {
+				break
+			}
+			ch <- b.descs[i].mustNewConstMetric(val, labels...)
+		}
+		if mode := readBcacheCacheMode(filepath.Join(bcacheDir, "cache_mode")); mode != "" {
+			ch <- prometheus.MustNewConstMetric(bcacheModeDesc, prometheus.GaugeValue, 1, append(labels, mode)...)
+		}
+	}
+	return nil
+}
+
+// readBcacheValue reads the number of the sysfs file, the sizes are printed in human-readable format like 1.5M
+func readBcacheValue(path string) float64 {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	return parseBcacheValue(strings.TrimSpace(string(content)))
+}
+
+// parseBcacheValue bcache prints the sizes with the binary suffixes k, M, G, T, P
+func parseBcacheValue(value string) float64 {
+	if value == "" {
+		return 0
+	}
+	multiplier := 1.0
+	if i := strings.IndexByte("kMGTPEZY", value[len(value)-1]); i >= 0 {
+		for j := 0; j <= i; j++ {
+			multiplier *= 1024
+		}
+		value = value[:len(value)-1]
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return v * multiplier
+}
+
+// readBcacheCacheMode the active mode is in brackets, writethrough [writeback] writearound none
+func readBcacheCacheMode(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return bcache.ParseCacheMode(string(content))
+}
@@ -84,8 +84,18 @@ func NewCarinaCollector(dm *deviceManager.DeviceManager, lvService *k8s.LogicVol
 	if err != nil {
 		return nil, err
 	}
+	bcacheStatsCollector, err := newBcacheStatsCollector(lvService)
+	if err != nil {
+		return nil, err
+	}
+	diskHealthCollector, err := newDiskHealthCollector(dm)
+	if err != nil {
+		return nil, err
+	}
 	collectors[vgStatsCollector.Name()] = vgStatsCollector
 	collectors[volumeStatsCollector.Name()] = volumeStatsCollector
+	collectors[bcacheStatsCollector.Name()] = bcacheStatsCollector
+	collectors[diskHealthCollector.Name()] = diskHealthCollector
 
 	return &CarinaCollector{collectors: collectors, dm: dm}, nil
 }
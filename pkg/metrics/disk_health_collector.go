@@ -0,0 +1,136 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"github.com/carina-io/carina/api"
+	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
+	deviceManager "github.com/carina-io/carina/pkg/devicemanager"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	diskHealthSubSystem string = "disk_health"
+)
+
+var (
+	diskHealthLabels     = []string{"disk"}
+	diskHealthPassedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, diskHealthSubSystem, "passed"),
+		"Whether the disk passes the SMART overall-health self-assessment.",
+		diskHealthLabels,
+		constLabels,
+	)
+	diskReallocatedSectorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, diskHealthSubSystem, "reallocated_sectors"),
+		"The number of reallocated sectors of the disk.",
+		diskHealthLabels,
+		constLabels,
+	)
+	diskMediaErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, diskHealthSubSystem, "media_errors"),
+		"The number of media errors of the nvme disk.",
+		diskHealthLabels,
+		constLabels,
+	)
+	diskPercentageUsedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, diskHealthSubSystem, "percentage_used"),
+		"The percentage of the nvme disk life used.",
+		diskHealthLabels,
+		constLabels,
+	)
+	diskTemperatureDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, diskHealthSubSystem, "temperature_celsius"),
+		"The current temperature of the disk.",
+		diskHealthLabels,
+		constLabels,
+	)
+)
+
+// diskHealthCollector exports the SMART health of the managed disks reported in nodeStorageResource
+type diskHealthCollector struct {
+	descs []typedFactorDesc
+	dm    *deviceManager.DeviceManager
+}
+
+func newDiskHealthCollector(dm *deviceManager.DeviceManager) (Collector, error) {
+	return &diskHealthCollector{
+		descs: []typedFactorDesc{
+			{desc: diskHealthPassedDesc, valueType: prometheus.GaugeValue},
+			{desc: diskReallocatedSectorsDesc, valueType: prometheus.GaugeValue},
+			{desc: diskMediaErrorsDesc, valueType: prometheus.GaugeValue},
+			{desc: diskPercentageUsedDesc, valueType: prometheus.GaugeValue},
+			{desc: diskTemperatureDesc, valueType: prometheus.GaugeValue},
+		},
+		dm: dm,
+	}, nil
+}
+
+func (d *diskHealthCollector) Name() string {
+	return "disk_health"
+}
+
+func (d *diskHealthCollector) Update(ch chan<- prometheus.Metric) error {
+	nsr := new(carinav1beta1.NodeStorageResource)
+	if err := d.dm.Cache.Get(context.Background(), client.ObjectKey{Name: d.dm.NodeName}, nsr); err != nil {
+		return errors.New("couldn't get nodeStorageResource:" + err.Error())
+	}
+	// 裸盘的健康状态在disks中，lvm磁盘的在各pv中，同一磁盘上的多个pv只导出一次
+	var healths []*api.DiskHealth
+	for _, disk := range nsr.Status.Disks {
+		healths = append(healths, disk.Health)
+	}
+	for _, vg := range nsr.Status.VgGroups {
+		for _, pv := range vg.PVS {
+			if pv != nil {
+				healths = append(healths, pv.Health)
+			}
+		}
+	}
+	exported := map[string]bool{}
+	for _, health := range healths {
+		if health == nil || health.Disk == "" || exported[health.Disk] {
+			continue
+		}
+		exported[health.Disk] = true
+		passed := 0.0
+		if health.Passed {
+			passed = 1
+		}
+		// need keep order with desc
+		for i, val := range []float64{
+			passed,
+			float64(health.ReallocatedSectors),
+			float64(health.MediaErrors),
+			float64(health.PercentageUsed),
+			float64(health.Temperature),
+		} {
+			if i >= len(d.descs) {
+				break
+			}
+			ch <- d.descs[i].mustNewConstMetric(val, health.Disk)
+		}
+	}
+	if len(exported) == 0 {
+		return ErrNoData
+	}
+	return nil
+}
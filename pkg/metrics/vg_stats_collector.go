@@ -3,6 +3,7 @@ package metrics
 import (
 	"errors"
 	deviceManager "github.com/carina-io/carina/pkg/devicemanager"
+	"github.com/carina-io/carina/pkg/devicemanager/volume"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -36,6 +37,12 @@ var (
 		vgStatLabels,
 		constLabels,
 	)
+	raidDegradedLvTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, vgSubSystem, "raid_degraded_lv_total"),
+		"The number of degraded raid lv total.",
+		vgStatLabels,
+		constLabels,
+	)
 )
 
 type vgStatsCollector struct {
@@ -50,6 +57,7 @@ func newVolumeGroupStatsCollector(dm *deviceManager.DeviceManager) (Collector, e
 			{desc: vgUsedBytesDesc, valueType: prometheus.GaugeValue},
 			{desc: lvTotalDesc, valueType: prometheus.GaugeValue},
 			{desc: pvTotalDesc, valueType: prometheus.GaugeValue},
+			{desc: raidDegradedLvTotalDesc, valueType: prometheus.GaugeValue},
 		},
 		dm: dm,
 	}, nil
@@ -65,6 +73,16 @@ func (v *vgStatsCollector) Update(ch chan<- prometheus.Metric) error {
 	if err != nil {
 		return errors.New("couldn't get volume group:" + err.Error())
 	}
+	lvList, err := v.dm.VolumeManager.VolumeList("", "")
+	if err != nil {
+		return errors.New("couldn't get logic volume:" + err.Error())
+	}
+	raidDegraded := map[string]int{}
+	for _, lv := range lvList {
+		if volume.RaidDegraded(lv) {
+			raidDegraded[lv.VGName]++
+		}
+	}
 	for _, vg := range vgList {
 		if _, ok := diskSelectGroup[vg.VGName]; !ok {
 			continue
@@ -75,6 +93,7 @@ func (v *vgStatsCollector) Update(ch chan<- prometheus.Metric) error {
 			float64(vg.VGSize - vg.VGFree),
 			float64(vg.LVCount),
 			float64(vg.PVCount),
+			float64(raidDegraded[vg.VGName]),
 		} {
 			if i >= len(v.descs) {
 				break
@@ -19,6 +19,7 @@ package metrics
 import (
 	"context"
 	"errors"
+	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs/blockdevice"
@@ -99,6 +100,18 @@ var (
 		deviceStatLabels,
 		constLabels,
 	)
+	raidSyncPercentDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, volumeSubSystem, "raid_sync_percent"),
+		"The percent of the raid images in sync.",
+		deviceStatLabels,
+		constLabels,
+	)
+	raidDegradedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, volumeSubSystem, "raid_degraded"),
+		"Whether the raid volume is degraded, 1 is degraded.",
+		deviceStatLabels,
+		constLabels,
+	)
 )
 
 type volumeStatsCollector struct {
@@ -146,6 +159,15 @@ func (v *volumeStatsCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 	// TODO shared raw devices need special processing
 	for _, logicVolume := range logicVolumes {
+		if raid := logicVolume.Status.Raid; raid != nil {
+			syncPercent, _ := strconv.ParseFloat(raid.SyncPercent, 64)
+			degraded := 0.0
+			if raid.Degraded {
+				degraded = 1
+			}
+			ch <- prometheus.MustNewConstMetric(raidSyncPercentDesc, prometheus.GaugeValue, syncPercent, logicVolume.Spec.NameSpace, logicVolume.Spec.Pvc, logicVolume.Name, logicVolume.Spec.DeviceGroup)
+			ch <- prometheus.MustNewConstMetric(raidDegradedDesc, prometheus.GaugeValue, degraded, logicVolume.Spec.NameSpace, logicVolume.Spec.Pvc, logicVolume.Name, logicVolume.Spec.DeviceGroup)
+		}
 		for _, stats := range diskStats {
 			if stats.MajorNumber != logicVolume.Status.DeviceMajor || stats.MinorNumber != logicVolume.Status.DeviceMinor {
 				continue
@@ -18,13 +18,13 @@ package runners
 
 import (
 	"context"
-	"regexp"
 	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/equality"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
+	"github.com/carina-io/carina"
 	"github.com/carina-io/carina/pkg/configuration"
 	deviceManager "github.com/carina-io/carina/pkg/devicemanager"
 	"github.com/carina-io/carina/pkg/devicemanager/types"
@@ -62,9 +62,11 @@ func (dc *deviceCheck) Start(ctx context.Context) error {
 	}
 
 	ticker := time.NewTicker(time.Duration(monitorInterval) * time.Second)
+	approvalTicker := time.NewTicker(diskPlanApprovalInterval)
 	func(t *time.Ticker) {
 		defer close(dc.configModifyChan)
 		defer ticker.Stop()
+		defer approvalTicker.Stop()
 		for {
 			select {
 			case <-t.C:
@@ -83,6 +85,16 @@ func (dc *deviceCheck) Start(ctx context.Context) error {
 				dc.addAndRemoveDevice()
 				// here for raw storage update, reuse the scan ticker
 				dc.dm.NoticeUpdateCapacity(deviceManager.Dummy, nil)
+			case <-approvalTicker.C:
+				// 批准计划后无需等待下次巡检
+				plan := dc.dm.GetDiskPlan()
+				if plan == nil || plan.Mode != configuration.DiskPlanApprove || len(plan.Remove) == 0 || plan.Approved {
+					continue
+				}
+				if dc.diskPlanApproved(plan) {
+					log.Infof("disk plan %s is approved", plan.ID)
+					dc.addAndRemoveDevice()
+				}
 			case <-dc.configModifyChan:
 				log.Info("config modify trigger disk scan...")
 				dc.addAndRemoveDevice()
@@ -97,7 +109,9 @@ func (dc *deviceCheck) Start(ctx context.Context) error {
 }
 
 // addAndRemoveDevice 定时巡检磁盘，是否有新磁盘加入
+// 增删的磁盘生成计划上报到nodeStorageResource，dryRun模式只生成计划，approve模式移出磁盘需等待批准
 func (dc *deviceCheck) addAndRemoveDevice() {
+	mode := configuration.DiskPlanMode()
 	diskClass := dc.dm.GetNodeDiskSelectGroup()
 	actuallyVg, err := dc.dm.VolumeManager.GetCurrentVgStruct()
 	if err != nil {
@@ -140,7 +154,10 @@ func (dc *deviceCheck) addAndRemoveDevice() {
 	}
 	log.Debug("ActuallyVgMap ", actuallyVgMap)
 
-	// 执行新增磁盘
+	// 执行新增磁盘，新增不会影响已有的卷，除dryRun模式外直接执行
+	addedVg := map[string]bool{}
+	addPlan := map[string][]string{}
+	cordonedDisks := dc.cordonedDisks()
 	for vg, pvs := range newDisk {
 		log.Infof("vg:%s, pvs:%s ", vg, pvs)
 		for _, pv := range pvs {
@@ -148,9 +165,20 @@ func (dc *deviceCheck) addAndRemoveDevice() {
 			if v, ok := actuallyVgMap[vg]; ok && utils.ContainsString(v, pv) {
 				continue
 			}
+			if cordonedDisks[pv] {
+				log.Infof("skip cordoned disk %s", pv)
+				continue
+			}
+			if mode == configuration.DiskPlanDryRun {
+				addPlan[vg] = append(addPlan[vg], pv)
+				continue
+			}
 			if err = dc.dm.VolumeManager.AddNewDiskToVg(pv, vg); err != nil {
 				log.Errorf("add new disk failed vg: %s, disk: %s, error: %v", vg, pv, err)
+				addPlan[vg] = append(addPlan[vg], pv)
+				continue
 			}
+			addedVg[vg] = true
 		}
 	}
 
@@ -164,34 +192,94 @@ func (dc *deviceCheck) addAndRemoveDevice() {
 		return
 	}
 
+	// 按硬件属性匹配时需要pv所在磁盘的信息
+	localDisks := map[string]*types.LocalDisk{}
+	removePlan := map[string][]string{}
 	for _, v := range actuallyVg {
 		if _, ok := diskClass[v.VGName]; !ok {
 			continue
 		}
 
-		diskSelector, err := regexp.Compile(strings.Join(diskClass[v.VGName].Re, "|"))
+		diskSelector, err := diskClass[v.VGName].Matcher()
 		if err != nil {
-			log.Warnf("disk regex %s error %v ", strings.Join(diskClass[v.VGName].Re, "|"), err)
+			log.Warnf("disk selector %s error %v ", v.VGName, err)
 			return
 		}
-		log.Debug("diskSelector  ", diskSelector)
+		if !diskSelector.NameOnly() && len(localDisks) == 0 {
+			disks, err := dc.dm.Partition.ListDevicesDetailWithoutFilter("")
+			if err != nil {
+				log.Errorf("get local disk failed %s", err.Error())
+				return
+			}
+			for _, d := range disks {
+				localDisks[d.Name] = d
+			}
+		}
+
+		// 新磁盘替换故障磁盘后，修复raid卷缺失的镜像，修复后缺失的pv才能从卷组中移除
+		missingPv := false
 		for _, pv := range v.PVS {
 			if strings.Contains(pv.PVName, "unknown") {
-				_ = dc.dm.VolumeManager.GetLv().RemoveUnknownDevice(pv.VGName)
+				missingPv = true
+			}
+		}
+		if mode != configuration.DiskPlanDryRun && (missingPv || addedVg[v.VGName]) {
+			if err := dc.dm.VolumeManager.RepairRaidVolumes(v.VGName); err != nil {
+				log.Errorf("repair raid volumes of vg %s error %v", v.VGName, err)
+			}
+		}
+
+		for _, pv := range v.PVS {
+			if strings.Contains(pv.PVName, "unknown") {
+				if mode != configuration.DiskPlanDryRun {
+					_ = dc.dm.VolumeManager.GetLv().RemoveUnknownDevice(pv.VGName)
+				}
 				continue
 			}
-			//同一个vg里，如果正则不匹配就将磁盘移出vg
-			if !diskSelector.MatchString(pv.PVName) {
-				log.Infof("try to remove pv %s from vg %s", pv.PVName, v.VGName)
-				if err := dc.dm.VolumeManager.RemoveDiskInVg(pv.PVName, v.VGName); err != nil {
-					log.Errorf("remove pv %s error %v", pv.PVName, err)
+			//同一个vg里，如果选择器不匹配就将磁盘移出vg
+			disk := &types.LocalDisk{Name: pv.PVName}
+			if !diskSelector.NameOnly() {
+				if disk = localDisks[pv.PVName]; disk == nil {
+					// 查不到磁盘属性时无法判断，不移出
+					log.Warnf("cannot find disk of pv %s, skip matching disk attributes", pv.PVName)
 					continue
 				}
-				log.Infof("succeeded in removing pv %s from vg %s", pv.PVName, v.VGName)
 			}
+			if matched, reason := diskSelector.Match(disk); !matched {
+				log.Infof("pv %s of vg %s mismatched %s", pv.PVName, v.VGName, reason)
+				removePlan[v.VGName] = append(removePlan[v.VGName], pv.PVName)
+			}
+
+		}
+	}
 
+	// 移出磁盘可能导致卷数据丢失，auto模式直接执行，approve模式需运维人员批准计划
+	plan := newDiskPlan(dc.dm.GetDiskPlan(), dc.dm.NodeName, mode, addPlan, removePlan, time.Now())
+	if len(removePlan) > 0 && mode != configuration.DiskPlanDryRun {
+		if mode == configuration.DiskPlanApprove && !dc.diskPlanApproved(plan) {
+			log.Infof("disk plan %s waits for approval, annotate nodestorageresource %s with %s=%s", plan.ID, dc.dm.NodeName, carina.DiskPlanApproved, plan.ID)
+		} else {
+			failedPlan := map[string][]string{}
+			for vg, pvs := range removePlan {
+				for _, pv := range pvs {
+					log.Infof("try to remove pv %s from vg %s", pv, vg)
+					if err := dc.dm.VolumeManager.RemoveDiskInVg(pv, vg); err != nil {
+						log.Errorf("remove pv %s error %v", pv, err)
+						failedPlan[vg] = append(failedPlan[vg], pv)
+						continue
+					}
+					log.Infof("succeeded in removing pv %s from vg %s", pv, vg)
+				}
+			}
+			// 移出失败的pv保留在计划中，下次巡检重试
+			plan = newDiskPlan(plan, dc.dm.NodeName, mode, addPlan, failedPlan, time.Now())
+			if plan != nil && len(failedPlan) > 0 {
+				plan.Approved = mode == configuration.DiskPlanApprove
+			}
 		}
 	}
+	planChanged := !equality.Semantic.DeepEqual(plan, dc.dm.GetDiskPlan())
+	dc.dm.SetDiskPlan(plan)
 
 	changeAfter, err := dc.dm.VolumeManager.GetCurrentVgStruct()
 	if err != nil {
@@ -199,7 +287,7 @@ func (dc *deviceCheck) addAndRemoveDevice() {
 		return
 	}
 	log.Debug("new vgs ", changeAfter)
-	if !equality.Semantic.DeepEqual(changeBefore, changeAfter) {
+	if planChanged || !equality.Semantic.DeepEqual(changeBefore, changeAfter) {
 		dc.dm.NoticeUpdateCapacity(deviceManager.LVMCheck, nil)
 	}
 }
@@ -227,9 +315,9 @@ func (dc *deviceCheck) discoverDisk(diskClass map[string]configuration.DiskSelec
 			// 目前不支持raw磁盘模式
 			continue
 		}
-		diskSelector, err := regexp.Compile(strings.Join(ds.Re, "|"))
+		diskSelector, err := ds.Matcher()
 		if err != nil {
-			log.Warnf("disk regex %s error %v ", strings.Join(ds.Re, "|"), err)
+			log.Warnf("disk selector %s error %v ", ds.Name, err)
 			continue
 		}
 		// 过滤出空块设备
@@ -256,8 +344,8 @@ func (dc *deviceCheck) discoverDisk(diskClass map[string]configuration.DiskSelec
 				continue
 			}
 
-			if !diskSelector.MatchString(d.Name) {
-				log.Infof("mismatched disk:%s, regex:%s", d.Name, diskSelector.String())
+			if matched, reason := diskSelector.Match(d); !matched {
+				log.Infof("mismatched disk:%s, %s", d.Name, reason)
 				continue
 			}
 
@@ -298,9 +386,9 @@ func (dc *deviceCheck) discoverPv(diskClass map[string]configuration.DiskSelecto
 		if strings.ToLower(ds.Policy) == "raw" {
 			continue
 		}
-		diskSelector, err := regexp.Compile(strings.Join(ds.Re, "|"))
+		diskSelector, err := ds.Matcher()
 		if err != nil {
-			log.Warnf("disk regex %s error %v ", strings.Join(ds.Re, "|"), err)
+			log.Warnf("disk selector %s error %v ", ds.Name, err)
 			return resp, err
 		}
 
@@ -315,10 +403,6 @@ func (dc *deviceCheck) discoverPv(diskClass map[string]configuration.DiskSelecto
 			if pv.VGName != "" {
 				continue
 			}
-			if !diskSelector.MatchString(pv.PVName) {
-				log.Infof("mismatched pv:%s, regex:%s", pv.PVName, diskSelector.String())
-				continue
-			}
 			disk, err := dc.dm.Partition.ListDevicesDetailWithoutFilter(pv.PVName)
 			if err != nil {
 				log.Errorf("get device failed %s", err.Error())
@@ -328,6 +412,10 @@ func (dc *deviceCheck) discoverPv(diskClass map[string]configuration.DiskSelecto
 				log.Error("get disk count not equal 1")
 				continue
 			}
+			if matched, reason := diskSelector.Match(disk[0]); !matched {
+				log.Infof("mismatched pv:%s, %s", pv.PVName, reason)
+				continue
+			}
 			name = ds.Name
 			log.Infof("eligible %s pv %s", ds.Name, disk[0].Name)
 			if !utils.ContainsString(resp[name], disk[0].Name) {
@@ -172,7 +172,7 @@ func volumeCreate(dm *deviceManager.DeviceManager) error {
 	}
 
 	for _, e := range table {
-		err := dm.VolumeManager.CreateVolume(e.lvName, e.vgName, e.size, 1)
+		err := dm.VolumeManager.CreateVolume(e.lvName, e.vgName, e.size, 1, 0, "")
 		if err != nil {
 			fmt.Println(fmt.Sprintf("craete volume failed %s", err.Error()))
 			return err
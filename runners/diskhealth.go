@@ -0,0 +1,127 @@
+/*
+  Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package runners
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/carina-io/carina"
+	"github.com/carina-io/carina/api"
+	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
+	"github.com/carina-io/carina/pkg/configuration"
+	"github.com/carina-io/carina/utils"
+	"github.com/carina-io/carina/utils/log"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// diskHealthInterval 定时刷新磁盘SMART健康状态的间隔，大于smart采集结果的缓存时间
+const diskHealthInterval = 5 * time.Minute
+
+// generateHealthStatus 裸盘的SMART健康状态上报到disks，lvm卷组的上报到各pv
+func (r *nodeStorageResourceReconciler) generateHealthStatus(status *carinav1beta1.NodeStorageResourceStatus) {
+	for i := range status.Disks {
+		status.Disks[i].Health = r.diskHealth(status.Disks[i].Name)
+	}
+	for _, vg := range status.VgGroups {
+		for _, pv := range vg.PVS {
+			if pv == nil {
+				continue
+			}
+			if disk := r.dm.PVDisk(pv.PVName); disk != "" {
+				pv.Health = r.diskHealth(disk)
+			}
+		}
+	}
+
+	if configuration.DiskHealthPolicy() != configuration.DiskHealthUnschedulable {
+		return
+	}
+	// 故障裸盘不再分配，已有的卷不受影响
+	for groupDetail := range status.Allocatable {
+		if !strings.HasPrefix(groupDetail, carina.DeviceCapacityKeyPrefix) {
+			continue
+		}
+		group := strings.TrimPrefix(groupDetail, carina.DeviceCapacityKeyPrefix)
+		i := strings.LastIndex(group, "/")
+		if i < 0 {
+			continue
+		}
+		if r.diskHealth(group[i+1:]).Failing() {
+			status.Allocatable[groupDetail] = *resource.NewQuantity(0, resource.BinarySI)
+		}
+	}
+}
+
+// cordonFailingDisks diskHealthPolicy为unschedulable时隔离SMART检查失败的磁盘上的pv，lvcreate不再在其上分配空间
+// 磁盘恢复或策略变更后解除隔离，spec中指定隔离的pv仍由DiskCordonReconciler处理，随后的状态上报会刷新allocatable
+func (r *nodeStorageResourceReconciler) cordonFailingDisks(ctx context.Context) {
+	diskSelectGroup := r.dm.GetNodeDiskSelectGroup()
+	pvs, err := r.dm.VolumeManager.GetCurrentPvStruct()
+	if err != nil {
+		log.Errorf("Get current pv struct error %s", err.Error())
+		return
+	}
+	cordoned, err := r.dm.VolumeManager.CordonedDisks()
+	if err != nil {
+		log.Errorf("Get cordoned pvs error %s", err.Error())
+		return
+	}
+	// 无法获取spec时不解除隔离
+	specCordons := map[string]bool{}
+	nsr := new(carinav1beta1.NodeStorageResource)
+	getErr := r.getter.Get(ctx, client.ObjectKey{Name: r.dm.NodeName}, nsr)
+	for _, cordon := range nsr.Spec.DiskCordons {
+		specCordons[cordon.Disk] = true
+	}
+
+	for _, pv := range pvs {
+		if _, ok := diskSelectGroup[pv.VGName]; !ok {
+			continue
+		}
+		tagged := utils.ContainsString(cordoned, pv.PVName)
+		switch {
+		case r.dm.PVUnschedulable(pv.PVName):
+			if tagged && !pv.Allocatable() {
+				continue
+			}
+			log.Warnf("Cordon pv %s of vg %s, its disk fails the SMART check", pv.PVName, pv.VGName)
+			if err := r.dm.VolumeManager.CordonDisk(pv.PVName); err != nil {
+				log.Errorf("cordon pv %s failed %s", pv.PVName, err.Error())
+			}
+		case tagged && getErr == nil && !specCordons[pv.PVName]:
+			log.Infof("Uncordon pv %s of vg %s, its disk is no longer unschedulable", pv.PVName, pv.VGName)
+			if err := r.dm.VolumeManager.UncordonDisk(pv.PVName); err != nil {
+				log.Errorf("uncordon pv %s failed %s", pv.PVName, err.Error())
+			}
+		}
+	}
+}
+
+func (r *nodeStorageResourceReconciler) diskHealth(disk string) *api.DiskHealth {
+	health, err := r.dm.Smart.DiskHealth(disk)
+	if err != nil {
+		log.Debugf("Get smart health of disk %s failed %s", disk, err.Error())
+		return nil
+	}
+	if health.Failing() {
+		log.Warnf("Disk %s is failing: %s", disk, health.Message)
+	}
+	return health
+}
@@ -0,0 +1,121 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package runners
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carina-io/carina"
+	carinav1beta1 "github.com/carina-io/carina/api/v1beta1"
+	"github.com/carina-io/carina/utils"
+	"github.com/carina-io/carina/utils/log"
+)
+
+// diskPlanApprovalInterval 计划等待批准期间检查nodeStorageResource注解的间隔
+const diskPlanApprovalInterval = 30 * time.Second
+
+// newDiskPlan 生成磁盘选择器变更计划，没有变更时返回nil
+// 没有新增待移出的pv时沿用之前计划的id，运维人员对计划的批准保持有效
+func newDiskPlan(prev *carinav1beta1.DiskPlan, nodeName, mode string, add, remove map[string][]string, now time.Time) *carinav1beta1.DiskPlan {
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+	plan := &carinav1beta1.DiskPlan{
+		Mode:   mode,
+		Add:    diskChanges(add),
+		Remove: diskChanges(remove),
+	}
+	if prev != nil && prev.Mode == mode && diskPlanContains(prev, remove) {
+		plan.ID = prev.ID
+		plan.CreationTime = prev.CreationTime
+		return plan
+	}
+	var removal []string
+	for _, change := range plan.Remove {
+		removal = append(removal, change.VGName+":"+strings.Join(change.Disks, ","))
+	}
+	plan.ID = fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d/%s", nodeName, mode, now.UnixNano(), strings.Join(removal, ";")))))[:10]
+	plan.CreationTime = metav1.NewTime(now)
+	return plan
+}
+
+// diskChanges 按卷组名称及磁盘名称排序，避免重复更新nodeStorageResource
+func diskChanges(disks map[string][]string) []carinav1beta1.DiskChange {
+	var changes []carinav1beta1.DiskChange
+	for vg, d := range disks {
+		sorted := append([]string{}, d...)
+		sort.Strings(sorted)
+		changes = append(changes, carinav1beta1.DiskChange{VGName: vg, Disks: sorted})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].VGName < changes[j].VGName
+	})
+	return changes
+}
+
+// diskPlanContains 待移出的pv是否都已包含在计划中
+func diskPlanContains(plan *carinav1beta1.DiskPlan, remove map[string][]string) bool {
+	for vg, pvs := range remove {
+		for _, pv := range pvs {
+			found := false
+			for _, change := range plan.Remove {
+				if change.VGName == vg && utils.ContainsString(change.Disks, pv) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// diskPlanApproved 运维人员通过nodeStorageResource的注解批准计划
+func (dc *deviceCheck) diskPlanApproved(plan *carinav1beta1.DiskPlan) bool {
+	nsr := dc.nodeStorageResource()
+	return nsr != nil && nsr.Annotations[carina.DiskPlanApproved] == plan.ID
+}
+
+// cordonedDisks 被隔离的磁盘不会被加入卷组，已迁移完成的磁盘需从spec中删除后才能再次使用
+func (dc *deviceCheck) cordonedDisks() map[string]bool {
+	disks := map[string]bool{}
+	if nsr := dc.nodeStorageResource(); nsr != nil {
+		for _, cordon := range nsr.Spec.DiskCordons {
+			disks[cordon.Disk] = true
+		}
+	}
+	return disks
+}
+
+func (dc *deviceCheck) nodeStorageResource() *carinav1beta1.NodeStorageResource {
+	nsr := new(carinav1beta1.NodeStorageResource)
+	if err := dc.dm.Client.Get(context.Background(), client.ObjectKey{Name: dc.dm.NodeName}, nsr); err != nil {
+		log.Warnf("get nodestorageresource %s failed %s", dc.dm.NodeName, err.Error())
+		return nil
+	}
+	return nsr
+}
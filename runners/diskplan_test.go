@@ -0,0 +1,56 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package runners
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carina-io/carina/pkg/configuration"
+)
+
+func TestNewDiskPlan(t *testing.T) {
+	now := time.Now()
+	if plan := newDiskPlan(nil, "node1", configuration.DiskPlanApprove, nil, nil, now); plan != nil {
+		t.Fatalf("expected no plan, got %+v", plan)
+	}
+
+	remove := map[string][]string{"carina-vg-hdd": {"/dev/sdc", "/dev/sdb"}}
+	plan := newDiskPlan(nil, "node1", configuration.DiskPlanApprove, map[string][]string{"carina-vg-ssd": {"/dev/sdd"}}, remove, now)
+	if plan == nil || plan.ID == "" || len(plan.Add) != 1 || len(plan.Remove) != 1 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if disks := plan.Remove[0].Disks; disks[0] != "/dev/sdb" || disks[1] != "/dev/sdc" {
+		t.Errorf("expected sorted disks, got %v", disks)
+	}
+
+	// 部分pv移出后沿用原计划，批准保持有效
+	next := newDiskPlan(plan, "node1", configuration.DiskPlanApprove, nil, map[string][]string{"carina-vg-hdd": {"/dev/sdc"}}, now.Add(time.Minute))
+	if next.ID != plan.ID || !next.CreationTime.Equal(&plan.CreationTime) {
+		t.Errorf("expected plan %s to be kept, got %s", plan.ID, next.ID)
+	}
+
+	// 新增待移出的pv需要重新批准
+	remove["carina-vg-hdd"] = append(remove["carina-vg-hdd"], "/dev/sde")
+	if next = newDiskPlan(plan, "node1", configuration.DiskPlanApprove, nil, remove, now.Add(time.Minute)); next.ID == plan.ID {
+		t.Errorf("expected new plan id for new removal")
+	}
+	// 切换模式后重新生成计划
+	if next = newDiskPlan(plan, "node1", configuration.DiskPlanDryRun, nil, map[string][]string{"carina-vg-hdd": {"/dev/sdb"}}, now); next.ID == plan.ID {
+		t.Errorf("expected new plan id for new mode")
+	}
+}
@@ -0,0 +1,113 @@
+/*
+  Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package runners
+
+import (
+	"time"
+
+	"github.com/prometheus/procfs/blockdevice"
+
+	"github.com/carina-io/carina/utils/log"
+)
+
+const (
+	// need mount proc when container deploy carina node
+	procPath = "/host/proc"
+	// minUtilizationWindow 两次采样间隔过短时沿用上次的利用率，避免卷事件频繁触发造成抖动
+	minUtilizationWindow = 10 * time.Second
+)
+
+// diskIOSampler 根据/proc/diskstats中io_ticks的增量计算磁盘在采样间隔内的繁忙时间占比
+type diskIOSampler struct {
+	fs          *blockdevice.FS
+	ioTicks     map[string]uint64
+	sampleAt    time.Time
+	utilization map[string]uint32
+}
+
+func newDiskIOSampler() *diskIOSampler {
+	fs, err := blockdevice.NewFS(procPath, "")
+	if err != nil {
+		log.Warnf("Disk utilization is disabled, failed to open %s: %s", procPath, err.Error())
+		return &diskIOSampler{}
+	}
+	return &diskIOSampler{fs: &fs}
+}
+
+// sample 返回按磁盘名称记录的利用率百分比，首次采样没有数据
+func (s *diskIOSampler) sample() map[string]uint32 {
+	if s.fs == nil {
+		return nil
+	}
+	now := time.Now()
+	if !s.sampleAt.IsZero() && now.Sub(s.sampleAt) < minUtilizationWindow {
+		return s.utilization
+	}
+	diskStats, err := s.fs.ProcDiskstats()
+	if err != nil {
+		log.Warnf("Couldn't get diskstats: %s", err.Error())
+		return s.utilization
+	}
+	ioTicks := map[string]uint64{}
+	for _, stats := range diskStats {
+		ioTicks[stats.DeviceName] = stats.IOsTotalTicks
+	}
+	if !s.sampleAt.IsZero() {
+		s.utilization = calcUtilization(s.ioTicks, ioTicks, now.Sub(s.sampleAt))
+	}
+	s.ioTicks = ioTicks
+	s.sampleAt = now
+	return s.utilization
+}
+
+// calcUtilization io_ticks单位为毫秒，计数器回绕或磁盘重新插入时跳过该磁盘
+func calcUtilization(prev, cur map[string]uint64, elapsed time.Duration) map[string]uint32 {
+	utilization := map[string]uint32{}
+	if elapsed <= 0 {
+		return utilization
+	}
+	for name, ticks := range cur {
+		prevTicks, ok := prev[name]
+		if !ok || ticks < prevTicks {
+			continue
+		}
+		percent := float64(ticks-prevTicks) / float64(elapsed.Milliseconds()) * 100
+		if percent > 100 {
+			percent = 100
+		}
+		utilization[name] = uint32(percent + 0.5)
+	}
+	return utilization
+}
+
+// groupUtilization 磁盘组的利用率为组内磁盘的平均值
+func groupUtilization(groupDisks map[string][]string, diskUtilization map[string]uint32) map[string]uint32 {
+	utilization := map[string]uint32{}
+	for group, disks := range groupDisks {
+		var total, count uint32
+		for _, disk := range disks {
+			if u, ok := diskUtilization[disk]; ok {
+				total += u
+				count++
+			}
+		}
+		if count > 0 {
+			utilization[group] = total / count
+		}
+	}
+	return utilization
+}
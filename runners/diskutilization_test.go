@@ -0,0 +1,38 @@
+/*
+  Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package runners
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcUtilization(t *testing.T) {
+	prev := map[string]uint64{"sdb": 1000, "sdc": 5000, "sdd": 100}
+	cur := map[string]uint64{"sdb": 4000, "sdc": 100, "sdd": 20100, "sde": 10}
+	utilization := calcUtilization(prev, cur, 10*time.Second)
+	assert.Equal(t, map[string]uint32{"sdb": 30, "sdd": 100}, utilization)
+
+	groups := map[string][]string{
+		"carina-vg-ssd":      {"sdb", "sdd"},
+		"carina-raw-hdd/sde": {"sde"},
+		"carina-raw-hdd/sdb": {"sdb"},
+	}
+	assert.Equal(t, map[string]uint32{"carina-vg-ssd": 65, "carina-raw-hdd/sdb": 30}, groupUtilization(groups, utilization))
+}
@@ -24,7 +24,7 @@ import (
 	"github.com/carina-io/carina/getter"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
-	"regexp"
+	"path/filepath"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sort"
 	"strings"
@@ -49,6 +49,7 @@ type nodeStorageResourceReconciler struct {
 	updateChannel chan *deviceManager.VolumeEvent
 	dm            *deviceManager.DeviceManager
 	getter        *getter.RetryGetter
+	ioSampler     *diskIOSampler
 }
 
 //+kubebuilder:rbac:groups=carina.storage.io,resources=nodestorageresources,verbs=get;list;watch;create;update;patch;delete
@@ -63,6 +64,7 @@ func NewNodeStorageResourceReconciler(
 		updateChannel: make(chan *deviceManager.VolumeEvent, 500), // Buffer up to 500 statuses
 		dm:            dm,
 		getter:        getter.NewRetryGetter(mgr),
+		ioSampler:     newDiskIOSampler(),
 	}
 }
 
@@ -111,13 +113,26 @@ func (r *nodeStorageResourceReconciler) Start(ctx context.Context) error {
 	// register volume update notice chan
 	r.dm.RegisterNoticeChan(r.updateChannel)
 
+	r.cordonFailingDisks(ctx)
 	go r.triggerReconcile()
 
+	// 定时刷新磁盘健康状态，磁盘故障时及时上报
+	healthTicker := time.NewTicker(diskHealthInterval)
+	defer healthTicker.Stop()
+
 	for {
 		select {
 		case event := <-r.updateChannel:
 			r.reconcile(event)
+		case <-healthTicker.C:
+			r.cordonFailingDisks(ctx)
+			r.reconcile(&deviceManager.VolumeEvent{Trigger: deviceManager.DiskHealthCheck, TriggerAt: time.Now()})
 		case <-ctx.Done():
+			// 保留隔离磁盘的配置，避免重启后隔离的pv恢复分配
+			if r.hasDiskCordons(context.TODO()) {
+				log.Info("Keep nodestorageresource with disk cordons...")
+				return nil
+			}
 			_ = r.deleteNodeStorageResource(context.TODO())
 			log.Info("Delete nodestorageresource...")
 			return nil
@@ -161,6 +176,14 @@ func (r *nodeStorageResourceReconciler) createNodeStorageResource(ctx context.Co
 	return r.Client.Create(ctx, NodeStorageResource)
 }
 
+func (r *nodeStorageResourceReconciler) hasDiskCordons(ctx context.Context) bool {
+	nsr := new(carinav1beta1.NodeStorageResource)
+	if err := r.getter.Get(ctx, client.ObjectKey{Name: r.dm.NodeName}, nsr); err != nil {
+		return false
+	}
+	return len(nsr.Spec.DiskCordons) > 0
+}
+
 func (r *nodeStorageResourceReconciler) deleteNodeStorageResource(ctx context.Context) error {
 	NodeStorageResource := &carinav1beta1.NodeStorageResource{
 		TypeMeta: metav1.TypeMeta{
@@ -183,7 +206,11 @@ func (r *nodeStorageResourceReconciler) generateStatus() carinav1beta1.NodeStora
 
 	r.generateLvmStatus(&status)
 	r.generateDiskStatus(&status)
+	r.generateHealthStatus(&status)
 	r.generateRaidStatus(&status)
+	r.generateUtilizationStatus(&status)
+	status.DiskPlan = r.dm.GetDiskPlan()
+	status.DiskCordons = r.dm.GetDiskCordons()
 
 	return status
 }
@@ -204,12 +231,38 @@ func (r *nodeStorageResourceReconciler) generateLvmStatus(status *carinav1beta1.
 
 	for _, v := range status.VgGroups {
 		sizeGb := v.VGSize>>30 + 1
+		// 隔离的pv不再分配空间，其剩余空间不计入allocatable
+		vgFree := v.VGFree
+		for _, pv := range v.PVS {
+			if !pv.Allocatable() && vgFree >= pv.PVFree {
+				vgFree -= pv.PVFree
+			}
+		}
 		freeGb := uint64(0)
-		if v.VGFree > carina.DefaultReservedSpace {
-			freeGb = (v.VGFree-carina.DefaultReservedSpace)>>30 + 1
+		if vgFree > carina.DefaultReservedSpace {
+			freeGb = (vgFree-carina.DefaultReservedSpace)>>30 + 1
 		}
 		status.Capacity[fmt.Sprintf("%s%s", carina.DeviceCapacityKeyPrefix, v.VGName)] = *resource.NewQuantity(int64(sizeGb), resource.BinarySI)
 		status.Allocatable[fmt.Sprintf("%s%s", carina.DeviceCapacityKeyPrefix, v.VGName)] = *resource.NewQuantity(int64(freeGb), resource.BinarySI)
+
+		// thin pool can grow with the free space of vg, the overcommit ratio applies to the whole pool
+		ratio := diskSelectGroup[v.VGName].ThinOvercommitRatio()
+		poolSize, virtualSize, err := r.dm.VolumeManager.ThinPoolUsage(v.VGName)
+		if err != nil {
+			log.Errorf("Get thin pool usage of %s error %s", v.VGName, err.Error())
+			continue
+		}
+		usableFree := uint64(0)
+		if vgFree > carina.DefaultReservedSpace {
+			usableFree = vgFree - carina.DefaultReservedSpace
+		}
+		thinFreeGb := uint64(0)
+		if thinTotal := uint64(float64(poolSize+usableFree) * ratio); thinTotal > virtualSize {
+			thinFreeGb = (thinTotal - virtualSize) >> 30
+		}
+		thinSizeGb := uint64(float64(v.VGSize)*ratio) >> 30
+		status.Capacity[fmt.Sprintf("%s%s", carina.ThinCapacityKeyPrefix, v.VGName)] = *resource.NewQuantity(int64(thinSizeGb), resource.BinarySI)
+		status.Allocatable[fmt.Sprintf("%s%s", carina.ThinCapacityKeyPrefix, v.VGName)] = *resource.NewQuantity(int64(thinFreeGb), resource.BinarySI)
 	}
 
 }
@@ -227,14 +280,14 @@ func (r *nodeStorageResourceReconciler) generateDiskStatus(status *carinav1beta1
 		if strings.ToLower(ds.Policy) == "lvm" {
 			continue
 		}
-		diskSelector, err := regexp.Compile(strings.Join(ds.Re, "|"))
+		diskSelector, err := ds.Matcher()
 		if err != nil {
-			log.Warnf("Disk regex %s error %v ", strings.Join(ds.Re, "|"), err)
+			log.Warnf("Disk selector %s error %v ", ds.Name, err)
 			continue
 		}
 		for _, d := range localDisk {
-			if !diskSelector.MatchString(d.Name) {
-				log.Infof("Mismatched disk:%s, regex:%s", d.Name, diskSelector.String())
+			if matched, reason := diskSelector.Match(d); !matched {
+				log.Infof("Mismatched disk:%s, %s", d.Name, reason)
 				continue
 			}
 
@@ -300,6 +353,32 @@ func (r *nodeStorageResourceReconciler) generateDiskStatus(status *carinav1beta1
 	}
 }
 
+// generateUtilizationStatus lvm磁盘组取卷组内pv所在磁盘，裸盘取各自的磁盘
+func (r *nodeStorageResourceReconciler) generateUtilizationStatus(status *carinav1beta1.NodeStorageResourceStatus) {
+	diskUtilization := r.ioSampler.sample()
+	if len(diskUtilization) == 0 {
+		return
+	}
+	groupDisks := map[string][]string{}
+	for _, vg := range status.VgGroups {
+		for _, pv := range vg.PVS {
+			if pv != nil {
+				groupDisks[vg.VGName] = append(groupDisks[vg.VGName], filepath.Base(pv.PVName))
+			}
+		}
+	}
+	for groupDetail := range status.Allocatable {
+		if !strings.HasPrefix(groupDetail, carina.DeviceCapacityKeyPrefix) {
+			continue
+		}
+		lvGroup := strings.TrimPrefix(groupDetail, carina.DeviceCapacityKeyPrefix)
+		if i := strings.LastIndex(lvGroup, "/"); i >= 0 {
+			groupDisks[lvGroup] = []string{lvGroup[i+1:]}
+		}
+	}
+	status.DeviceUtilization = groupUtilization(groupDisks, diskUtilization)
+}
+
 func (r *nodeStorageResourceReconciler) generateRaidStatus(status *carinav1beta1.NodeStorageResourceStatus) {
 	//TODO
 }
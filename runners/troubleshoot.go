@@ -26,6 +26,7 @@ import (
 	"github.com/carina-io/carina/utils"
 	"github.com/carina-io/carina/utils/log"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -61,12 +62,16 @@ func (t *troubleShoot) Start(ctx context.Context) error {
 	log.Info("Starting troubleshoot...")
 	ticker := time.NewTicker(600 * time.Second)
 	defer ticker.Stop()
+	conditionTicker := time.NewTicker(60 * time.Second)
+	defer conditionTicker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			log.Info("Volume consistency check...")
 			t.cleanupOrphanVolume()
 			t.cleanupOrphanPartition()
+		case <-conditionTicker.C:
+			t.checkVolumeCondition()
 		case <-ctx.Done():
 			log.Info("Stop volume consistency check...")
 			return nil
@@ -84,13 +89,7 @@ func (t *troubleShoot) cleanupOrphanVolume() {
 		log.Errorf("% get all local volume failed %s", logPrefix, err.Error())
 	}
 
-	// step.2 检查卷状态是否正常
-	log.Infof("%s check volume status", logPrefix)
-	for _, lv := range volumeList {
-		if lv.LVActive != "active" {
-			log.Warnf("%s logic volume %s current status %s", logPrefix, lv.LVName, lv.LVActive)
-		}
-	}
+	// step.2 卷状态由checkVolumeCondition检查并更新到logicVolume
 
 	// step.3 获取集群中logicVolume对象
 	log.Infof("%s get all logicVolume in cluster", logPrefix)
@@ -192,7 +191,16 @@ func (t *troubleShoot) cleanupOrphanPartition() {
 		log.Errorf("fail get all local parttions failed %s", err.Error())
 	}
 
-	//TODU step.2 检查磁盘逻辑坏道，物理坏道隔离
+	// step.2 检查磁盘SMART健康状态，故障磁盘按diskHealthPolicy在nodeStorageResource中停止分配
+	for _, disk := range disklist {
+		if disk.Type != "disk" {
+			continue
+		}
+		health, err := t.dm.Smart.DiskHealth(disk.Name)
+		if err == nil && health.Failing() {
+			log.Warnf("%s disk %s is failing: %s", logPrefix, disk.Name, health.Message)
+		}
+	}
 
 	// step.3 获取集群中logicVolume对象
 	log.Infof("%s get all logicVolume in cluster", logPrefix)
@@ -250,6 +258,43 @@ func (t *troubleShoot) cleanupOrphanPartition() {
 	log.Infof("%s volume check finished.", logPrefix)
 }
 
+// 检查本节点卷的健康状态并更新logicVolume, 供ControllerGetVolume上报
+func (t *troubleShoot) checkVolumeCondition() {
+	lvList := &carinav1.LogicVolumeList{}
+	err := t.dm.Cache.List(context.Background(), lvList, client.MatchingFields{"nodeName": t.dm.NodeName})
+	if err != nil {
+		log.Errorf("list logic volume error %s", err.Error())
+		return
+	}
+
+	for i := range lvList.Items {
+		lv := &lvList.Items[i]
+		if lv.DeletionTimestamp != nil || lv.Status.Status != "Success" {
+			continue
+		}
+		abnormal, message := t.dm.VolumeCondition(lv)
+		if abnormal {
+			log.Warnf("logic volume %s is abnormal: %s", lv.Name, message)
+		}
+		raid := t.dm.RaidStatus(lv)
+		if lv.Status.Condition != nil && lv.Status.Condition.Abnormal == abnormal && lv.Status.Condition.Message == message &&
+			equality.Semantic.DeepEqual(lv.Status.Raid, raid) {
+			continue
+		}
+
+		now := metav1.Now()
+		lv.Status.Condition = &carinav1.VolumeCondition{
+			Abnormal:      abnormal,
+			Message:       message,
+			LastCheckTime: &now,
+		}
+		lv.Status.Raid = raid
+		if err := t.dm.Client.Status().Update(context.Background(), lv); err != nil {
+			log.Errorf("update logic volume %s condition failed %s", lv.Name, err.Error())
+		}
+	}
+}
+
 func (t *troubleShoot) NeedLeaderElection() bool {
 	return false
 }
@@ -115,6 +115,31 @@ func SchedulerStrategy() string {
 	return schedulerStrategy
 }
 
+// ScoreWeights 节点评分中磁盘容量、磁盘组已有卷数量及磁盘IO利用率的权重
+type ScoreWeights struct {
+	Capacity      float64
+	LVCount       float64
+	IOUtilization float64
+}
+
+// GetScoreWeights 读取scoreWeights配置，未配置时只以磁盘容量评分
+func GetScoreWeights() ScoreWeights {
+	weights := ScoreWeights{Capacity: 1}
+	for key, weight := range map[string]*float64{
+		"scoreWeights.capacity":      &weights.Capacity,
+		"scoreWeights.lvCount":       &weights.LVCount,
+		"scoreWeights.ioUtilization": &weights.IOUtilization,
+	} {
+		if !GlobalConfig.IsSet(key) {
+			continue
+		}
+		if *weight = GlobalConfig.GetFloat64(key); *weight < 0 {
+			*weight = 0
+		}
+	}
+	return weights
+}
+
 // GetDeviceGroup 处理磁盘类型参数，支持carina.storage.io/disk-group-name:ssd书写方式
 func GetDeviceGroup(diskType string) string {
 	deviceGroup := strings.ToLower(diskType)
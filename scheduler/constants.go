@@ -25,15 +25,36 @@ const (
 	VolumeDeviceNode = "carina.storage.io/node"
 	// DeviceCapacityKeyPrefix device plugin
 	DeviceCapacityKeyPrefix = "carina.storage.io/"
+	// ThinCapacityKeyPrefix thin pool allocatable with overcommit ratio applied
+	ThinCapacityKeyPrefix = "thin.carina.storage.io/"
+	// VolumeLvmType value: thin|raid1|raid10
+	VolumeLvmType = "carina.storage.io/lvm-type"
+	LvmTypeThin   = "thin"
+	LvmTypeRaid1  = "raid1"
+	LvmTypeRaid10 = "raid10"
+	// VolumeLvmMirrors value: number of additional copies of raid volume, default 1
+	VolumeLvmMirrors = "carina.storage.io/lvm-mirrors"
+	// VolumeLvmStripes value: number of physical volumes to stripe the volume across
+	VolumeLvmStripes = "carina.storage.io/lvm-stripes"
 
 	// VolumeBackendDiskType bcahce scheduler
 	VolumeBackendDiskType = "carina.storage.io/backend-disk-group-name"
 	VolumeCacheDiskType   = "carina.storage.io/cache-disk-group-name"
 	// VolumeCacheDiskRatio value: 1-100 Cache Capacity Ratio
 	VolumeCacheDiskRatio = "carina.storage.io/cache-disk-ratio"
+	// VolumeSchedulerStrategy value: binpack|spreadout, overrides the schedulerStrategy of config.json for the storage class
+	VolumeSchedulerStrategy = "carina.storage.io/scheduler-strategy"
+	// VolumeDiskAntiAffinity value: preferred|required, spread the volumes sharing the anti-affinity key across different disks
+	VolumeDiskAntiAffinity = "carina.storage.io/disk-anti-affinity"
+	// VolumeDiskAntiAffinityKey the group key of the volumes to spread, it is scoped in the namespace of the pvc
+	VolumeDiskAntiAffinityKey = "carina.storage.io/disk-anti-affinity-key"
+	DiskAntiAffinityPreferred = "preferred"
+	DiskAntiAffinityRequired  = "required"
 	// DeviceVolumeType type
 	LvmVolumeType = "lvm"
 	RawVolumeType = "raw"
 	//ExclusivityDisk  true or false  is the key indicates that only the disk is used by one pod
 	ExclusivityDisk = "carina.storage.io/exclusively-raw-disk"
+	// SnapshotPrefix the prefix of carina snapshot id
+	SnapshotPrefix = "snapshot-"
 )
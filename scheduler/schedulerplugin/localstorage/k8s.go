@@ -7,14 +7,17 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/cache"
 	"path/filepath"
+	"strings"
 
 	v1 "github.com/carina-io/carina-api/api/v1"
 	"github.com/carina-io/carina-api/api/v1beta1"
 	"github.com/carina-io/carina/scheduler/utils"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
+	lcorev1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
@@ -47,6 +50,41 @@ func newDynamicClientFromConfig() dynamic.Interface {
 }
 
 func getNodeStorageResource(client dynamic.Interface, nsrLister cache.GenericLister, nodeName string) (*v1beta1.NodeStorageResource, error) {
+	workloadUnstructured, err := getNodeStorageResourceUnstructured(client, nsrLister, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	nsr := &v1beta1.NodeStorageResource{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(workloadUnstructured.UnstructuredContent(), nsr)
+	if err != nil {
+		return nil, err
+	}
+	return nsr, nil
+}
+
+// getDeviceUtilization 磁盘组的IO利用率百分比，carina-api中的NodeStorageResource尚未包含该字段，直接读取status.deviceUtilization
+func getDeviceUtilization(client dynamic.Interface, nsrLister cache.GenericLister, nodeName string) (map[string]int64, error) {
+	workloadUnstructured, err := getNodeStorageResourceUnstructured(client, nsrLister, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	content, _, err := unstructured.NestedMap(workloadUnstructured.UnstructuredContent(), "status", "deviceUtilization")
+	if err != nil {
+		return nil, err
+	}
+	utilization := map[string]int64{}
+	for group, value := range content {
+		switch v := value.(type) {
+		case int64:
+			utilization[group] = v
+		case float64:
+			utilization[group] = int64(v)
+		}
+	}
+	return utilization, nil
+}
+
+func getNodeStorageResourceUnstructured(client dynamic.Interface, nsrLister cache.GenericLister, nodeName string) (*unstructured.Unstructured, error) {
 	var gvr = schema.GroupVersionResource{
 		Group:    v1beta1.GroupVersion.Group,
 		Version:  v1beta1.GroupVersion.Version,
@@ -69,15 +107,44 @@ func getNodeStorageResource(client dynamic.Interface, nsrLister cache.GenericLis
 			return nil, err
 		}
 	}
-	nsr := &v1beta1.NodeStorageResource{}
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(workloadUnstructured.UnstructuredContent(), nsr)
+	return workloadUnstructured, nil
+}
+
+func getLvExclusivityDisks(client dynamic.Interface, lvLister cache.GenericLister, nodeName string) (lvDeviceGroups []string, err error) {
+	lvs, err := listLogicVolumes(client, lvLister, nodeName)
 	if err != nil {
 		return nil, err
 	}
-	return nsr, nil
+	for _, lv := range lvs {
+		if lv.Annotations == nil {
+			continue
+		}
+		klog.V(3).Infof("Get lv: %v, exclusivity: %s", lv.Spec.NodeName, lv.Annotations[carina.ExclusivityDisk])
+		if lv.Spec.NodeName == nodeName && lv.Annotations[carina.ExclusivityDisk] == "true" {
+			lvDeviceGroups = append(lvDeviceGroups, lv.Spec.DeviceGroup)
+		}
+	}
+	return lvDeviceGroups, nil
 }
 
-func getLvExclusivityDisks(client dynamic.Interface, lvLister cache.GenericLister, nodeName string) (lvDeviceGroups []string, err error) {
+// getAntiAffinityDisks 按反亲和key记录节点上已被同组卷使用的裸盘
+func getAntiAffinityDisks(client dynamic.Interface, lvLister cache.GenericLister, nodeName string) (map[string][]string, error) {
+	lvs, err := listLogicVolumes(client, lvLister, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	antiAffinityDisks := map[string][]string{}
+	for _, lv := range lvs {
+		key, ok := lv.Annotations[carina.VolumeDiskAntiAffinityKey]
+		if !ok || lv.Spec.NodeName != nodeName {
+			continue
+		}
+		antiAffinityDisks[key] = append(antiAffinityDisks[key], lv.Spec.DeviceGroup)
+	}
+	return antiAffinityDisks, nil
+}
+
+func listLogicVolumes(client dynamic.Interface, lvLister cache.GenericLister, nodeName string) ([]v1.LogicVolume, error) {
 	var gvr = schema.GroupVersionResource{
 		Group:    v1.GroupVersion.Group,
 		Version:  v1.GroupVersion.Version,
@@ -120,17 +187,64 @@ func getLvExclusivityDisks(client dynamic.Interface, lvLister cache.GenericListe
 		}
 	}
 	klog.V(3).Infof("Get logic volumes: %v", lvs)
-	if lvs == nil || len(lvs) == 0 {
-		return nil, nil
+	return lvs, nil
+}
+
+// getDataSourceNode returns the node of the pvc data source, the pv restored from snapshot or cloned from pvc
+// can only be created on the node of its data source
+func getDataSourceNode(client dynamic.Interface, pvcLister lcorev1.PersistentVolumeClaimLister, pvLister lcorev1.PersistentVolumeLister, pvc *corev1.PersistentVolumeClaim) (string, error) {
+	dataSource := pvc.Spec.DataSource
+	if dataSource == nil {
+		return "", nil
 	}
-	for _, lv := range lvs {
-		if lv.Annotations == nil {
-			continue
+
+	if dataSource.Kind == "PersistentVolumeClaim" && (dataSource.APIGroup == nil || *dataSource.APIGroup == "") {
+		sourcePvc, err := pvcLister.PersistentVolumeClaims(pvc.Namespace).Get(dataSource.Name)
+		if err != nil {
+			return "", err
 		}
-		klog.V(3).Infof("Get lv: %v, exclusivity: %s", lv.Spec.NodeName, lv.Annotations[carina.ExclusivityDisk])
-		if lv.Spec.NodeName == nodeName && lv.Annotations[carina.ExclusivityDisk] == "true" {
-			lvDeviceGroups = append(lvDeviceGroups, lv.Spec.DeviceGroup)
+		if sourcePvc.Spec.VolumeName == "" {
+			return "", nil
+		}
+		pv, err := pvLister.Get(sourcePvc.Spec.VolumeName)
+		if err != nil {
+			return "", err
 		}
+		if pv.Spec.CSI == nil {
+			return "", nil
+		}
+		return pv.Spec.CSI.VolumeAttributes[carina.VolumeDeviceNode], nil
 	}
-	return lvDeviceGroups, nil
+
+	if dataSource.Kind != "VolumeSnapshot" || dataSource.APIGroup == nil || *dataSource.APIGroup != "snapshot.storage.k8s.io" {
+		return "", nil
+	}
+
+	snapshotGvr := schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+	snapshot, err := client.Resource(snapshotGvr).Namespace(pvc.Namespace).Get(context.TODO(), dataSource.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	contentName, found, err := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+	if err != nil || !found {
+		return "", err
+	}
+
+	contentGvr := schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotcontents"}
+	content, err := client.Resource(contentGvr).Get(context.TODO(), contentName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	snapshotHandle, found, err := unstructured.NestedString(content.Object, "status", "snapshotHandle")
+	if err != nil || !found || !strings.HasPrefix(snapshotHandle, carina.SnapshotPrefix) {
+		return "", err
+	}
+
+	logicSnapshotGvr := schema.GroupVersionResource{Group: v1.GroupVersion.Group, Version: v1.GroupVersion.Version, Resource: "logicsnapshots"}
+	logicSnapshot, err := client.Resource(logicSnapshotGvr).Get(context.TODO(), strings.TrimPrefix(snapshotHandle, carina.SnapshotPrefix), metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	nodeName, _, err := unstructured.NestedString(logicSnapshot.Object, "spec", "nodeName")
+	return nodeName, err
 }
@@ -0,0 +1,198 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package localstorage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	carina "github.com/carina-io/carina/scheduler"
+	"github.com/carina-io/carina/scheduler/configuration"
+	"github.com/carina-io/carina/scheduler/utils"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// reservationTTL 未调用Unreserve/PreBind的预留最长保留时间，与卷绑定的超时时间一致
+	reservationTTL = 10 * time.Minute
+	// bindingGracePeriod PreBind后等待lv创建及NodeStorageResource更新容量的时间
+	bindingGracePeriod = 30 * time.Second
+)
+
+// reservation 已通过Reserve但卷尚未创建的pod对节点存储的占用
+type reservation struct {
+	nodeName string
+	// claims 按allocatable的key(磁盘组或裸盘分区组)记录占用的容量，单位Gi
+	claims   map[string]int64
+	expireAt time.Time
+}
+
+// storageLedger NodeStorageResource在卷创建后才会更新，同时调度的pod需要扣除彼此预留的容量
+type storageLedger struct {
+	mutex        sync.Mutex
+	reservations map[types.UID]*reservation
+	now          func() time.Time
+}
+
+func newStorageLedger() *storageLedger {
+	return &storageLedger{
+		reservations: map[types.UID]*reservation{},
+		now:          time.Now,
+	}
+}
+
+// reserve 记录pod在节点上的预留，重复调度的pod覆盖之前的预留
+func (l *storageLedger) reserve(uid types.UID, nodeName string, claims map[string]int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.reservations[uid] = &reservation{
+		nodeName: nodeName,
+		claims:   claims,
+		expireAt: l.now().Add(reservationTTL),
+	}
+}
+
+// release 删除pod的预留
+func (l *storageLedger) release(uid types.UID) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.reservations, uid)
+}
+
+// expire 缩短pod预留的保留时间
+func (l *storageLedger) expire(uid types.UID, after time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if r, ok := l.reservations[uid]; ok {
+		if expireAt := l.now().Add(after); expireAt.Before(r.expireAt) {
+			r.expireAt = expireAt
+		}
+	}
+}
+
+// subtract 从节点的allocatable中扣除其他pod的预留，过期的预留被清理，返回各key被扣除的容量
+func (l *storageLedger) subtract(nodeName string, allocatableMap map[string]int64, exclude types.UID) map[string]int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	reserved := map[string]int64{}
+	now := l.now()
+	for uid, r := range l.reservations {
+		if now.After(r.expireAt) {
+			delete(l.reservations, uid)
+			continue
+		}
+		if uid == exclude || r.nodeName != nodeName {
+			continue
+		}
+		for key, claim := range r.claims {
+			allocatable, ok := allocatableMap[key]
+			if !ok {
+				continue
+			}
+			reserved[key] += claim
+			allocatable -= claim
+			if allocatable < 0 {
+				allocatable = 0
+			}
+			allocatableMap[key] = allocatable
+		}
+	}
+	return reserved
+}
+
+// planClaims 计算pod的卷在节点上占用的容量，lvm卷占用磁盘组，裸盘卷选择满足请求的最小的裸盘，
+// antiAffinityDisks按反亲和key记录节点上已被同组卷使用的裸盘
+func planClaims(pvcRequestMap map[string][]*pvcRequest, allocatableMap map[string]int64, antiAffinityDisks map[string][]string) (map[string]int64, bool) {
+	claims := map[string]int64{}
+	usedDisks := map[string][]string{}
+	for key, disks := range antiAffinityDisks {
+		usedDisks[key] = append([]string{}, disks...)
+	}
+	for scDeviceGroup, pvcRequests := range pvcRequestMap {
+		if !configuration.CheckRawDeviceGroup(scDeviceGroup) {
+			var requestTotalBytes int64
+			for _, pvcR := range pvcRequests {
+				requestTotalBytes += pvcR.consumed()
+			}
+			requestTotalGb := (requestTotalBytes-1)>>30 + 1
+			if requestTotalGb > allocatableMap[scDeviceGroup]-claims[scDeviceGroup] {
+				return nil, false
+			}
+			claims[scDeviceGroup] += requestTotalGb
+			continue
+		}
+
+		var lvGroups []string
+		for lvGroup := range allocatableMap {
+			if strings.Contains(lvGroup, scDeviceGroup) {
+				lvGroups = append(lvGroups, lvGroup)
+			}
+		}
+		requests := append([]*pvcRequest{}, pvcRequests...)
+		sort.Slice(requests, func(i, j int) bool {
+			return requests[i].request > requests[j].request
+		})
+		for _, pvcR := range requests {
+			free := map[string]int64{}
+			for _, lvGroup := range lvGroups {
+				free[lvGroup] = allocatableMap[lvGroup] - claims[lvGroup]
+			}
+			selected := pickRawDisk(lvGroups, free, usedDisks, pvcR)
+			if selected == "" {
+				return nil, false
+			}
+			requestGb := (pvcR.request-1)>>30 + 1
+			// 独占的裸盘不能再被其他卷使用
+			if pvcR.exclusive {
+				requestGb = free[selected]
+			}
+			claims[selected] += requestGb
+			if pvcR.antiAffinity != "" {
+				usedDisks[pvcR.antiAffinityKey] = append(usedDisks[pvcR.antiAffinityKey], selected)
+			}
+		}
+	}
+	return claims, true
+}
+
+// pickRawDisk 选择剩余空间满足请求的最小的裸盘，反亲和的卷优先选择同组卷未使用的裸盘，
+// required时没有这样的裸盘则无法调度
+func pickRawDisk(lvGroups []string, free map[string]int64, usedDisks map[string][]string, pvcR *pvcRequest) string {
+	sort.Slice(lvGroups, func(i, j int) bool {
+		return free[lvGroups[i]] < free[lvGroups[j]]
+	})
+	requestGb := (pvcR.request-1)>>30 + 1
+	shared := ""
+	for _, lvGroup := range lvGroups {
+		if free[lvGroup] < requestGb {
+			continue
+		}
+		if pvcR.antiAffinity != "" && utils.ContainsString(usedDisks[pvcR.antiAffinityKey], lvGroup) {
+			if shared == "" {
+				shared = lvGroup
+			}
+			continue
+		}
+		return lvGroup
+	}
+	if pvcR.antiAffinity == carina.DiskAntiAffinityPreferred {
+		return shared
+	}
+	return ""
+}
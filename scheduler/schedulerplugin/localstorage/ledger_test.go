@@ -0,0 +1,114 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package localstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestStorageLedger(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	l := newStorageLedger()
+	l.now = func() time.Time { return now }
+
+	l.reserve("pod-a", "node1", map[string]int64{"carina-vg-ssd": 10})
+	l.reserve("pod-b", "node1", map[string]int64{"carina-vg-ssd": 30})
+	l.reserve("pod-c", "node2", map[string]int64{"carina-vg-ssd": 5})
+
+	allocatable := map[string]int64{"carina-vg-ssd": 100, "carina-vg-hdd": 100}
+	reserved := l.subtract("node1", allocatable, "pod-a")
+	a.Equal(map[string]int64{"carina-vg-ssd": 70, "carina-vg-hdd": 100}, allocatable)
+	a.Equal(map[string]int64{"carina-vg-ssd": 30}, reserved)
+
+	allocatable = map[string]int64{"carina-vg-ssd": 20}
+	l.subtract("node1", allocatable, "")
+	a.Equal(map[string]int64{"carina-vg-ssd": 0}, allocatable)
+
+	l.release("pod-b")
+	allocatable = map[string]int64{"carina-vg-ssd": 100}
+	l.subtract("node1", allocatable, "")
+	a.Equal(map[string]int64{"carina-vg-ssd": 90}, allocatable)
+
+	l.expire("pod-a", bindingGracePeriod)
+	now = now.Add(bindingGracePeriod + time.Second)
+	allocatable = map[string]int64{"carina-vg-ssd": 100}
+	l.subtract("node1", allocatable, "")
+	a.Equal(map[string]int64{"carina-vg-ssd": 100}, allocatable)
+	a.NotContains(l.reservations, types.UID("pod-a"))
+	a.Contains(l.reservations, types.UID("pod-c"))
+}
+
+func TestPlanClaims(t *testing.T) {
+	table := []struct {
+		requests    map[string][]*pvcRequest
+		allocatable map[string]int64
+		claims      map[string]int64
+		ok          bool
+	}{
+		{
+			requests:    map[string][]*pvcRequest{"carina-vg-ssd": {{request: 10 << 30}, {request: 5 << 30, copies: 2}}},
+			allocatable: map[string]int64{"carina-vg-ssd": 100},
+			claims:      map[string]int64{"carina-vg-ssd": 20},
+			ok:          true,
+		},
+		{
+			requests:    map[string][]*pvcRequest{"carina-vg-ssd": {{request: 101 << 30}}},
+			allocatable: map[string]int64{"carina-vg-ssd": 100},
+			ok:          false,
+		},
+		{
+			requests:    map[string][]*pvcRequest{"carina-vg-ssd": {{request: 10 << 30}}, "carina-vg-hdd": {{request: 20 << 30}}},
+			allocatable: map[string]int64{"carina-vg-ssd": 100, "carina-vg-hdd": 10},
+			ok:          false,
+		},
+	}
+
+	a := assert.New(t)
+	for _, e := range table {
+		claims, ok := planClaims(e.requests, e.allocatable, nil)
+		a.Equal(e.ok, ok)
+		if e.ok {
+			a.Equal(e.claims, claims)
+		}
+	}
+}
+
+func TestPickRawDisk(t *testing.T) {
+	lvGroups := []string{"carina-raw-ssd/sdb", "carina-raw-ssd/sdc", "carina-raw-ssd/sdd"}
+	free := map[string]int64{"carina-raw-ssd/sdb": 10, "carina-raw-ssd/sdc": 20, "carina-raw-ssd/sdd": 5}
+	usedDisks := map[string][]string{"default/mysql": {"carina-raw-ssd/sdb", "carina-raw-ssd/sdc"}}
+	table := []struct {
+		pvcR     *pvcRequest
+		selected string
+	}{
+		{pvcR: &pvcRequest{request: 8 << 30}, selected: "carina-raw-ssd/sdb"},
+		{pvcR: &pvcRequest{request: 8 << 30, antiAffinity: "required", antiAffinityKey: "default/redis"}, selected: "carina-raw-ssd/sdb"},
+		{pvcR: &pvcRequest{request: 8 << 30, antiAffinity: "required", antiAffinityKey: "default/mysql"}, selected: ""},
+		{pvcR: &pvcRequest{request: 8 << 30, antiAffinity: "preferred", antiAffinityKey: "default/mysql"}, selected: "carina-raw-ssd/sdb"},
+		{pvcR: &pvcRequest{request: 4 << 30, antiAffinity: "required", antiAffinityKey: "default/mysql"}, selected: "carina-raw-ssd/sdd"},
+	}
+
+	a := assert.New(t)
+	for _, e := range table {
+		a.Equal(e.selected, pickRawDisk(lvGroups, free, usedDisks, e.pvcR))
+	}
+}
@@ -0,0 +1,144 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package localstorage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// Filter未通过的原因
+const (
+	reasonNodeMismatch  = "pv node mismatch"
+	reasonNoStorage     = "node storage resource unavailable"
+	reasonInsufficient  = "node storage resource insufficient"
+	reasonPVs           = "node storage pvs insufficient for stripes or mirrors"
+	reasonAntiAffinity  = "node storage disks insufficient for anti-affinity"
+	filterFailuresKey   = framework.StateKey(Name + "/filter-failures")
+	postFilterMsgPrefix = "carina local-storage"
+)
+
+// filterFailure 节点未通过Filter的原因，容量单位为Gi，allocatable已扣除其他pod的预留
+type filterFailure struct {
+	reason      string
+	deviceGroup string
+	requested   int64
+	allocatable int64
+	reserved    int64
+	// detail 无法获取节点存储资源时的错误信息
+	detail string
+}
+
+func (f filterFailure) String() string {
+	if f.detail != "" {
+		return f.reason + ": " + f.detail
+	}
+	if f.deviceGroup == "" {
+		return f.reason
+	}
+	return fmt.Sprintf("%s: device group %s requested %dGi, allocatable %dGi, reserved %dGi", f.reason, f.deviceGroup, f.requested, f.allocatable, f.reserved)
+}
+
+// status 返回的原因包含磁盘组及容量，调度失败事件中按原因统计节点数量
+func (f filterFailure) status() *framework.Status {
+	return framework.NewStatus(framework.UnschedulableAndUnresolvable, f.String())
+}
+
+// filterFailures 一个调度周期中各节点未通过Filter的原因，Filter在各节点上并发执行
+type filterFailures struct {
+	mutex sync.Mutex
+	nodes map[string]filterFailure
+}
+
+// Clone 抢占模拟调度时使用复制的CycleState，不影响原调度周期的记录
+func (f *filterFailures) Clone() framework.StateData {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	nodes := make(map[string]filterFailure, len(f.nodes))
+	for nodeName, failure := range f.nodes {
+		nodes[nodeName] = failure
+	}
+	return &filterFailures{nodes: nodes}
+}
+
+func (f *filterFailures) record(nodeName string, failure filterFailure) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.nodes[nodeName] = failure
+}
+
+// summary 按原因及磁盘组汇总节点数量，请求取最大值，allocatable给出范围，预留取最大值，错误信息取节点名最小的节点
+func (f *filterFailures) summary() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	type group struct {
+		filterFailure
+		nodes          int
+		minAllocatable int64
+		detailNode     string
+	}
+	groups := map[string]*group{}
+	for nodeName, failure := range f.nodes {
+		key := failure.reason + "/" + failure.deviceGroup
+		g, ok := groups[key]
+		if !ok {
+			g = &group{filterFailure: failure, minAllocatable: failure.allocatable, detailNode: nodeName}
+			groups[key] = g
+		}
+		g.nodes++
+		if failure.detail != "" && (g.detail == "" || nodeName < g.detailNode) {
+			g.detail = failure.detail
+			g.detailNode = nodeName
+		}
+		if failure.requested > g.requested {
+			g.requested = failure.requested
+		}
+		if failure.allocatable > g.allocatable {
+			g.allocatable = failure.allocatable
+		}
+		if failure.allocatable < g.minAllocatable {
+			g.minAllocatable = failure.allocatable
+		}
+		if failure.reserved > g.reserved {
+			g.reserved = failure.reserved
+		}
+	}
+
+	var messages []string
+	for _, g := range groups {
+		if g.detail != "" {
+			messages = append(messages, fmt.Sprintf("%d node(s) %s, e.g. %s: %s", g.nodes, g.reason, g.detailNode, g.detail))
+			continue
+		}
+		if g.deviceGroup == "" {
+			messages = append(messages, fmt.Sprintf("%d node(s) %s", g.nodes, g.reason))
+			continue
+		}
+		allocatable := fmt.Sprintf("%dGi", g.allocatable)
+		if g.minAllocatable != g.allocatable {
+			allocatable = fmt.Sprintf("%d-%dGi", g.minAllocatable, g.allocatable)
+		}
+		messages = append(messages, fmt.Sprintf("%d node(s) %s: device group %s requested %dGi, allocatable %s, reserved up to %dGi",
+			g.nodes, g.reason, g.deviceGroup, g.requested, allocatable, g.reserved))
+	}
+	sort.Strings(messages)
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,55 @@
+/*
+   Copyright @ 2021 bocloud <fushaosong@beyondcent.com>.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package localstorage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func TestFilterFailures(t *testing.T) {
+	a := assert.New(t)
+
+	failure := filterFailure{reason: reasonInsufficient, deviceGroup: "carina-vg-ssd", requested: 50, allocatable: 20, reserved: 10}
+	a.Equal("node storage resource insufficient: device group carina-vg-ssd requested 50Gi, allocatable 20Gi, reserved 10Gi", failure.String())
+	a.Equal(framework.UnschedulableAndUnresolvable, failure.status().Code())
+
+	failures := &filterFailures{nodes: map[string]filterFailure{}}
+	failures.record("node1", failure)
+	failures.record("node2", filterFailure{reason: reasonInsufficient, deviceGroup: "carina-vg-ssd", requested: 50, allocatable: 40})
+	failures.record("node3", filterFailure{reason: reasonNodeMismatch})
+	a.Equal("1 node(s) pv node mismatch; "+
+		"2 node(s) node storage resource insufficient: device group carina-vg-ssd requested 50Gi, allocatable 20-40Gi, reserved up to 10Gi",
+		failures.summary())
+
+	noStorage := filterFailure{reason: reasonNoStorage, detail: "Failed to obtain node storages, not found"}
+	a.Equal("node storage resource unavailable: Failed to obtain node storages, not found", noStorage.String())
+	failures.record("node6", filterFailure{reason: reasonNoStorage, detail: "Failed to obtain node storages, timeout"})
+	failures.record("node5", noStorage)
+	a.Equal("1 node(s) pv node mismatch; "+
+		"2 node(s) node storage resource insufficient: device group carina-vg-ssd requested 50Gi, allocatable 20-40Gi, reserved up to 10Gi; "+
+		"2 node(s) node storage resource unavailable, e.g. node5: Failed to obtain node storages, not found",
+		failures.summary())
+	delete(failures.nodes, "node5")
+	delete(failures.nodes, "node6")
+
+	cloned := failures.Clone().(*filterFailures)
+	cloned.record("node4", filterFailure{reason: reasonNoStorage})
+	a.Len(failures.nodes, 3)
+}
@@ -27,6 +27,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"k8s.io/client-go/dynamic"
 
@@ -52,15 +53,60 @@ type LocalStorage struct {
 	lvLister      cache.GenericLister
 	nsrLister     cache.GenericLister
 	dynamicClient dynamic.Interface
+	ledger        *storageLedger
+	// stateMutex 并发的Filter在CycleState中创建同一份未通过原因及数据源节点的记录
+	stateMutex sync.Mutex
 }
 
 type pvcRequest struct {
 	exclusive bool
 	request   int64
+	stripes   int64
+	// copies raid卷每个镜像都占用卷组空间
+	copies int64
+	// strategy 存储类设置的调度策略，未设置时使用配置文件中的策略
+	strategy string
+	// antiAffinity 裸盘卷的磁盘反亲和策略preferred或required，antiAffinityKey为带命名空间前缀的分组key
+	antiAffinity    string
+	antiAffinityKey string
 }
 
+// images 卷需要落在不同pv上的条带及镜像数量
+func (p *pvcRequest) images() int64 {
+	stripes := p.stripes
+	if stripes < 1 {
+		stripes = 1
+	}
+	if p.copies > 1 {
+		return stripes * p.copies
+	}
+	return stripes
+}
+
+// consumed 卷在卷组中实际占用的空间
+func (p *pvcRequest) consumed() int64 {
+	if p.copies > 1 {
+		return p.request * p.copies
+	}
+	return p.request
+}
+
+// dataSourceNodesKey 调度周期中pvc数据源所在的节点
+const dataSourceNodesKey = framework.StateKey(Name + "/data-source-nodes")
+
+// dataSourceNodes 从快照恢复或从pvc克隆的pvc名称及其数据源所在节点，写入CycleState后不再修改
+type dataSourceNodes map[string]string
+
+func (d dataSourceNodes) Clone() framework.StateData {
+	return d
+}
+
+var _ framework.PreFilterPlugin = &LocalStorage{}
 var _ framework.FilterPlugin = &LocalStorage{}
+var _ framework.PostFilterPlugin = &LocalStorage{}
 var _ framework.ScorePlugin = &LocalStorage{}
+var _ framework.ReservePlugin = &LocalStorage{}
+var _ framework.PreBindPlugin = &LocalStorage{}
 
 // New type PluginFactory = func(configuration *runtime.Unknown, f FrameworkHandle) (Plugin, error)
 func New(_ runtime.Object, handle framework.Handle) (framework.Plugin, error) {
@@ -82,6 +128,7 @@ func New(_ runtime.Object, handle framework.Handle) (framework.Plugin, error) {
 		lvLister:      lvLister,
 		nsrLister:     nsrLister,
 		dynamicClient: dynamicClient,
+		ledger:        newStorageLedger(),
 	}, nil
 }
 
@@ -89,10 +136,24 @@ func (ls *LocalStorage) Name() string {
 	return Name
 }
 
+// PreFilter 每个调度周期只查询一次pvc数据源所在节点，避免在每个节点的Filter、Score及Reserve中重复请求api server
+func (ls *LocalStorage) PreFilter(ctx context.Context, cycleState *framework.CycleState, pod *v1.Pod) (*framework.PreFilterResult, *framework.Status) {
+	if _, err := ls.getDataSourceNodes(cycleState, pod); err != nil {
+		klog.V(3).ErrorS(err, "failed to get data source nodes", "pod", pod.Name)
+		return nil, framework.NewStatus(framework.Error, err.Error())
+	}
+	return nil, framework.NewStatus(framework.Success, "")
+}
+
+func (ls *LocalStorage) PreFilterExtensions() framework.PreFilterExtensions {
+	return nil
+}
+
 // Filter 过滤掉不符合当前 Pod 运行条件的Node（相当于旧版本的 predicate）
+// 未通过的原因包含磁盘组、请求及可分配容量，并记录在CycleState中由PostFilter汇总
 func (ls *LocalStorage) Filter(ctx context.Context, cycleState *framework.CycleState, pod *v1.Pod, node *framework.NodeInfo) *framework.Status {
 	klog.V(3).Infof("filter pod: %s, node: %s", pod.Name, node.Node().Name)
-	pvcRequestMap, nodeName, useRaw, err := ls.getPvcRequestMap(pod)
+	pvcRequestMap, nodeName, useRaw, err := ls.getPvcRequestMap(cycleState, pod)
 	if err != nil {
 		klog.V(3).ErrorS(err, "failed to get pvc/sc, pod: %s, node: %vs", pod.Name, node.Node().Name)
 		return framework.NewStatus(framework.Error, err.Error())
@@ -100,16 +161,20 @@ func (ls *LocalStorage) Filter(ctx context.Context, cycleState *framework.CycleS
 
 	if nodeName != "" && nodeName != node.Node().Name {
 		klog.V(3).Infof("mismatch pod: %s, node: %s", pod.Name, node.Node().Name)
-		return framework.NewStatus(framework.UnschedulableAndUnresolvable, "pv node mismatch")
+		return ls.reject(cycleState, node.Node().Name, filterFailure{reason: reasonNodeMismatch})
 	}
 
 	if len(pvcRequestMap) == 0 {
 		return framework.NewStatus(framework.Success, "")
 	}
 
-	allocatableMap, err := ls.getAllocatableMap(useRaw, pod.Name, node.Node().Name)
+	allocatableMap, reserved, err := ls.getAllocatableMap(useRaw, pod, node.Node().Name)
+	if err != nil {
+		return ls.reject(cycleState, node.Node().Name, filterFailure{reason: reasonNoStorage, detail: err.Error()})
+	}
+	antiAffinityDisks, err := ls.getAntiAffinityDisks(pvcRequestMap, node.Node().Name)
 	if err != nil {
-		return framework.NewStatus(framework.UnschedulableAndUnresolvable, err.Error())
+		return framework.NewStatus(framework.Error, "failed to obtain node lvs, "+err.Error())
 	}
 
 	// 检查节点容量是否充足
@@ -119,28 +184,71 @@ func (ls *LocalStorage) Filter(ctx context.Context, cycleState *framework.CycleS
 		})
 		if configuration.CheckRawDeviceGroup(scDeviceGroup) {
 			var allocatableList []int64
+			var allocatableTotal, reservedTotal int64
 			for lvGroup, allocatable := range allocatableMap {
 				if !strings.Contains(lvGroup, scDeviceGroup) {
 					continue
 				}
 				allocatableList = append(allocatableList, allocatable)
+				allocatableTotal += allocatable
+				reservedTotal += reserved[lvGroup]
 			}
 			for _, pvcR := range pvcRequests {
 				index := minimumValueMinus(allocatableList, pvcR)
 				if index < 0 {
 					klog.V(3).Infof("mismatch pod: %s, node: %s, scDeviceGroup: %s", pod.Name, node.Node().Name, scDeviceGroup)
-					return framework.NewStatus(framework.UnschedulableAndUnresolvable, "node storage resource insufficient")
+					// 裸盘卷需要落在一块磁盘上，可分配容量为剩余空间最大的磁盘
+					var largest int64
+					if len(allocatableList) > 0 {
+						largest = allocatableList[len(allocatableList)-1]
+					}
+					return ls.reject(cycleState, node.Node().Name, filterFailure{
+						reason:      reasonInsufficient,
+						deviceGroup: scDeviceGroup,
+						requested:   (pvcR.request-1)>>30 + 1,
+						allocatable: largest,
+						reserved:    reservedTotal,
+					})
+				}
+			}
+			// required反亲和的卷需要落在不同的裸盘上
+			if antiAffinityDisks != nil {
+				if _, ok := planClaims(map[string][]*pvcRequest{scDeviceGroup: pvcRequests}, allocatableMap, antiAffinityDisks); !ok {
+					klog.V(3).Infof("mismatch pod: %s, node: %s, scDeviceGroup: %s, not enough disks for anti-affinity", pod.Name, node.Node().Name, scDeviceGroup)
+					var requestTotalGb int64
+					for _, pvcR := range pvcRequests {
+						requestTotalGb += (pvcR.request-1)>>30 + 1
+					}
+					return ls.reject(cycleState, node.Node().Name, filterFailure{
+						reason:      reasonAntiAffinity,
+						deviceGroup: scDeviceGroup,
+						requested:   requestTotalGb,
+						allocatable: allocatableTotal,
+						reserved:    reservedTotal,
+					})
 				}
 			}
 		} else {
 			var requestTotalBytes int64
 			for _, pvcR := range pvcRequests {
-				requestTotalBytes += pvcR.request
+				requestTotalBytes += pvcR.consumed()
 			}
 			requestTotalGb := (requestTotalBytes-1)>>30 + 1
+			failure := filterFailure{
+				deviceGroup: scDeviceGroup,
+				requested:   requestTotalGb,
+				allocatable: allocatableMap[scDeviceGroup],
+				reserved:    reserved[scDeviceGroup],
+			}
 			if requestTotalGb > allocatableMap[scDeviceGroup] {
 				klog.V(3).Infof("mismatch pod: %s, node: %s, request: %d, scDeviceGroup:%s, allocatable: %d", pod.Name, node.Node().Name, requestTotalGb, scDeviceGroup, allocatableMap[scDeviceGroup])
-				return framework.NewStatus(framework.UnschedulableAndUnresolvable, "node storage resource insufficient")
+				failure.reason = reasonInsufficient
+				return ls.reject(cycleState, node.Node().Name, failure)
+			}
+			if !ls.stripeFits(node.Node().Name, scDeviceGroup, pvcRequests) {
+				klog.V(3).Infof("mismatch pod: %s, node: %s, scDeviceGroup: %s, not enough pvs for stripes or mirrors", pod.Name, node.Node().Name, scDeviceGroup)
+				failure.reason = reasonPVs
+				return ls.reject(cycleState, node.Node().Name, failure)
 			}
 		}
 	}
@@ -149,10 +257,40 @@ func (ls *LocalStorage) Filter(ctx context.Context, cycleState *framework.CycleS
 	return framework.NewStatus(framework.Success, "")
 }
 
+// reject 记录节点未通过Filter的原因
+func (ls *LocalStorage) reject(state *framework.CycleState, nodeName string, failure filterFailure) *framework.Status {
+	ls.stateMutex.Lock()
+	data, err := state.Read(filterFailuresKey)
+	if err != nil {
+		data = &filterFailures{nodes: map[string]filterFailure{}}
+		state.Write(filterFailuresKey, data)
+	}
+	ls.stateMutex.Unlock()
+	if failures, ok := data.(*filterFailures); ok {
+		failures.record(nodeName, failure)
+	}
+	return failure.status()
+}
+
+// PostFilter 所有节点都未通过Filter时，汇总存储相关的原因写入pod的FailedScheduling事件，本插件不做抢占
+func (ls *LocalStorage) PostFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod, filteredNodeStatusMap framework.NodeToStatusMap) (*framework.PostFilterResult, *framework.Status) {
+	data, err := state.Read(filterFailuresKey)
+	if err != nil {
+		return nil, framework.NewStatus(framework.Unschedulable)
+	}
+	failures, ok := data.(*filterFailures)
+	if !ok {
+		return nil, framework.NewStatus(framework.Unschedulable)
+	}
+	msg := postFilterMsgPrefix + ": " + failures.summary()
+	klog.V(3).Infof("post filter pod: %s, %s", pod.Name, msg)
+	return nil, framework.NewStatus(framework.Unschedulable, msg)
+}
+
 // Score 对节点进行打分（相当于旧版本的 priorities）
 func (ls *LocalStorage) Score(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) (int64, *framework.Status) {
 	klog.V(3).Infof("score pod: %s, node: %s", pod.Name, nodeName)
-	pvcRequestMap, node, useRaw, err := ls.getPvcRequestMap(pod)
+	pvcRequestMap, node, useRaw, err := ls.getPvcRequestMap(state, pod)
 	if err != nil {
 		klog.V(3).ErrorS(err, "failed to get pvc/sc, pod: %s, node: %vs", pod.Name, nodeName)
 		return 0, framework.NewStatus(framework.UnschedulableAndUnresolvable, err.Error())
@@ -166,20 +304,20 @@ func (ls *LocalStorage) Score(ctx context.Context, state *framework.CycleState,
 		return 5, framework.NewStatus(framework.Success, "")
 	}
 
-	allocatableMap, err := ls.getAllocatableMap(useRaw, pod.Name, nodeName)
+	allocatableMap, _, err := ls.getAllocatableMap(useRaw, pod, nodeName)
 	if err != nil {
 		return 0, framework.NewStatus(framework.UnschedulableAndUnresolvable, err.Error())
 	}
 
 	// 计算节点分数
-	// 影响磁盘分数的有磁盘容量,磁盘上现有pv数量,磁盘IO
-	// 在此我们以磁盘容量作为标准，同时配合配置文件中磁盘选择策略
+	// 影响磁盘分数的有磁盘容量,磁盘上现有pv数量,磁盘IO，各部分按配置文件中scoreWeights加权
+	// 磁盘容量评分配合存储类或配置文件中磁盘选择策略
 	var scoref float64 = 0
 	count := 0
 	for scDeviceGroup, pvcRequests := range pvcRequestMap {
 		var requestTotalBytes int64
 		for _, pvcR := range pvcRequests {
-			requestTotalBytes += pvcR.request
+			requestTotalBytes += pvcR.consumed()
 		}
 		requestTotalGb := (requestTotalBytes-1)>>30 + 1
 
@@ -195,30 +333,201 @@ func (ls *LocalStorage) Score(ctx context.Context, state *framework.CycleState,
 			allocatableTotal = allocatableMap[scDeviceGroup]
 		}
 
-		count++
-		if configuration.SchedulerStrategy() == configuration.Schedulerspreadout {
-			scoref += 1.0 - float64(requestTotalGb)/float64(allocatableTotal)
-		}
-		if configuration.SchedulerStrategy() == configuration.SchedulerBinpack {
-			scoref += float64(requestTotalGb) / float64(allocatableTotal)
+		// 同一磁盘组的pvc可能来自不同存储类，按各自的策略计分
+		fraction := float64(requestTotalGb) / float64(allocatableTotal)
+		for _, pvcR := range pvcRequests {
+			count++
+			if pvcR.strategy == configuration.Schedulerspreadout {
+				scoref += 1.0 - fraction
+			}
+			if pvcR.strategy == configuration.SchedulerBinpack {
+				scoref += fraction
+			}
 		}
 	}
 
-	score := int64(scoref / float64(count) * float64(MaxScore))
+	capacityScore := scoref / float64(count)
+	weights := configuration.GetScoreWeights()
+	weighted := weights.Capacity * capacityScore
+	weightTotal := weights.Capacity
+	if weights.LVCount > 0 {
+		if s, ok := ls.lvCountScore(nodeName, pvcRequestMap); ok {
+			weighted += weights.LVCount * s
+			weightTotal += weights.LVCount
+		}
+	}
+	if weights.IOUtilization > 0 {
+		if s, ok := ls.ioUtilizationScore(nodeName, pvcRequestMap, allocatableMap); ok {
+			weighted += weights.IOUtilization * s
+			weightTotal += weights.IOUtilization
+		}
+	}
+	if weightTotal == 0 {
+		weighted, weightTotal = capacityScore, 1
+	}
+	score := int64(weighted / weightTotal * float64(MaxScore))
 
 	klog.V(3).Infof("score pod: %s, node: %s, score: %d", pod.Name, nodeName, score)
 	return score, framework.NewStatus(framework.Success)
 }
 
+// lvCountScore 磁盘组上已有的卷越少得分越高，裸盘没有卷组不参与该项评分
+func (ls *LocalStorage) lvCountScore(nodeName string, pvcRequestMap map[string][]*pvcRequest) (float64, bool) {
+	nsr, err := getNodeStorageResource(ls.dynamicClient, ls.nsrLister, nodeName)
+	if err != nil {
+		klog.V(3).Infof("Failed to obtain node storages, node: %s, err: %s", nodeName, err.Error())
+		return 0, false
+	}
+	lvCounts := map[string]uint64{}
+	for _, vg := range nsr.Status.VgGroups {
+		lvCounts[vg.VGName] = vg.LVCount
+	}
+	var scoref float64
+	count := 0
+	for scDeviceGroup := range pvcRequestMap {
+		lvCount, ok := lvCounts[strings.TrimPrefix(scDeviceGroup, carina.ThinCapacityKeyPrefix)]
+		if !ok {
+			continue
+		}
+		scoref += 1.0 / float64(1+lvCount)
+		count++
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return scoref / float64(count), true
+}
+
+// ioUtilizationScore 磁盘组最近的IO利用率越低得分越高，利用率由carina-node根据/proc/diskstats计算
+func (ls *LocalStorage) ioUtilizationScore(nodeName string, pvcRequestMap map[string][]*pvcRequest, allocatableMap map[string]int64) (float64, bool) {
+	utilization, err := getDeviceUtilization(ls.dynamicClient, ls.nsrLister, nodeName)
+	if err != nil {
+		klog.V(3).Infof("Failed to obtain device utilization, node: %s, err: %s", nodeName, err.Error())
+		return 0, false
+	}
+	var scoref float64
+	count := 0
+	for scDeviceGroup := range pvcRequestMap {
+		var groups []string
+		if configuration.CheckRawDeviceGroup(scDeviceGroup) {
+			for lvGroup := range allocatableMap {
+				if strings.Contains(lvGroup, scDeviceGroup) {
+					groups = append(groups, lvGroup)
+				}
+			}
+		} else {
+			groups = append(groups, strings.TrimPrefix(scDeviceGroup, carina.ThinCapacityKeyPrefix))
+		}
+		for _, group := range groups {
+			u, ok := utilization[group]
+			if !ok {
+				continue
+			}
+			if u > 100 {
+				u = 100
+			}
+			scoref += 1.0 - float64(u)/100
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return scoref / float64(count), true
+}
+
 // ScoreExtensions of the Score plugin.
 func (ls *LocalStorage) ScoreExtensions() framework.ScoreExtensions {
 	return nil
 }
 
-func (ls *LocalStorage) getPvcRequestMap(pod *v1.Pod) (map[string][]*pvcRequest, string, bool, error) {
+// Reserve 在节点上预留pod所需的容量，直到卷创建完成
+func (ls *LocalStorage) Reserve(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) *framework.Status {
+	pvcRequestMap, _, useRaw, err := ls.getPvcRequestMap(state, pod)
+	if err != nil {
+		return framework.NewStatus(framework.Error, err.Error())
+	}
+	if len(pvcRequestMap) == 0 {
+		return framework.NewStatus(framework.Success, "")
+	}
+
+	allocatableMap, _, err := ls.getAllocatableMap(useRaw, pod, nodeName)
+	if err != nil {
+		return framework.NewStatus(framework.Unschedulable, err.Error())
+	}
+	antiAffinityDisks, err := ls.getAntiAffinityDisks(pvcRequestMap, nodeName)
+	if err != nil {
+		return framework.NewStatus(framework.Error, "failed to obtain node lvs, "+err.Error())
+	}
+	claims, ok := planClaims(pvcRequestMap, allocatableMap, antiAffinityDisks)
+	if !ok {
+		klog.V(3).Infof("reserve failed pod: %s, node: %s, allocatable: %v", pod.Name, nodeName, allocatableMap)
+		return framework.NewStatus(framework.Unschedulable, "node storage resource insufficient")
+	}
+	ls.ledger.reserve(pod.UID, nodeName, claims)
+	klog.V(3).Infof("reserve pod: %s, node: %s, claims: %v", pod.Name, nodeName, claims)
+	return framework.NewStatus(framework.Success, "")
+}
+
+// Unreserve 调度或绑定失败时释放pod的预留
+func (ls *LocalStorage) Unreserve(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) {
+	klog.V(3).Infof("unreserve pod: %s, node: %s", pod.Name, nodeName)
+	ls.ledger.release(pod.UID)
+}
+
+// PreBind 卷绑定时lv可能尚未创建，NodeStorageResource也未刷新容量，预留在宽限期后释放，避免期间超额分配
+func (ls *LocalStorage) PreBind(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) *framework.Status {
+	ls.ledger.expire(pod.UID, bindingGracePeriod)
+	return framework.NewStatus(framework.Success, "")
+}
+
+// getDataSourceNodes 未启用PreFilter时由第一次调用者查询并写入CycleState
+func (ls *LocalStorage) getDataSourceNodes(state *framework.CycleState, pod *v1.Pod) (dataSourceNodes, error) {
+	ls.stateMutex.Lock()
+	defer ls.stateMutex.Unlock()
+	if data, err := state.Read(dataSourceNodesKey); err == nil {
+		if nodes, ok := data.(dataSourceNodes); ok {
+			return nodes, nil
+		}
+	}
+
+	nodes := dataSourceNodes{}
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc, err := ls.pvcLister.PersistentVolumeClaims(pod.Namespace).Get(vol.PersistentVolumeClaim.ClaimName)
+		if err != nil {
+			return nil, err
+		}
+		if pvc.Spec.DataSource == nil || pvc.Status.Phase == v1.ClaimBound || pvc.Spec.StorageClassName == nil {
+			continue
+		}
+		sc, err := ls.scLister.Get(*pvc.Spec.StorageClassName)
+		if err != nil {
+			return nil, err
+		}
+		if sc.Provisioner != carina.CSIPluginName {
+			continue
+		}
+		sourceNode, err := getDataSourceNode(ls.dynamicClient, ls.pvcLister, ls.pvLister, pvc)
+		if err != nil {
+			return nil, err
+		}
+		nodes[pvc.Name] = sourceNode
+	}
+	state.Write(dataSourceNodesKey, nodes)
+	return nodes, nil
+}
+
+func (ls *LocalStorage) getPvcRequestMap(state *framework.CycleState, pod *v1.Pod) (map[string][]*pvcRequest, string, bool, error) {
 	nodeName := ""
 	pvcRequestMap := map[string][]*pvcRequest{}
 	var useRaw, exclusive bool
+	sourceNodes, err := ls.getDataSourceNodes(state, pod)
+	if err != nil {
+		return pvcRequestMap, nodeName, useRaw, err
+	}
 	for _, vol := range pod.Spec.Volumes {
 		if vol.PersistentVolumeClaim == nil {
 			continue
@@ -256,6 +565,15 @@ func (ls *LocalStorage) getPvcRequestMap(pod *v1.Pod) (map[string][]*pvcRequest,
 			continue
 		}
 
+		// 从快照或pvc克隆的pv只能在数据源所在节点创建
+		if sourceNode := sourceNodes[pvcName]; sourceNode != "" {
+			if nodeName == "" {
+				nodeName = sourceNode
+			} else if nodeName != sourceNode {
+				return pvcRequestMap, nodeName, useRaw, errors.New("pvc node clash")
+			}
+		}
+
 		deviceGroup := sc.Parameters[carina.DeviceDiskKey]
 
 		if configuration.CheckHostDeviceGroup(deviceGroup) {
@@ -272,6 +590,11 @@ func (ls *LocalStorage) getPvcRequestMap(pod *v1.Pod) (map[string][]*pvcRequest,
 			deviceGroup = sc.Parameters[carina.VolumeBackendDiskType]
 		}
 
+		strategy := strings.ToLower(sc.Parameters[carina.VolumeSchedulerStrategy])
+		if strategy != configuration.SchedulerBinpack && strategy != configuration.Schedulerspreadout {
+			strategy = configuration.SchedulerStrategy()
+		}
+
 		cacheGroup := sc.Parameters[carina.VolumeCacheDiskType]
 		if cacheGroup != "" {
 			cacheGroup = configuration.GetDeviceGroup(deviceGroup)
@@ -284,7 +607,7 @@ func (ls *LocalStorage) getPvcRequestMap(pod *v1.Pod) (map[string][]*pvcRequest,
 				return pvcRequestMap, nodeName, useRaw, errors.New("carina.storage.io/cache-disk-ratio should be in 1-100")
 			}
 			cacheRequestBytes := pvc.Spec.Resources.Requests.Storage().Value() * ratio / 100
-			pvcRequestMap[cacheGroup] = append(pvcRequestMap[cacheGroup], &pvcRequest{false, cacheRequestBytes})
+			pvcRequestMap[cacheGroup] = append(pvcRequestMap[cacheGroup], &pvcRequest{exclusive: false, request: cacheRequestBytes, copies: 1, strategy: strategy})
 		}
 
 		if deviceGroup == "" {
@@ -295,13 +618,69 @@ func (ls *LocalStorage) getPvcRequestMap(pod *v1.Pod) (map[string][]*pvcRequest,
 		if sc.Parameters[carina.ExclusivityDisk] == "true" {
 			exclusive = true
 		}
-		pvcRequestMap[deviceGroup] = append(pvcRequestMap[cacheGroup], &pvcRequest{exclusive, pvc.Spec.Resources.Requests.Storage().Value()})
+		// thin卷以thin pool超分后的容量参与调度
+		if sc.Parameters[carina.VolumeLvmType] == carina.LvmTypeThin && !configuration.CheckRawDeviceGroup(deviceGroup) {
+			deviceGroup = carina.ThinCapacityKeyPrefix + deviceGroup
+		}
+		// 条带卷及raid卷的参数错误由controller校验
+		stripes, _ := strconv.ParseInt(sc.Parameters[carina.VolumeLvmStripes], 10, 64)
+		copies := int64(1)
+		if lvmType := sc.Parameters[carina.VolumeLvmType]; lvmType == carina.LvmTypeRaid1 || lvmType == carina.LvmTypeRaid10 {
+			mirrors, err := strconv.ParseInt(sc.Parameters[carina.VolumeLvmMirrors], 10, 64)
+			if err != nil || mirrors < 1 {
+				mirrors = 1
+			}
+			copies = mirrors + 1
+		}
+		antiAffinity, antiAffinityKey := getDiskAntiAffinity(sc.Parameters, pvc)
+		pvcRequestMap[deviceGroup] = append(pvcRequestMap[cacheGroup], &pvcRequest{
+			exclusive:       exclusive,
+			request:         pvc.Spec.Resources.Requests.Storage().Value(),
+			stripes:         stripes,
+			copies:          copies,
+			strategy:        strategy,
+			antiAffinity:    antiAffinity,
+			antiAffinityKey: antiAffinityKey,
+		})
 	}
 	klog.V(3).Infof("pvcRequestMap: %v, node: %s, useRaw: %v", pvcRequestMap, nodeName, useRaw)
 	return pvcRequestMap, nodeName, useRaw, nil
 }
 
-func (ls *LocalStorage) getAllocatableMap(useRaw bool, podName, nodeName string) (map[string]int64, error) {
+// getDiskAntiAffinity pvc注解优先于存储类参数，参数错误由controller校验，未设置key时忽略反亲和
+func getDiskAntiAffinity(params map[string]string, pvc *v1.PersistentVolumeClaim) (string, string) {
+	lookup := func(key string) string {
+		if v, ok := pvc.Annotations[key]; ok {
+			return v
+		}
+		return params[key]
+	}
+	policy := strings.ToLower(lookup(carina.VolumeDiskAntiAffinity))
+	key := lookup(carina.VolumeDiskAntiAffinityKey)
+	if (policy != carina.DiskAntiAffinityPreferred && policy != carina.DiskAntiAffinityRequired) || key == "" {
+		return "", ""
+	}
+	return policy, pvc.Namespace + "/" + key
+}
+
+// getAntiAffinityDisks 仅当pod存在反亲和的裸盘卷时查询节点上同组卷使用的裸盘
+func (ls *LocalStorage) getAntiAffinityDisks(pvcRequestMap map[string][]*pvcRequest, nodeName string) (map[string][]string, error) {
+	for scDeviceGroup, pvcRequests := range pvcRequestMap {
+		if !configuration.CheckRawDeviceGroup(scDeviceGroup) {
+			continue
+		}
+		for _, pvcR := range pvcRequests {
+			if pvcR.antiAffinity != "" {
+				return getAntiAffinityDisks(ls.dynamicClient, ls.lvLister, nodeName)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// getAllocatableMap 返回节点各磁盘组及裸盘的可分配容量，以及从中扣除的其他pod的预留容量
+func (ls *LocalStorage) getAllocatableMap(useRaw bool, pod *v1.Pod, nodeName string) (map[string]int64, map[string]int64, error) {
+	podName := pod.Name
 	var lvExclusivityDisks []string
 	var err error
 	allocatableMap := map[string]int64{}
@@ -309,17 +688,21 @@ func (ls *LocalStorage) getAllocatableMap(useRaw bool, podName, nodeName string)
 		lvExclusivityDisks, err = getLvExclusivityDisks(ls.dynamicClient, ls.lvLister, nodeName)
 		if err != nil {
 			klog.V(3).Infof("Failed to obtain node lvs, pod: %s node: %s, err: %s", podName, nodeName, err.Error())
-			return allocatableMap, errors.New("failed to obtain node lvs, " + err.Error())
+			return allocatableMap, nil, errors.New("failed to obtain node lvs, " + err.Error())
 		}
 	}
 
 	nsr, err := getNodeStorageResource(ls.dynamicClient, ls.nsrLister, nodeName)
 	if err != nil {
 		klog.V(3).Infof("Failed to obtain node storages, pod: %s node: %s, err: %s", podName, nodeName, err.Error())
-		return allocatableMap, errors.New("Failed to obtain node storages, " + err.Error())
+		return allocatableMap, nil, errors.New("Failed to obtain node storages, " + err.Error())
 	}
 
 	for groupDetail, allocatable := range nsr.Status.Allocatable {
+		if strings.HasPrefix(groupDetail, carina.ThinCapacityKeyPrefix) {
+			allocatableMap[groupDetail] = allocatable.Value()
+			continue
+		}
 		if !strings.HasPrefix(groupDetail, carina.DeviceCapacityKeyPrefix) {
 			continue
 		}
@@ -336,13 +719,70 @@ func (ls *LocalStorage) getAllocatableMap(useRaw bool, podName, nodeName string)
 			allocatableMap[lvGroup] = allocatable.Value()
 		}
 	}
-	klog.V(3).Infof("allocatableMap: %v", allocatableMap)
-
 	if len(allocatableMap) == 0 {
 		klog.V(3).Infof("can't get device allocatableMap, pod: %s, node: %s", podName, nodeName)
-		return allocatableMap, errors.New("can't get device allocatableMap")
+		return allocatableMap, nil, errors.New("can't get device allocatableMap")
+	}
+	// 扣除其他pod已预留但尚未体现在NodeStorageResource中的容量
+	reserved := ls.ledger.subtract(nodeName, allocatableMap, pod.UID)
+	klog.V(3).Infof("allocatableMap: %v, reserved: %v", allocatableMap, reserved)
+	return allocatableMap, reserved, nil
+}
+
+// stripeFits 条带卷的每个条带及raid卷的每个镜像需要落在卷组中不同的pv上，依次为每个卷选择剩余空间最大的pv
+func (ls *LocalStorage) stripeFits(nodeName, vgName string, pvcRequests []*pvcRequest) bool {
+	striped := false
+	for _, pvcR := range pvcRequests {
+		if pvcR.images() > 1 {
+			striped = true
+		}
+	}
+	if !striped {
+		return true
+	}
+
+	nsr, err := getNodeStorageResource(ls.dynamicClient, ls.nsrLister, nodeName)
+	if err != nil {
+		klog.V(3).Infof("Failed to obtain node storages, node: %s, err: %s", nodeName, err.Error())
+		return false
+	}
+	var pvFree []int64
+	for _, vg := range nsr.Status.VgGroups {
+		if vg.VGName != vgName {
+			continue
+		}
+		for _, pv := range vg.PVS {
+			// 被隔离的pv(pv_attr不含a)不再分配
+			if pv != nil && (pv.PVAttr == "" || pv.PVAttr[0] == 'a') {
+				pvFree = append(pvFree, int64(pv.PVFree))
+			}
+		}
+	}
+
+	for _, pvcR := range pvcRequests {
+		images := pvcR.images()
+		if images <= 1 {
+			continue
+		}
+		if int64(len(pvFree)) < images {
+			return false
+		}
+		sort.Slice(pvFree, func(i, j int) bool {
+			return pvFree[i] > pvFree[j]
+		})
+		stripes := pvcR.stripes
+		if stripes < 1 {
+			stripes = 1
+		}
+		stripeBytes := (pvcR.request + stripes - 1) / stripes
+		for i := int64(0); i < images; i++ {
+			if pvFree[i] < stripeBytes {
+				return false
+			}
+			pvFree[i] -= stripeBytes
+		}
 	}
-	return allocatableMap, nil
+	return true
 }
 
 // 在所有容量列表中，找到最低满足的值，并减去请求容量
@@ -152,6 +152,15 @@ func Fill(src interface{}, dst interface{}) error {
 
 }
 
+// CacheGb the lvm native cache takes the percent of the volume size, rounded up to whole GiB so that
+// a small volume still gets at least 1GiB of cache
+func CacheGb(sizeGb int64, ratio uint32) int64 {
+	if sizeGb <= 0 || ratio == 0 {
+		return 0
+	}
+	return (sizeGb*int64(ratio) + 99) / 100
+}
+
 func PartitionName(lv string) string {
 	strtemp := strings.Split(lv, "-")
 	return fmt.Sprintf("%s/%s", carina.CarinaPrefix, strtemp[len(strtemp)-1])
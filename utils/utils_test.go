@@ -114,3 +114,24 @@ func TestIsStaticPod(t *testing.T) {
 
 	assert.New(t).True(IsStaticPod(pod))
 }
+
+func TestCacheGb(t *testing.T) {
+	table := []struct {
+		sizeGb int64
+		ratio  uint32
+		result int64
+	}{
+		{sizeGb: 1, ratio: 50, result: 1},
+		{sizeGb: 1, ratio: 1, result: 1},
+		{sizeGb: 3, ratio: 50, result: 2},
+		{sizeGb: 100, ratio: 20, result: 20},
+		{sizeGb: 10, ratio: 0, result: 0},
+		{sizeGb: 0, ratio: 50, result: 0},
+	}
+
+	for _, e := range table {
+		if CacheGb(e.sizeGb, e.ratio) != e.result {
+			t.Errorf("CacheGb(%d, %d) = %d, want %d", e.sizeGb, e.ratio, CacheGb(e.sizeGb, e.ratio), e.result)
+		}
+	}
+}